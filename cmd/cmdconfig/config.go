@@ -2,13 +2,48 @@ package cmdconfig
 
 type Config struct {
 	Port      int
+	Watch     bool
+	Hot       bool
 	Index     string
 	Template  string
 	Json      bool
 	Verbose   bool
 	Open      bool
 	Command   string
+	Compiler  string
+	TinyGo    string // name of the tinygo command, used with the tinygo compiler
 	Flags     string
 	BuildTags string
 	Path      string
+	Output    string
+	BaseUrl   string
+	Archive   string
+	Target    string
+	TargetUrl string
+	PublicUrl string
+	Endpoints string
+	WasmUrl   string
+	PkgUrl    string
+	IndexUrl  string
+	Profile   string
+	Project   string          // path of the project config file, if any
+	Defaulted map[string]bool // flags that were set by the project config file
+	BuildArgs []string        // arguments for the build command from the project config file
+	BuildEnv  []string        // environment variables for the build command, as KEY=value pairs
+	Test      bool            // build a test binary with go test -c
+	TestArgs  []string        // arguments for the test binary, passed as go.argv by the dev loader
+	Run       string
+	Bench     string
+	Count     int
+	Cover     string // local file to write the coverage profile of a test run to
+	Top       int    // number of packages and functions in the size report, or 0 for all
+	Split     string // packages moved to a lazily loaded module, comma separated, or "runtime"
+	Input     string // binary or package read by the wasm commands
+	SplitOut  string // primary module written by the wasm split command
+	Prefix    string // function name prefixes for the wasm commands, comma separated
+	Funcs     bool   // show functions in the call graph instead of packages
+	Dir       string
+	WasmPort  int
+	PkgPort   int
+	IndexPort int
 }
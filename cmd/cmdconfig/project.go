@@ -0,0 +1,254 @@
+package cmdconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ProjectFiles are the names of the project config file, in order of precedence. JSON is parsed
+// as YAML, which is a superset.
+var ProjectFiles = []string{"wasmgo.yaml", "wasmgo.yml", "wasmgo.json"}
+
+// Project is a project config file. Its settings are defaults for the command line flags, and
+// each profile is a named set of settings that is applied on top.
+type Project struct {
+	Path     string
+	Settings Settings
+	Profiles map[string]Settings
+}
+
+// Settings are the contents of a project config file or profile. The flags, build (or tags) and
+// env keys are parsed into Args, Tags and Env. All other keys are flag names.
+type Settings struct {
+	Values map[string]string // defaults for flags, keyed by flag name
+	Args   []string          // arguments for the build command
+	Tags   []string          // build tags
+	Env    map[string]string // environment variables for the build command
+}
+
+// EnvList returns Env as a sorted list of KEY=value pairs.
+func (s Settings) EnvList() []string {
+	var env []string
+	for k, v := range s.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// FindProject searches dir and its parents for a project config file, stopping at the module root
+// (the directory containing go.mod). If no file is found, the path is empty.
+func FindProject(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range ProjectFiles {
+			fpath := filepath.Join(dir, name)
+			if _, err := os.Stat(fpath); err == nil {
+				return fpath, nil
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadProject reads and parses a project config file.
+func LoadProject(fpath string) (*Project, error) {
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", fpath, err)
+	}
+	p := &Project{Path: fpath, Profiles: map[string]Settings{}}
+	if profiles, ok := raw["profiles"]; ok {
+		delete(raw, "profiles")
+		m, ok := profiles.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: profiles should be a map of profile names to settings", fpath)
+		}
+		for name, value := range m {
+			settings, ok := value.(map[interface{}]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: profile %v should be a map of settings", fpath, name)
+			}
+			s, err := parseSettings(stringKeys(settings))
+			if err != nil {
+				return nil, fmt.Errorf("%s: profile %v: %v", fpath, name, err)
+			}
+			p.Profiles[fmt.Sprint(name)] = s
+		}
+	}
+	s, err := parseSettings(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fpath, err)
+	}
+	p.Settings = s
+	return p, nil
+}
+
+// Merge returns the settings of the project with the named profile applied. Profile values replace
+// the project values, and profile arguments, tags and environment variables are added to them.
+func (p *Project) Merge(profile string) (Settings, error) {
+	merged := Settings{Values: map[string]string{}, Env: map[string]string{}}
+	layers := []Settings{p.Settings}
+	if profile != "" {
+		s, ok := p.Profiles[profile]
+		if !ok {
+			return Settings{}, fmt.Errorf("unknown profile %q in %s", profile, p.Path)
+		}
+		layers = append(layers, s)
+	}
+	for _, s := range layers {
+		for k, v := range s.Values {
+			merged.Values[k] = v
+		}
+		for k, v := range s.Env {
+			merged.Env[k] = v
+		}
+		merged.Args = append(merged.Args, s.Args...)
+		merged.Tags = append(merged.Tags, s.Tags...)
+	}
+	return merged, nil
+}
+
+func parseSettings(raw map[string]interface{}) (Settings, error) {
+	s := Settings{Values: map[string]string{}, Env: map[string]string{}}
+	for key, value := range raw {
+		switch key {
+		case "flags":
+			args, err := stringList(value, SplitArgs)
+			if err != nil {
+				return Settings{}, fmt.Errorf("flags: %v", err)
+			}
+			s.Args = append(s.Args, args...)
+		case "build", "tags":
+			tags, err := stringList(value, func(s string) ([]string, error) {
+				return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }), nil
+			})
+			if err != nil {
+				return Settings{}, fmt.Errorf("%s: %v", key, err)
+			}
+			s.Tags = append(s.Tags, tags...)
+		case "env":
+			m, ok := value.(map[interface{}]interface{})
+			if !ok {
+				return Settings{}, fmt.Errorf("env should be a map of variable names to values")
+			}
+			for k, v := range m {
+				if _, ok := v.([]interface{}); ok {
+					return Settings{}, fmt.Errorf("env: %v should be a string", k)
+				}
+				s.Env[fmt.Sprint(k)] = scalar(v)
+			}
+		default:
+			switch value.(type) {
+			case []interface{}, map[interface{}]interface{}:
+				return Settings{}, fmt.Errorf("%s should be a single value", key)
+			}
+			s.Values[key] = scalar(value)
+		}
+	}
+	return s, nil
+}
+
+// stringList accepts a list of strings, or a single string that is split by split.
+func stringList(value interface{}, split func(string) ([]string, error)) ([]string, error) {
+	switch value := value.(type) {
+	case []interface{}:
+		var list []string
+		for _, v := range value {
+			list = append(list, scalar(v))
+		}
+		return list, nil
+	case string:
+		return split(value)
+	}
+	return nil, fmt.Errorf("should be a list or a string")
+}
+
+func scalar(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func stringKeys(m map[interface{}]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range m {
+		out[fmt.Sprint(k)] = v
+	}
+	return out
+}
+
+// SplitArgs splits s into arguments like a shell would, so quoted arguments such as
+// -ldflags="-s -w" are kept together. Single and double quotes and backslash escapes are
+// supported.
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	var inArg, escaped bool
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, s)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in %q", s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,7 @@
+//go:build !local
+// +build !local
+
+package config
+
+// DefaultSet is the endpoint set used when none is configured.
+const DefaultSet = SetJsgo
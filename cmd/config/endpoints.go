@@ -0,0 +1,228 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SetJsgo  = "jsgo"
+	SetLocal = "local"
+)
+
+// Sets are the built in endpoint sets. Sets with other names can be defined in the config file.
+var Sets = map[string]Endpoints{
+	SetJsgo: {
+		Wasm:  "https://wasm.jsgo.io",
+		Pkg:   "https://pkg.jsgo.io",
+		Index: "https://jsgo.io",
+	},
+	SetLocal: {
+		Wasm:  "http://localhost:8083",
+		Pkg:   "http://localhost:8092",
+		Index: "http://localhost:8093",
+	},
+}
+
+// Endpoints are the base URLs of the jsgo hosts: the wasm host accepts deploys, the pkg host
+// serves binaries and scripts, and the index host serves index pages.
+type Endpoints struct {
+	Wasm  string `json:"wasm,omitempty"`
+	Pkg   string `json:"pkg,omitempty"`
+	Index string `json:"index,omitempty"`
+
+	Set       string            `json:"-"` // name of the endpoint set
+	SetSource string            `json:"-"` // where the endpoint set was chosen
+	Sources   map[string]string `json:"-"` // where each endpoint was configured, keyed by Wasm, Pkg or Index
+}
+
+// Get returns the base URL of the host: Wasm, Pkg or Index.
+func (e *Endpoints) Get(host string) string {
+	switch host {
+	case Wasm:
+		return e.Wasm
+	case Pkg:
+		return e.Pkg
+	case Index:
+		return e.Index
+	}
+	return ""
+}
+
+func (e *Endpoints) set(host, value, source string) {
+	switch host {
+	case Wasm:
+		e.Wasm = value
+	case Pkg:
+		e.Pkg = value
+	case Index:
+		e.Index = value
+	}
+	e.Sources[host] = source
+}
+
+// File is the format of the config file. The endpoint set is chosen by Endpoints, and individual
+// endpoints may be overridden by Wasm, Pkg and Index. Sets defines extra endpoint sets, or
+// replaces the built in ones.
+type File struct {
+	Endpoints string               `json:"endpoints,omitempty"`
+	Wasm      string               `json:"wasm,omitempty"`
+	Pkg       string               `json:"pkg,omitempty"`
+	Index     string               `json:"index,omitempty"`
+	Sets      map[string]Endpoints `json:"sets,omitempty"`
+}
+
+// Env are the environment variables that configure the endpoints.
+const (
+	EnvConfig    = "WASMGO_CONFIG"
+	EnvEndpoints = "WASMGO_ENDPOINTS"
+	EnvWasm      = "WASMGO_WASM_URL"
+	EnvPkg       = "WASMGO_PKG_URL"
+	EnvIndex     = "WASMGO_INDEX_URL"
+)
+
+// FilePath returns the location of the config file: the WASMGO_CONFIG environment variable if
+// set, or wasmgo/config.json in the user config directory.
+func FilePath() (string, error) {
+	if fpath := os.Getenv(EnvConfig); fpath != "" {
+		return fpath, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wasmgo", "config.json"), nil
+}
+
+// LoadFile reads the config file. A missing file is not an error, unless it was specified by the
+// WASMGO_CONFIG environment variable.
+func LoadFile() (*File, string, error) {
+	fpath, err := FilePath()
+	if err != nil {
+		return &File{}, "", nil
+	}
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		if os.IsNotExist(err) && os.Getenv(EnvConfig) == "" {
+			return &File{}, "", nil
+		}
+		return nil, "", err
+	}
+	f := &File{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, "", fmt.Errorf("parsing %s: %v", fpath, err)
+	}
+	return f, fpath, nil
+}
+
+// Load returns the endpoints in effect. Each setting is taken from the first of: flags (passed in
+// as flags, with set naming the endpoint set), the WASMGO_* environment variables, the config file
+// and the default set. Flags are reported as the source unless flags.SetSource and flags.Sources
+// name another, e.g. the project config file, which sets flags that aren't on the command line.
+// The endpoints are validated before they're returned.
+func Load(set string, flags Endpoints) (*Endpoints, error) {
+	file, fpath, err := LoadFile()
+	if err != nil {
+		return nil, err
+	}
+
+	sets := map[string]Endpoints{}
+	for name, e := range Sets {
+		sets[name] = e
+	}
+	for name, e := range file.Sets {
+		sets[name] = e
+	}
+
+	type setting struct {
+		value, source string
+	}
+	first := func(settings ...setting) setting {
+		for _, s := range settings {
+			if s.value != "" {
+				return s
+			}
+		}
+		return setting{}
+	}
+
+	flagSource := func(source, flag string) string {
+		if source != "" {
+			return source
+		}
+		return flag
+	}
+
+	name := first(
+		setting{set, flagSource(flags.SetSource, "--endpoints flag")},
+		setting{os.Getenv(EnvEndpoints), EnvEndpoints},
+		setting{file.Endpoints, fpath},
+		setting{DefaultSet, "default"},
+	)
+	base, ok := sets[name.value]
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint set %q (from %s)", name.value, name.source)
+	}
+
+	e := &Endpoints{Set: name.value, SetSource: name.source, Sources: map[string]string{}}
+	for _, host := range []string{Wasm, Pkg, Index} {
+		s := first(
+			setting{flags.Get(host), flagSource(flags.Sources[host], fmt.Sprintf("--%s-url flag", host))},
+			setting{os.Getenv(envFor(host)), envFor(host)},
+			setting{(&Endpoints{Wasm: file.Wasm, Pkg: file.Pkg, Index: file.Index}).Get(host), fpath},
+			setting{base.Get(host), fmt.Sprintf("%s set", name.value)},
+		)
+		e.set(host, s.value, s.source)
+	}
+
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func envFor(host string) string {
+	switch host {
+	case Wasm:
+		return EnvWasm
+	case Pkg:
+		return EnvPkg
+	default:
+		return EnvIndex
+	}
+}
+
+// Validate checks each endpoint is an absolute http or https URL.
+func (e *Endpoints) Validate() error {
+	for _, host := range []string{Wasm, Pkg, Index} {
+		value := e.Get(host)
+		source := e.Sources[host]
+		if value == "" {
+			return fmt.Errorf("the %s endpoint is not set in the %s endpoint set", host, e.Set)
+		}
+		u, err := url.Parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s endpoint %q (from %s): %v", host, value, source, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid %s endpoint %q (from %s): should be an http or https URL", host, value, source)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("invalid %s endpoint %q (from %s): no host", host, value, source)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid %s endpoint %q (from %s): should not have a query or fragment", host, value, source)
+		}
+	}
+	return nil
+}
+
+// URL returns the URL of name on the host.
+func (e *Endpoints) URL(host, name string) string {
+	return strings.TrimSuffix(e.Get(host), "/") + "/" + name
+}
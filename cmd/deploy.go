@@ -1,15 +1,23 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"text/template"
 
 	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/pkg/browser"
 	"github.com/spf13/cobra"
 )
 
 func init() {
-	deployCmd.PersistentFlags().StringVarP(&global.Template, "template", "t", "{{ .Page }}", "Template defining the output returned by the deploy command. Variables: Page, Script, Loader, Binary.")
+	deployCmd.PersistentFlags().StringVarP(&global.Template, "template", "t", "{{ .Page }}", "Template defining the output returned by the deploy command. Variables: Page, Script, Loader, Binary, Split.")
+	deployCmd.PersistentFlags().StringVar(&global.Target, "target", "jsgo", "Where to deploy: jsgo, dir, s3 or http.")
+	deployCmd.PersistentFlags().StringVar(&global.TargetUrl, "target-url", "", "Location for the dir, s3 and http targets: a directory, the S3 endpoint and bucket URL, or the base URL for PUT requests.")
+	deployCmd.PersistentFlags().StringVar(&global.PublicUrl, "public-url", "", "Base URL the deployed files are served from, if different to the target URL.")
+	addEndpointFlags(deployCmd)
+	addSplitFlag(deployCmd)
 	deployCmd.PersistentFlags().BoolVarP(&global.Json, "json", "j", false, "Return all template variables as a json blob from the deploy command.")
 	rootCmd.AddCommand(deployCmd)
 }
@@ -17,20 +25,70 @@ func init() {
 var deployCmd = &cobra.Command{
 	Use:   "deploy [package]",
 	Short: "Compile and deploy",
-	Long:  "Compiles Go to WASM and deploys to the jsgo.io CDN.",
+	Long:  "Compiles Go to WASM and deploys to the jsgo.io CDN, or to the target specified by the target flag.",
 	Args:  cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) > 0 {
 			global.Path = args[0]
 		}
-		d, err := deployer.New(global)
+		ctx, cancel := interruptContext()
+		defer cancel()
+		d, err := deployer.New(ctx, global)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
 			os.Exit(1)
 		}
-		if err := d.Start(); err != nil {
+		result, err := d.Deploy(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if err := printResult(result); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
 			os.Exit(1)
 		}
+		if global.Open {
+			browser.OpenURL(result.Page)
+		}
 	},
 }
+
+// addEndpointFlags adds the flags that configure the jsgo endpoints.
+func addEndpointFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&global.Endpoints, "endpoints", "", "Endpoint set for the jsgo target: jsgo, local or a set from the config file.")
+	cmd.PersistentFlags().StringVar(&global.WasmUrl, "wasm-url", "", "Base URL of the wasm host, which accepts deploys.")
+	cmd.PersistentFlags().StringVar(&global.PkgUrl, "pkg-url", "", "Base URL of the pkg host, which serves binaries and scripts.")
+	cmd.PersistentFlags().StringVar(&global.IndexUrl, "index-url", "", "Base URL of the index host, which serves index pages.")
+}
+
+// addSplitFlag adds the flag that splits the binary into a primary and a lazily loaded module.
+func addSplitFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&global.Split, "split", "", "Move the functions of these packages (comma separated) to a module that's loaded after the program starts, or when first called. Use \"runtime\" for the runtime.")
+}
+
+func printResult(result *deployer.Result) error {
+	outputVars := struct{ Page, Script, Loader, Binary, Split string }{
+		Page:   result.Page,
+		Script: result.Script,
+		Loader: result.Loader,
+		Binary: result.Binary,
+		Split:  result.Split,
+	}
+	if global.Json {
+		out, err := json.Marshal(outputVars)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	tpl, err := template.New("main").Parse(global.Template)
+	if err != nil {
+		return err
+	}
+	if err := tpl.Execute(os.Stdout, outputVars); err != nil {
+		return err
+	}
+	fmt.Println("")
+	return nil
+}
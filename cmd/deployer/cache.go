@@ -0,0 +1,330 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores compiled WASM binaries on disk, keyed by a hash of everything that contributes to
+// the build. Concurrent requests for the same key are collapsed into a single build. When the
+// binaries take up more than MaxCacheSize, the least recently used are removed.
+type Cache struct {
+	dir   string
+	mu    sync.Mutex
+	calls map[string]*cacheCall
+}
+
+// MaxCacheSize is the size of the binaries in the cache directory above which the least recently
+// used are removed.
+const MaxCacheSize = 512 << 20
+
+type cacheCall struct {
+	done           chan struct{}
+	cancel         context.CancelFunc
+	waiters        int // callers waiting for the build; it's cancelled when they've all gone
+	contents, hash []byte
+	cached         bool
+	err            error
+}
+
+// NewCache returns a cache storing files in dir. If dir is empty, a wasmgo directory in the user
+// cache directory is used.
+func NewCache(dir string) (*Cache, error) {
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		dir = filepath.Join(base, "wasmgo")
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, calls: map[string]*cacheCall{}}, nil
+}
+
+// Get returns the cached binary for key, calling build if it's not in the cache. While a build is
+// in progress, other callers asking for the same key wait for it to finish and share the result,
+// and cached is false for all of them. The build isn't run with the context of any one caller, so
+// it's only cancelled when every caller waiting for it has cancelled.
+func (c *Cache) Get(ctx context.Context, key string, build func(ctx context.Context) (contents []byte, err error)) (contents, hash []byte, cached bool, err error) {
+	c.mu.Lock()
+	call, joined := c.calls[key]
+	if !joined {
+		buildCtx, cancel := context.WithCancel(context.Background())
+		call = &cacheCall{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = call
+		go func() {
+			call.contents, call.hash, call.cached, call.err = c.get(key, func() ([]byte, error) {
+				return build(buildCtx)
+			})
+			cancel()
+			c.mu.Lock()
+			if c.calls[key] == call {
+				delete(c.calls, key)
+			}
+			c.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.contents, call.hash, call.cached && !joined, call.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			// later callers start a new build rather than joining the cancelled one
+			if c.calls[key] == call {
+				delete(c.calls, key)
+			}
+		}
+		c.mu.Unlock()
+		return nil, nil, false, ctx.Err()
+	}
+}
+
+func (c *Cache) get(key string, build func() ([]byte, error)) (contents, hash []byte, cached bool, err error) {
+	fpath := filepath.Join(c.dir, key+".wasm")
+	contents, err = ioutil.ReadFile(fpath)
+	if err == nil {
+		// the modification time records when the binary was last used, for evict
+		now := time.Now()
+		os.Chtimes(fpath, now, now)
+		return contents, sha1sum(contents), true, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, nil, false, err
+	}
+	contents, err = build()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	// write to a temp file and rename, so other processes never see a partially written file
+	f, err := ioutil.TempFile(c.dir, key+".*.tmp")
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if _, err := f.Write(contents); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, nil, false, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return nil, nil, false, err
+	}
+	if err := os.Rename(f.Name(), fpath); err != nil {
+		os.Remove(f.Name())
+		return nil, nil, false, err
+	}
+	c.evict(MaxCacheSize)
+	return contents, sha1sum(contents), false, nil
+}
+
+// evict removes the least recently used binaries until the rest take up no more than max bytes,
+// along with temp files left behind by builds that were interrupted more than a day ago. Errors
+// are ignored, because another process may be evicting at the same time.
+func (c *Cache) evict(max int64) {
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	var binaries []os.FileInfo
+	var total int64
+	for _, e := range entries {
+		switch filepath.Ext(e.Name()) {
+		case ".wasm":
+			binaries = append(binaries, e)
+			total += e.Size()
+		case ".tmp":
+			if time.Since(e.ModTime()) > 24*time.Hour {
+				os.Remove(filepath.Join(c.dir, e.Name()))
+			}
+		}
+	}
+	sort.Slice(binaries, func(i, j int) bool { return binaries[i].ModTime().Before(binaries[j].ModTime()) })
+	for _, e := range binaries {
+		if total <= max {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, e.Name())); err == nil || os.IsNotExist(err) {
+			total -= e.Size()
+		}
+	}
+}
+
+// keyEnv are the go environment variables that change the binary without changing the flags or
+// the source files.
+var keyEnv = []string{"GOFLAGS", "GOEXPERIMENT", "CGO_ENABLED"}
+
+// CacheKey hashes the source files of the package and all its non-standard-library dependencies,
+// along with the build tags, flags, environment and toolchain version.
+func (d *State) CacheKey(ctx context.Context) (string, error) {
+	h := sha1.New()
+
+	version, err := d.toolchainVersion()
+	if err != nil {
+		return "", err
+	}
+	goEnv, err := d.goEnv(ctx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "compiler: %s\ncommand: %s\nversion: %s\nflags: %q\ntags: %s\nenv: %q\ngoenv: %q\npath: %s\ntest: %t\ncover: %t\n", d.cfg.Compiler, d.compilerCommand(), version, d.buildArgs, d.cfg.BuildTags, d.cfg.BuildEnv, goEnv, d.cfg.Path, d.cfg.Test, d.cover())
+
+	packages, err := d.listDeps(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range packages {
+		fmt.Fprintf(h, "package: %s\n", p.ImportPath)
+		if p.Standard {
+			// standard library is covered by the toolchain version
+			continue
+		}
+		for _, files := range [][]string{p.GoFiles, p.CgoFiles, p.SFiles, p.HFiles, p.EmbedFiles, p.TestGoFiles, p.XTestGoFiles} {
+			for _, name := range files {
+				if filepath.IsAbs(name) {
+					// generated by the go command (e.g. the test main), so covered by the other files
+					continue
+				}
+				fileHash, err := hashFile(filepath.Join(p.Dir, name))
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(h, "file: %s %x\n", name, fileHash)
+			}
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// WatchDirs returns the directories of the package and its non-standard-library dependencies.
+func (d *State) WatchDirs(ctx context.Context) ([]string, error) {
+	packages, err := d.listDeps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, p := range packages {
+		if !p.Standard {
+			dirs = append(dirs, p.Dir)
+		}
+	}
+	return dirs, nil
+}
+
+// listPackage is the subset of the output of `go list -json` used by wasmgo.
+type listPackage struct {
+	ImportPath                                    string
+	Dir                                           string
+	Standard                                      bool
+	GoFiles, CgoFiles, SFiles, HFiles, EmbedFiles []string
+	TestGoFiles, XTestGoFiles                     []string
+}
+
+// listDeps runs `go list -deps` for the package. When building a test binary, the dependencies of
+// the tests are included. Packages with errors, like syntax errors, are still listed, so the error
+// is reported by the build.
+func (d *State) listDeps(ctx context.Context) ([]listPackage, error) {
+	args := []string{"list", "-e", "-deps", "-json"}
+	if d.cfg.Test {
+		args = append(args, "-test")
+	}
+	if d.cfg.BuildTags != "" {
+		args = append(args, "-tags", d.cfg.BuildTags)
+	}
+	path := "."
+	if d.cfg.Path != "" {
+		path = d.cfg.Path
+	}
+	args = append(args, path)
+
+	cmd := exec.CommandContext(ctx, d.toolchain.Path, args...)
+	cmd.Env = buildEnv(d.cfg)
+	output, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			// e.g. a go.mod that can't be parsed
+			return nil, newBuildError(string(ee.Stderr))
+		}
+		return nil, err
+	}
+
+	var packages []listPackage
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for dec.More() {
+		var p listPackage
+		if err := dec.Decode(&p); err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+	return packages, nil
+}
+
+// goEnv returns the values of keyEnv in the build environment. They're read with `go env` rather
+// than from the environment, so values set with `go env -w` are included.
+func (d *State) goEnv(ctx context.Context) ([]string, error) {
+	cmd := exec.CommandContext(ctx, d.toolchain.Path, append([]string{"env"}, keyEnv...)...)
+	cmd.Env = buildEnv(d.cfg)
+	output, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("%v: %s", err, string(ee.Stderr))
+		}
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"), nil
+}
+
+func (d *State) toolchainVersion() (string, error) {
+	if !d.tinygo() {
+		return d.toolchain.Output, nil
+	}
+	d.versionOnce.Do(func() {
+		output, err := exec.Command(d.compilerCommand(), "version").CombinedOutput()
+		if err != nil {
+			d.versionErr = fmt.Errorf("%v: %s", err, string(output))
+			return
+		}
+		d.version = string(bytes.TrimSpace(output))
+	})
+	return d.version, d.versionErr
+}
+
+func hashFile(fpath string) ([]byte, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func sha1sum(b []byte) []byte {
+	s := sha1.Sum(b)
+	return s[:]
+}
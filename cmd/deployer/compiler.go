@@ -0,0 +1,87 @@
+package deployer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	CompilerGo     = "go"
+	CompilerTinyGo = "tinygo"
+)
+
+// TinyGoCommand is the name of the tinygo command, used with the tinygo compiler if the TinyGo
+// config field isn't set.
+const TinyGoCommand = "tinygo"
+
+func checkCompiler(compiler string) error {
+	switch compiler {
+	case "", CompilerGo, CompilerTinyGo:
+		return nil
+	}
+	return fmt.Errorf("unknown compiler %q - should be %q or %q", compiler, CompilerGo, CompilerTinyGo)
+}
+
+func (d *State) tinygo() bool {
+	return d.cfg.Compiler == CompilerTinyGo
+}
+
+// compilerCommand is the command that builds the binary. The tinygo compiler still uses the go
+// command for go list, and finds it in PATH itself.
+func (d *State) compilerCommand() string {
+	if d.tinygo() {
+		if d.cfg.TinyGo != "" {
+			return d.cfg.TinyGo
+		}
+		return TinyGoCommand
+	}
+	return d.toolchain.Path
+}
+
+// Script returns the runtime script (wasm_exec.js) that matches the compiler. For the go compiler
+// this is read from GOROOT, falling back to the embedded Go 1.11 version if it can't be found.
+func (d *State) Script() (contents, hash []byte, err error) {
+	d.scriptOnce.Do(func() {
+		if d.tinygo() {
+			d.script, d.scriptErr = d.tinygoScript()
+		} else {
+			d.script, d.scriptErr = d.goScript()
+		}
+	})
+	if d.scriptErr != nil {
+		return nil, nil, d.scriptErr
+	}
+	return d.script, sha1sum(d.script), nil
+}
+
+func (d *State) tinygoScript() ([]byte, error) {
+	output, err := exec.Command(d.compilerCommand(), "env", "TINYGOROOT").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, string(output))
+	}
+	return ioutil.ReadFile(filepath.Join(strings.TrimSpace(string(output)), "targets", "wasm_exec.js"))
+}
+
+func (d *State) goScript() ([]byte, error) {
+	goroot := d.toolchain.GOROOT()
+	// wasm_exec.js moved from misc/wasm to lib/wasm in Go 1.24
+	for _, dir := range []string{"lib", "misc"} {
+		fpath := filepath.Join(goroot, dir, "wasm", "wasm_exec.js")
+		contents, err := ioutil.ReadFile(fpath)
+		if err == nil {
+			fmt.Fprintf(d.debug, "Using %s\n", fpath)
+			return contents, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if v := d.toolchain.Version; v.Major != 1 || v.Minor != 11 {
+		fmt.Fprintf(d.debug, "Warning: can't find wasm_exec.js in GOROOT, using the embedded Go 1.11 version, which may not work with %s.\n", v)
+	}
+	return []byte(WasmExec), nil
+}
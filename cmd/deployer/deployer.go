@@ -2,27 +2,23 @@ package deployer
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
 
-	"github.com/dave/jsgo/assets/std"
 	"github.com/dave/jsgo/server/servermsg"
 	"github.com/dave/jsgo/server/wasm/messages"
-	"github.com/dave/services/constor/constormsg"
 	"github.com/dave/wasmgo/cmd/cmdconfig"
-	"github.com/dave/wasmgo/cmd/config"
-	"github.com/gorilla/websocket"
-	"github.com/pkg/browser"
+	"github.com/dave/wasmgo/cmd/toolchain"
 )
 
 const CLIENT_VERSION = "1.0.0"
@@ -31,49 +27,137 @@ func init() {
 	servermsg.RegisterTypes()
 }
 
-func New(cfg *cmdconfig.Config) (*State, error) {
-	sourceDir, err := runGoList(cfg)
-	if err != nil {
+// New creates the state for building and deploying the package specified by cfg. Progress messages
+// are written to stdout if cfg.Verbose is set - use SetDebug to send them elsewhere.
+func New(ctx context.Context, cfg *cmdconfig.Config) (*State, error) {
+	if err := checkCompiler(cfg.Compiler); err != nil {
 		return nil, err
 	}
-	s := &State{cfg: cfg, dir: sourceDir}
+	args, err := cmdconfig.SplitArgs(cfg.Flags)
+	if err != nil {
+		return nil, fmt.Errorf("parsing flags: %v", err)
+	}
+	s := &State{cfg: cfg, buildArgs: append(append([]string{}, cfg.BuildArgs...), args...)}
 	if cfg.Verbose {
 		s.debug = os.Stdout
 	} else {
 		s.debug = ioutil.Discard
 	}
+	tc, err := toolchain.Resolve(cfg.Command, s.debug)
+	if err != nil {
+		return nil, err
+	}
+	s.toolchain = tc
+	sourceDir, err := runGoList(ctx, cfg, tc)
+	if err != nil {
+		return nil, err
+	}
+	s.dir = sourceDir
+	cache, err := NewCache("")
+	if err != nil {
+		return nil, err
+	}
+	s.cache = cache
 	return s, nil
 }
 
 type State struct {
-	cfg   *cmdconfig.Config
-	dir   string
-	debug io.Writer
+	cfg       *cmdconfig.Config
+	dir       string
+	debug     io.Writer
+	cache     *Cache
+	toolchain *toolchain.Toolchain
+	buildArgs []string
+
+	versionOnce sync.Once
+	version     string
+	versionErr  error
+
+	scriptOnce sync.Once
+	script     []byte
+	scriptErr  error
 }
 
-func (d *State) Start() error {
+// SetDebug sets the writer that progress messages are written to.
+func (d *State) SetDebug(w io.Writer) {
+	d.debug = w
+}
 
-	fmt.Fprintln(d.debug, "Compiling...")
+// SetCache sets the cache that binaries are stored in, instead of the one in the user cache
+// directory.
+func (d *State) SetCache(c *Cache) {
+	d.cache = c
+}
+
+// Result describes a successful deploy. Page, Script, Loader, Binary and Split are the URLs of the
+// deployed files. Split is empty if the binary wasn't split.
+type Result struct {
+	Page   string
+	Script string
+	Loader string
+	Binary string
+	Split  string
+	Files  []ResultFile
+}
 
-	binaryBytes, binaryHash, err := d.Build()
+// ResultFile is a file included in the deploy.
+type ResultFile struct {
+	Type messages.DeployFileType
+	Hash string
+	Size int
+	URL  string
+}
+
+// Deploy builds the binary and deploys it to the target, along with the index page, loader and
+// runtime script.
+func (d *State) Deploy(ctx context.Context) (*Result, error) {
+
+	target, err := d.Target()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	files := map[messages.DeployFileType]messages.DeployFile{}
+	fmt.Fprintln(d.debug, "Compiling...")
 
-	files[messages.DeployFileTypeWasm] = messages.DeployFile{
+	binaryBytes, splitBytes, err := d.BuildSplit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	binary := messages.DeployFile{
 		DeployFileKey: messages.DeployFileKey{
 			Type: messages.DeployFileTypeWasm,
-			Hash: fmt.Sprintf("%x", binaryHash),
+			Hash: fmt.Sprintf("%x", sha1sum(binaryBytes)),
 		},
 		Contents: binaryBytes,
 	}
 
-	binaryUrl := fmt.Sprintf("%s://%s/%x.wasm", config.Protocol[config.Pkg], config.Host[config.Pkg], binaryHash)
-	loaderBytes, loaderHash, err := d.Loader(binaryUrl)
+	binaryUrl := target.URL(binary.DeployFileKey)
+
+	files := []messages.DeployFile{binary}
 
-	files[messages.DeployFileTypeLoader] = messages.DeployFile{
+	var split messages.DeployFile
+	var splitUrl string
+	if splitBytes != nil {
+		// the jsgo server only stores the index, loader and wasm types, and the files are named by
+		// their hash, so the secondary module is sent as a wasm file
+		split = messages.DeployFile{
+			DeployFileKey: messages.DeployFileKey{
+				Type: messages.DeployFileTypeWasm,
+				Hash: fmt.Sprintf("%x", sha1sum(splitBytes)),
+			},
+			Contents: splitBytes,
+		}
+		splitUrl = target.URL(split.DeployFileKey)
+		files = append(files, split)
+	}
+
+	loaderBytes, loaderHash, err := d.Loader(binaryUrl, splitUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := messages.DeployFile{
 		DeployFileKey: messages.DeployFileKey{
 			Type: messages.DeployFileTypeLoader,
 			Hash: fmt.Sprintf("%x", loaderHash),
@@ -81,195 +165,132 @@ func (d *State) Start() error {
 		Contents: loaderBytes,
 	}
 
-	loaderUrl := fmt.Sprintf("%s://%s/%x.js", config.Protocol[config.Pkg], config.Host[config.Pkg], loaderHash)
-	scriptUrl := fmt.Sprintf("%s://%s/wasm_exec.%s.js", config.Protocol[config.Pkg], config.Host[config.Pkg], std.Wasm[true])
+	loaderUrl := target.URL(loader.DeployFileKey)
 
-	indexBytes, indexHash, err := d.Index(scriptUrl, loaderUrl, binaryUrl)
+	// deploy the runtime script from the toolchain that compiled the binary
+	scriptBytes, scriptHash, err := d.Script()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	files[messages.DeployFileTypeIndex] = messages.DeployFile{
+	// the jsgo server only stores the index, loader and wasm types, so the script is sent as a
+	// loader, which is stored as <hash>.js on the pkg host
+	script := messages.DeployFile{
 		DeployFileKey: messages.DeployFileKey{
-			Type: messages.DeployFileTypeIndex,
-			Hash: fmt.Sprintf("%x", indexHash),
-		},
-		Contents: indexBytes,
-	}
-
-	indexUrl := fmt.Sprintf("%s://%s/%x", config.Protocol[config.Index], config.Host[config.Index], indexHash)
-
-	message := messages.DeployQuery{
-		Version: CLIENT_VERSION,
-		Files: []messages.DeployFileKey{
-			files[messages.DeployFileTypeWasm].DeployFileKey,
-			files[messages.DeployFileTypeIndex].DeployFileKey,
-			files[messages.DeployFileTypeLoader].DeployFileKey,
+			Type: messages.DeployFileTypeLoader,
+			Hash: fmt.Sprintf("%x", scriptHash),
 		},
+		Contents: scriptBytes,
 	}
 
-	fmt.Fprintln(d.debug, "Querying server...")
+	scriptUrl := target.URL(script.DeployFileKey)
 
-	protocol := "wss"
-	if config.Protocol[config.Wasm] == "http" {
-		protocol = "ws"
-	}
-	conn, _, err := websocket.DefaultDialer.Dial(
-		fmt.Sprintf("%s://%s/_wasm/", protocol, config.Host[config.Wasm]),
-		http.Header{"Origin": []string{fmt.Sprintf("%s://%s/", config.Protocol[config.Wasm], config.Host[config.Wasm])}},
-	)
-	if err != nil {
-		return err
-	}
-
-	messageBytes, messageType, err := messages.Marshal(message)
+	indexBytes, indexHash, err := d.Index(scriptUrl, loaderUrl, binaryUrl)
 	if err != nil {
-		return err
-	}
-	if err := conn.WriteMessage(messageType, messageBytes); err != nil {
-		return err
+		return nil, err
 	}
 
-	var response messages.DeployQueryResponse
-	var done bool
-	for !done {
-		_, replyBytes, err := conn.ReadMessage()
-		if err != nil {
-			return err
-		}
-		message, err := messages.Unmarshal(replyBytes)
-		if err != nil {
-			return err
-		}
-		switch message := message.(type) {
-		case messages.DeployQueryResponse:
-			response = message
-			done = true
-		case servermsg.Queueing:
-			// don't print
-		case servermsg.Error:
-			return errors.New(message.Message)
-		case messages.DeployClientVersionNotSupported:
-			return errors.New("this client version is not supported - try `go get -u github.com/dave/wasmgo`")
-		default:
-			// unexpected
-			fmt.Fprintf(d.debug, "Unexpected message from server: %#v\n", message)
-		}
+	index := messages.DeployFile{
+		DeployFileKey: messages.DeployFileKey{
+			Type: messages.DeployFileTypeIndex,
+			Hash: fmt.Sprintf("%x", indexHash),
+		},
+		Contents: indexBytes,
 	}
 
-	if len(response.Required) > 0 {
-
-		fmt.Fprintf(d.debug, "Files required: %d.\n", len(response.Required))
-		fmt.Fprintln(d.debug, "Bundling required files...")
-
-		var required []messages.DeployFile
-		for _, k := range response.Required {
-			file := files[k.Type]
-			if file.Hash == "" {
-				return errors.New("server requested file not found")
-			}
-			required = append(required, file)
-		}
-
-		payload := messages.DeployPayload{Files: required}
-		payloadBytes, payloadType, err := messages.Marshal(payload)
-		if err != nil {
-			return err
-		}
-		if err := conn.WriteMessage(payloadType, payloadBytes); err != nil {
-			return err
-		}
-
-		fmt.Fprintf(d.debug, "Sending payload: %dKB.\n", len(payloadBytes)/1024)
+	indexUrl := target.URL(index.DeployFileKey)
 
-		done = false
-		for !done {
-			_, replyBytes, err := conn.ReadMessage()
-			if err != nil {
-				return err
-			}
-			message, err := messages.Unmarshal(replyBytes)
-			if err != nil {
-				return err
-			}
-			switch message := message.(type) {
-			case messages.DeployDone:
-				done = true
-			case servermsg.Queueing:
-				// don't print
-			case servermsg.Error:
-				return errors.New(message.Message)
-			case constormsg.Storing:
-				if message.Remain > 0 || message.Finished > 0 {
-					fmt.Fprintf(d.debug, "Storing, %d to go.\n", message.Remain)
-				}
-			default:
-				// unexpected
-				fmt.Fprintf(d.debug, "Unexpected message from server: %#v\n", message)
-			}
-		}
-
-		fmt.Fprintln(d.debug, "Sending done.")
-
-	} else {
-		fmt.Fprintln(d.debug, "No files required.")
+	files = append(files, index, loader, script)
+	if err := target.Deploy(ctx, files); err != nil {
+		return nil, err
 	}
 
-	outputVars := struct{ Page, Script, Loader, Binary string }{
+	result := &Result{
 		Page:   indexUrl,
 		Script: scriptUrl,
 		Loader: loaderUrl,
 		Binary: binaryUrl,
+		Split:  splitUrl,
+		Files: []ResultFile{
+			{Type: index.Type, Hash: index.Hash, Size: len(index.Contents), URL: indexUrl},
+			{Type: script.Type, Hash: script.Hash, Size: len(script.Contents), URL: scriptUrl},
+			{Type: loader.Type, Hash: loader.Hash, Size: len(loader.Contents), URL: loaderUrl},
+			{Type: binary.Type, Hash: binary.Hash, Size: len(binary.Contents), URL: binaryUrl},
+		},
 	}
-
-	if d.cfg.Json {
-		out, err := json.Marshal(outputVars)
-		if err != nil {
-			return err
-		}
-		fmt.Println(string(out))
-	} else {
-		tpl, err := template.New("main").Parse(d.cfg.Template)
-		if err != nil {
-			return err
-		}
-		tpl.Execute(os.Stdout, outputVars)
-		fmt.Println("")
+	if splitBytes != nil {
+		result.Files = append(result.Files, ResultFile{Type: split.Type, Hash: split.Hash, Size: len(split.Contents), URL: splitUrl})
 	}
+	return result, nil
+}
 
-	if d.cfg.Open {
-		browser.OpenURL(indexUrl)
-	}
+// Loader returns the loader for the deployed page. If splitUrl isn't empty, it's the URL of the
+// secondary module, which is loaded after the binary has started.
+func (d *State) Loader(binaryUrl, splitUrl string) (contents, hash []byte, err error) {
+	return d.loader(loaderTemplateMin, binaryUrl, splitUrl, false)
+}
 
-	return nil
+// DevLoader returns the loader used by the serve command. If the binary can't be fetched, it shows
+// the compiler errors in an overlay on the page. When running tests, the test arguments are passed
+// to the binary, and with coverage the profile is sent to the server when the binary exits.
+func (d *State) DevLoader(binaryUrl, splitUrl string) (contents, hash []byte, err error) {
+	return d.loader(loaderTemplate, binaryUrl, splitUrl, true)
 }
 
-func (d *State) Loader(binaryUrl string) (contents, hash []byte, err error) {
+func (d *State) loader(tpl *template.Template, binaryUrl, splitUrl string, dev bool) (contents, hash []byte, err error) {
 	loaderBuf := &bytes.Buffer{}
 	loaderSha := sha1.New()
-	loaderVars := struct{ Binary string }{
+	loaderVars := struct {
+		Binary    string
+		Split     string
+		Dev       bool
+		Args      string
+		CoverDir  string
+		CoverFile string
+	}{
 		Binary: binaryUrl,
+		Split:  splitUrl,
+		Dev:    dev,
 	}
-	if err := loaderTemplateMin.Execute(io.MultiWriter(loaderBuf, loaderSha), loaderVars); err != nil {
+	if dev && len(d.cfg.TestArgs) > 0 {
+		args, err := json.Marshal(d.cfg.TestArgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		loaderVars.Args = string(args)
+	}
+	if dev && d.cover() {
+		loaderVars.CoverDir = CoverDir
+		loaderVars.CoverFile = CoverFile
+	}
+	if err := tpl.Execute(io.MultiWriter(loaderBuf, loaderSha), loaderVars); err != nil {
 		return nil, nil, err
 	}
 	return loaderBuf.Bytes(), loaderSha.Sum(nil), nil
 }
 
 func (d *State) Index(scriptUrl, loaderUrl, binaryUrl string) (contents, hash []byte, err error) {
+	return d.index(scriptUrl, loaderUrl, binaryUrl, "")
+}
+
+// DevIndex returns the index page used by the serve command, which also loads the live reload
+// client from devUrl. The default template includes it with the Dev variable. Custom templates that
+// don't use Dev have the script tag inserted before </body>.
+func (d *State) DevIndex(scriptUrl, loaderUrl, binaryUrl, devUrl string) (contents, hash []byte, err error) {
+	return d.index(scriptUrl, loaderUrl, binaryUrl, devUrl)
+}
+
+func (d *State) index(scriptUrl, loaderUrl, binaryUrl, devUrl string) (contents, hash []byte, err error) {
 	indexBuf := &bytes.Buffer{}
-	indexSha := sha1.New()
-	indexVars := struct{ Script, Loader, Binary string }{
+	indexVars := struct{ Script, Loader, Binary, Dev string }{
 		Script: scriptUrl,
 		Loader: loaderUrl,
 		Binary: binaryUrl,
+		Dev:    devUrl,
 	}
 	indexTemplate := defaultIndexTemplate
-	if d.cfg.Index != "" {
-		indexFilename := d.cfg.Index
-		if d.cfg.Path != "" {
-			indexFilename = filepath.Join(d.dir, d.cfg.Index)
-		}
+	usesDev := true
+	if indexFilename := d.IndexFile(); indexFilename != "" {
 		indexTemplateBytes, err := ioutil.ReadFile(indexFilename)
 		if err != nil && !os.IsNotExist(err) {
 			return nil, nil, err
@@ -279,31 +300,84 @@ func (d *State) Index(scriptUrl, loaderUrl, binaryUrl string) (contents, hash []
 			if err != nil {
 				return nil, nil, err
 			}
+			usesDev = strings.Contains(string(indexTemplateBytes), ".Dev")
 		}
 	}
-	if err := indexTemplate.Execute(io.MultiWriter(indexBuf, indexSha), indexVars); err != nil {
+	if err := indexTemplate.Execute(indexBuf, indexVars); err != nil {
+		return nil, nil, err
+	}
+	contents = indexBuf.Bytes()
+	if devUrl != "" && !usesDev {
+		contents = injectScript(contents, devUrl)
+	}
+	return contents, sha1sum(contents), nil
+}
+
+// injectScript adds a script tag before the closing body tag, or at the end if there isn't one.
+func injectScript(page []byte, url string) []byte {
+	tag := fmt.Sprintf("<script src=%q></script>\n", url)
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i == -1 {
+		return append(page, tag...)
+	}
+	out := make([]byte, 0, len(page)+len(tag))
+	out = append(out, page[:i]...)
+	out = append(out, tag...)
+	return append(out, page[i:]...)
+}
+
+// IndexFile returns the location of the index page template, which may not exist. If no template
+// is configured, it returns an empty string.
+func (d *State) IndexFile() string {
+	if d.cfg.Index == "" {
+		return ""
+	}
+	if d.cfg.Path != "" {
+		return filepath.Join(d.dir, d.cfg.Index)
+	}
+	return d.cfg.Index
+}
+
+// Build returns the compiled WASM binary. The build cache is consulted first, so the go command is
+// only run when the package, its dependencies or the build configuration have changed.
+func (d *State) Build(ctx context.Context) (contents, hash []byte, err error) {
+	key, err := d.CacheKey(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	contents, hash, cached, err := d.cache.Get(ctx, key, d.build)
+	if err != nil {
 		return nil, nil, err
 	}
-	return indexBuf.Bytes(), indexSha.Sum(nil), nil
+	if cached {
+		fmt.Fprintf(d.debug, "Using cached WASM binary with hash %x\n", hash)
+	}
+	return contents, hash, nil
 }
 
-func (d *State) Build() (contents, hash []byte, err error) {
+func (d *State) build(ctx context.Context) ([]byte, error) {
 
 	// create a temp dir
 	tempDir, err := ioutil.TempDir("", "")
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer os.RemoveAll(tempDir)
 
 	fpath := filepath.Join(tempDir, "out.wasm")
 
 	args := []string{"build", "-o", fpath}
-
-	extraFlags := strings.Fields(d.cfg.Flags)
-	for _, f := range extraFlags {
-		args = append(args, f)
+	if d.cfg.Test {
+		args = []string{"test", "-c", "-o", fpath}
+	}
+	if d.cover() {
+		args = append(args, "-cover")
 	}
+	if d.tinygo() {
+		args = append(args, "-target", "wasm")
+	}
+
+	args = append(args, d.buildArgs...)
 
 	if d.cfg.BuildTags != "" {
 		args = append(args, "-tags", d.cfg.BuildTags)
@@ -315,34 +389,47 @@ func (d *State) Build() (contents, hash []byte, err error) {
 	}
 	args = append(args, path)
 
-	cmd := exec.Command(d.cfg.Command, args...)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, "GOARCH=wasm")
-	cmd.Env = append(cmd.Env, "GOOS=js")
+	cmd := exec.CommandContext(ctx, d.compilerCommand(), args...)
+	cmd.Env = buildEnv(d.cfg)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		if strings.Contains(string(output), "unsupported GOOS/GOARCH pair js/wasm") {
-			return nil, nil, errors.New("you need Go v1.11 to compile WASM. It looks like your default `go` command is not v1.11. Perhaps you need the -c flag to specify a custom command name - e.g. `-c=go1.11beta3`")
-		}
-		return nil, nil, fmt.Errorf("%v: %s", err, string(output))
+		return nil, newBuildError(string(output))
+	}
+	if d.cfg.Test && bytes.Contains(output, []byte("[no test files]")) {
+		return nil, ErrNoTestFiles
 	}
 	if len(output) > 0 {
-		return nil, nil, fmt.Errorf("%s", string(output))
+		return nil, fmt.Errorf("%s", string(output))
 	}
 
-	binaryBytes, err := ioutil.ReadFile(fpath)
-	if err != nil {
-		return nil, nil, err
-	}
-	binarySha := sha1.New()
-	if _, err := io.Copy(binarySha, bytes.NewBuffer(binaryBytes)); err != nil {
-		return nil, nil, err
-	}
+	return ioutil.ReadFile(fpath)
+}
 
-	return binaryBytes, binarySha.Sum(nil), nil
+// The test binary can't write to the host filesystem, so with coverage the dev loader gives it an
+// in-memory filesystem and sends the profile to the server. CoverDir and CoverFile are the paths
+// passed to the test binary with -test.gocoverdir and -test.coverprofile.
+const (
+	CoverDir  = "/wasmgo/cover"
+	CoverFile = "/wasmgo/cover.out"
+)
+
+// cover reports whether the binary is a test binary built with coverage.
+func (d *State) cover() bool {
+	return d.cfg.Test && d.cfg.Cover != ""
+}
+
+// BuildArgs returns the arguments passed to the build command: the flags from the project config
+// file followed by the flags from the command line.
+func (d *State) BuildArgs() []string {
+	return d.buildArgs
+}
+
+// Toolchain returns the go toolchain used to build the binary.
+func (d *State) Toolchain() *toolchain.Toolchain {
+	return d.toolchain
 }
 
-func runGoList(cfg *cmdconfig.Config) (string, error) {
+func runGoList(ctx context.Context, cfg *cmdconfig.Config, tc *toolchain.Toolchain) (string, error) {
 	args := []string{"list"}
 
 	if cfg.BuildTags != "" {
@@ -357,16 +444,21 @@ func runGoList(cfg *cmdconfig.Config) (string, error) {
 	}
 	args = append(args, path)
 
-	cmd := exec.Command(cfg.Command, args...)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, "GOARCH=wasm")
-	cmd.Env = append(cmd.Env, "GOOS=js")
+	cmd := exec.CommandContext(ctx, tc.Path, args...)
+	cmd.Env = buildEnv(cfg)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		if strings.Contains(string(output), "unsupported GOOS/GOARCH pair js/wasm") {
-			return "", errors.New("you need Go v1.11 to compile WASM. It looks like your default `go` command is not v1.11. Perhaps you need the -c flag to specify a custom command name - e.g. `-c=go1.11beta3`")
-		}
 		return "", fmt.Errorf("%v: %s", err, string(output))
 	}
-	return string(output), nil
+	return strings.TrimSpace(string(output)), nil
+}
+
+// buildEnv returns the environment for the go command: the current environment with the variables
+// from the project config file added. GOOS and GOARCH are always js and wasm.
+func buildEnv(cfg *cmdconfig.Config) []string {
+	env := os.Environ()
+	env = append(env, cfg.BuildEnv...)
+	env = append(env, "GOARCH=wasm")
+	env = append(env, "GOOS=js")
+	return env
 }
@@ -0,0 +1,80 @@
+package deployer
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a single compiler message parsed from the output of the go command.
+type Diagnostic struct {
+	Package string `json:"package,omitempty"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// BuildError is returned by Build when the go command fails. Output is the raw output of the
+// command, and Diagnostics is the same output parsed into individual messages.
+type BuildError struct {
+	Output      string
+	Diagnostics []Diagnostic
+}
+
+func (e *BuildError) Error() string {
+	return e.Output
+}
+
+// e.g. "./main.go:10:2: undefined: foo" or "main.go:10: undefined: foo"
+var diagnosticRegex = regexp.MustCompile(`^(.+?\.(?:go|s)):(\d+)(?::(\d+))?: (.*)$`)
+
+// ParseDiagnostics parses the output of the go command into diagnostics. Relative file names are
+// resolved against dir, which should be the working directory of the go command.
+func ParseDiagnostics(output, dir string) []Diagnostic {
+	var diagnostics []Diagnostic
+	var pkg string
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			continue
+		case strings.HasPrefix(line, "# "):
+			pkg = strings.TrimPrefix(line, "# ")
+			continue
+		case strings.HasPrefix(line, "\t") && len(diagnostics) > 0:
+			// continuation of the previous message
+			last := &diagnostics[len(diagnostics)-1]
+			last.Message += "\n" + strings.TrimPrefix(line, "\t")
+			continue
+		}
+		matches := diagnosticRegex.FindStringSubmatch(line)
+		if matches == nil {
+			diagnostics = append(diagnostics, Diagnostic{Package: pkg, Message: line})
+			continue
+		}
+		file := matches[1]
+		if !filepath.IsAbs(file) && dir != "" {
+			file = filepath.Join(dir, file)
+		}
+		lineNum, _ := strconv.Atoi(matches[2])
+		column, _ := strconv.Atoi(matches[3])
+		diagnostics = append(diagnostics, Diagnostic{
+			Package: pkg,
+			File:    file,
+			Line:    lineNum,
+			Column:  column,
+			Message: matches[4],
+		})
+	}
+	return diagnostics
+}
+
+func newBuildError(output string) *BuildError {
+	wd, _ := os.Getwd()
+	return &BuildError{
+		Output:      output,
+		Diagnostics: ParseDiagnostics(output, wd),
+	}
+}
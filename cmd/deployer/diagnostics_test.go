@@ -0,0 +1,108 @@
+package deployer
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := map[string]struct {
+		output   string
+		expected []Diagnostic
+	}{
+		"syntax error": {
+			output: "# bad\n./main.go:5:1: syntax error: unexpected }, expected expression\n",
+			expected: []Diagnostic{
+				{Package: "bad", File: "/dir/main.go", Line: 5, Column: 1, Message: "syntax error: unexpected }, expected expression"},
+			},
+		},
+		"type errors": {
+			output: "# bad\n" +
+				"./main.go:6:14: cannot use \"s\" (untyped string constant) as int value in variable declaration\n" +
+				"./main.go:7:2: undefined: foo\n" +
+				"./main.go:8:16: a.B undefined (type int has no field or method B)\n",
+			expected: []Diagnostic{
+				{Package: "bad", File: "/dir/main.go", Line: 6, Column: 14, Message: "cannot use \"s\" (untyped string constant) as int value in variable declaration"},
+				{Package: "bad", File: "/dir/main.go", Line: 7, Column: 2, Message: "undefined: foo"},
+				{Package: "bad", File: "/dir/main.go", Line: 8, Column: 16, Message: "a.B undefined (type int has no field or method B)"},
+			},
+		},
+		"continuation": {
+			output: "# bad\n./main.go:6:2: not enough arguments in call to f\n\thave ()\n\twant (int)\n",
+			expected: []Diagnostic{
+				{Package: "bad", File: "/dir/main.go", Line: 6, Column: 2, Message: "not enough arguments in call to f\nhave ()\nwant (int)"},
+			},
+		},
+		"dependency": {
+			output: "# bad/sub\nsub/sub.go:3:23: cannot use \"x\" (untyped string constant) as int value in return statement\n",
+			expected: []Diagnostic{
+				{Package: "bad/sub", File: "/dir/sub/sub.go", Line: 3, Column: 23, Message: "cannot use \"x\" (untyped string constant) as int value in return statement"},
+			},
+		},
+		"absolute file without column": {
+			output: "/src/main.go:10: undefined: foo\n",
+			expected: []Diagnostic{
+				{File: "/src/main.go", Line: 10, Message: "undefined: foo"},
+			},
+		},
+		"go.mod error": {
+			output: "go: errors parsing go.mod:\ngo.mod:5: syntax error (unterminated block started at /tmp/bad/go.mod:4:1)\n",
+			expected: []Diagnostic{
+				{Message: "go: errors parsing go.mod:"},
+				{Message: "go.mod:5: syntax error (unterminated block started at /tmp/bad/go.mod:4:1)"},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			diagnostics := ParseDiagnostics(test.output, "/dir")
+			if !reflect.DeepEqual(diagnostics, test.expected) {
+				t.Fatalf("got %#v, expected %#v", diagnostics, test.expected)
+			}
+		})
+	}
+}
+
+// TestParseDiagnosticsCompiler checks that the output of the installed go command is still parsed.
+func TestParseDiagnosticsCompiler(t *testing.T) {
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod":  "module bad\n\ngo 1.21\n",
+		"main.go": "package main\n\nfunc f(int) {}\n\nfunc main() {\n\tf()\n}\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(gocmd, "build", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm", "GOFLAGS=", "GOTOOLCHAIN=local")
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatal("expected build to fail")
+	}
+	diagnostics := ParseDiagnostics(string(output), dir)
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %#v", diagnostics)
+	}
+	d := diagnostics[0]
+	if d.Package != "bad" || d.File != filepath.Join(dir, "main.go") || d.Line != 6 || d.Column != 2 {
+		t.Fatalf("unexpected diagnostic %#v", d)
+	}
+	if expected := "not enough arguments in call to f\nhave ()\nwant (int)"; d.Message != expected {
+		t.Fatalf("got message %q, expected %q", d.Message, expected)
+	}
+}
@@ -0,0 +1,21 @@
+package deployer
+
+import "errors"
+
+// ErrClientVersionNotSupported is returned by Deploy when the jsgo.io server doesn't support this
+// version of wasmgo.
+var ErrClientVersionNotSupported = errors.New("this client version is not supported - try `go get -u github.com/dave/wasmgo`")
+
+// ErrNoTestFiles is returned by Build when building a test binary for a package without tests.
+var ErrNoTestFiles = errors.New("no test files")
+
+// ServerError is an error reported by the server during a deploy. StatusCode is the HTTP status
+// code, for targets that use HTTP requests.
+type ServerError struct {
+	Message    string
+	StatusCode int
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
+}
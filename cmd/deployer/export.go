@@ -0,0 +1,156 @@
+package deployer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExportFile is a file in a static site produced by Export.
+type ExportFile struct {
+	Name     string
+	Contents []byte
+}
+
+// Export builds the binary and returns the files needed to host the page on any static web
+// server: index.html, and the content-hashed binary, loader and runtime script, plus the secondary
+// module if the binary is split. The URLs in the index page and loader are prefixed by baseUrl,
+// which may be empty to use relative URLs.
+func (d *State) Export(ctx context.Context, baseUrl string) ([]ExportFile, error) {
+
+	fmt.Fprintln(d.debug, "Compiling...")
+
+	binaryBytes, splitBytes, err := d.BuildSplit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	binaryName := fmt.Sprintf("%x.wasm", sha1sum(binaryBytes))
+
+	var splitName, splitUrl string
+	if splitBytes != nil {
+		splitName = fmt.Sprintf("%x.wasm", sha1sum(splitBytes))
+		splitUrl = exportUrl(baseUrl, splitName)
+	}
+
+	loaderBytes, loaderHash, err := d.Loader(exportUrl(baseUrl, binaryName), splitUrl)
+	if err != nil {
+		return nil, err
+	}
+	loaderName := fmt.Sprintf("loader.%x.js", loaderHash)
+
+	scriptBytes, scriptHash, err := d.Script()
+	if err != nil {
+		return nil, err
+	}
+	scriptName := fmt.Sprintf("wasm_exec.%x.js", scriptHash)
+
+	indexBytes, _, err := d.Index(exportUrl(baseUrl, scriptName), exportUrl(baseUrl, loaderName), exportUrl(baseUrl, binaryName))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []ExportFile{
+		{Name: "index.html", Contents: indexBytes},
+		{Name: binaryName, Contents: binaryBytes},
+		{Name: loaderName, Contents: loaderBytes},
+		{Name: scriptName, Contents: scriptBytes},
+	}
+	if splitBytes != nil {
+		files = append(files, ExportFile{Name: splitName, Contents: splitBytes})
+	}
+	return files, nil
+}
+
+func exportUrl(baseUrl, name string) string {
+	if baseUrl == "" {
+		return name
+	}
+	return strings.TrimSuffix(baseUrl, "/") + "/" + name
+}
+
+// WriteDir writes files to dir, creating it if needed.
+func WriteDir(dir string, files []ExportFile) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f.Name), f.Contents, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteArchive writes files to an archive. The format is chosen by the extension of fpath: .zip,
+// .tar, .tar.gz or .tgz.
+func WriteArchive(fpath string, files []ExportFile) error {
+	var write func(w io.Writer, files []ExportFile) error
+	switch {
+	case strings.HasSuffix(fpath, ".zip"):
+		write = writeZip
+	case strings.HasSuffix(fpath, ".tar"):
+		write = writeTar
+	case strings.HasSuffix(fpath, ".tar.gz"), strings.HasSuffix(fpath, ".tgz"):
+		write = writeTarGz
+	default:
+		return fmt.Errorf("unsupported archive format %q - should be .zip, .tar, .tar.gz or .tgz", filepath.Base(fpath))
+	}
+	f, err := os.Create(fpath)
+	if err != nil {
+		return err
+	}
+	if err := write(f, files); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeZip(w io.Writer, files []ExportFile) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.Contents); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTar(w io.Writer, files []ExportFile) error {
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		header := &tar.Header{
+			Name:    f.Name,
+			Mode:    0644,
+			Size:    int64(len(f.Contents)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Contents); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeTarGz(w io.Writer, files []ExportFile) error {
+	gw := gzip.NewWriter(w)
+	if err := writeTar(gw, files); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,55 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dave/wasmgo/cmd/splitter"
+)
+
+// SplitRuntime is the value of the split flag that moves the runtime to the secondary module,
+// instead of a list of packages.
+const SplitRuntime = "runtime"
+
+// BuildSplit returns the compiled binary, split by the split flag. If the flag isn't set or no
+// functions match, secondary is nil.
+func (d *State) BuildSplit(ctx context.Context) (primary, secondary []byte, err error) {
+	contents, _, err := d.Build(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d.Split(contents)
+}
+
+// Split moves the functions selected by the split flag to a secondary module, which the loader
+// fetches after the binary has started, or when one of the functions is first called. If the flag
+// isn't set or no functions match, the binary is returned unchanged and secondary is nil.
+func (d *State) Split(binary []byte) (primary, secondary []byte, err error) {
+	if d.cfg.Split == "" {
+		return binary, nil, nil
+	}
+	if d.tinygo() {
+		return nil, nil, fmt.Errorf("the split flag isn't supported by the %s compiler", CompilerTinyGo)
+	}
+	prefixes := splitter.RuntimePrefixes
+	if d.cfg.Split != SplitRuntime {
+		var packages []string
+		for _, p := range strings.Split(d.cfg.Split, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				packages = append(packages, p)
+			}
+		}
+		prefixes = splitter.PackagePrefixes(packages)
+	}
+	primary, secondary, err = splitter.Split(binary, prefixes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("splitting binary: %v", err)
+	}
+	if secondary == nil {
+		fmt.Fprintf(d.debug, "No functions match %q, so the binary isn't split\n", d.cfg.Split)
+	} else {
+		fmt.Fprintf(d.debug, "Split binary into %d and %d bytes\n", len(primary), len(secondary))
+	}
+	return primary, secondary, nil
+}
@@ -0,0 +1,108 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/jsgo/server/wasm/messages"
+	"github.com/dave/wasmgo/cmd/cmdconfig"
+	"github.com/dave/wasmgo/cmd/config"
+)
+
+const (
+	TargetJsgo = "jsgo"
+	TargetDir  = "dir"
+	TargetS3   = "s3"
+	TargetHttp = "http"
+)
+
+// Deployer uploads content-hashed files to a host. Files are named by the hash of their contents,
+// so a file that's already on the host doesn't need to be uploaded again.
+type Deployer interface {
+	// URL returns the public URL the file will be served from once deployed.
+	URL(key messages.DeployFileKey) string
+	// Deploy uploads any files that the host doesn't already have.
+	Deploy(ctx context.Context, files []messages.DeployFile) error
+}
+
+// Target returns the Deployer selected by the target flag.
+func (d *State) Target() (Deployer, error) {
+	switch d.cfg.Target {
+	case "", TargetJsgo:
+		endpoints, err := d.Endpoints()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(d.debug, "Using %s endpoint set (%s)\n", endpoints.Set, endpoints.SetSource)
+		return &jsgoTarget{endpoints: endpoints, debug: d.debug}, nil
+	case TargetDir:
+		if d.cfg.TargetUrl == "" {
+			return nil, fmt.Errorf("the %s target needs a directory - use the --target-url flag", TargetDir)
+		}
+		dir, err := filepath.Abs(d.cfg.TargetUrl)
+		if err != nil {
+			return nil, err
+		}
+		publicUrl := d.cfg.PublicUrl
+		if publicUrl == "" {
+			publicUrl = "file://" + filepath.ToSlash(dir)
+		}
+		return &dirTarget{dir: dir, publicUrl: publicUrl, debug: d.debug}, nil
+	case TargetS3:
+		return newS3Target(d.cfg.TargetUrl, d.cfg.PublicUrl, d.debug)
+	case TargetHttp:
+		return newHttpTarget(d.cfg.TargetUrl, d.cfg.PublicUrl, d.debug)
+	}
+	return nil, fmt.Errorf("unknown target %q - should be %s, %s, %s or %s", d.cfg.Target, TargetJsgo, TargetDir, TargetS3, TargetHttp)
+}
+
+// Endpoints returns the jsgo endpoints configured by the endpoint flags, the WASMGO_* environment
+// variables and the config file.
+func (d *State) Endpoints() (*config.Endpoints, error) {
+	return LoadEndpoints(d.cfg)
+}
+
+// LoadEndpoints returns the jsgo endpoints configured by cfg, the WASMGO_* environment variables
+// and the config file. The endpoint flags may have been set by the project config file, which is
+// reported as their source.
+func LoadEndpoints(cfg *cmdconfig.Config) (*config.Endpoints, error) {
+	flags := config.Endpoints{Wasm: cfg.WasmUrl, Pkg: cfg.PkgUrl, Index: cfg.IndexUrl, Sources: map[string]string{}}
+	if cfg.Defaulted["endpoints"] {
+		flags.SetSource = cfg.Project
+	}
+	for host, name := range map[string]string{config.Wasm: "wasm-url", config.Pkg: "pkg-url", config.Index: "index-url"} {
+		if cfg.Defaulted[name] {
+			flags.Sources[host] = cfg.Project
+		}
+	}
+	return config.Load(cfg.Endpoints, flags)
+}
+
+// fileName is the name of the file on hosts other than jsgo.io.
+func fileName(key messages.DeployFileKey) string {
+	switch key.Type {
+	case messages.DeployFileTypeIndex:
+		return key.Hash + ".html"
+	case messages.DeployFileTypeWasm:
+		return key.Hash + ".wasm"
+	default:
+		return key.Hash + ".js"
+	}
+}
+
+func contentType(key messages.DeployFileKey) string {
+	switch key.Type {
+	case messages.DeployFileTypeIndex:
+		return "text/html; charset=utf-8"
+	case messages.DeployFileTypeWasm:
+		return "application/wasm"
+	default:
+		return "application/javascript"
+	}
+}
+
+func joinUrl(base, name string) string {
+	return strings.TrimSuffix(base, "/") + "/" + name
+}
@@ -0,0 +1,45 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dave/jsgo/server/wasm/messages"
+)
+
+// dirTarget deploys to a local directory, e.g. one that's served by a web server or synced to a
+// CDN.
+type dirTarget struct {
+	dir       string
+	publicUrl string
+	debug     io.Writer
+}
+
+func (t *dirTarget) URL(key messages.DeployFileKey) string {
+	return joinUrl(t.publicUrl, fileName(key))
+}
+
+func (t *dirTarget) Deploy(ctx context.Context, files []messages.DeployFile) error {
+	if err := os.MkdirAll(t.dir, 0777); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fpath := filepath.Join(t.dir, fileName(file.DeployFileKey))
+		if _, err := os.Stat(fpath); err == nil {
+			fmt.Fprintf(t.debug, "%s already exists.\n", fpath)
+			continue
+		}
+		fmt.Fprintf(t.debug, "Writing %s.\n", fpath)
+		if err := ioutil.WriteFile(fpath, file.Contents, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
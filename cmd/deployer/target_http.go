@@ -0,0 +1,104 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/dave/jsgo/server/wasm/messages"
+)
+
+// httpTarget deploys with plain HTTP PUT requests, which works with WebDAV servers. Credentials
+// for basic auth may be included in the URL.
+type httpTarget struct {
+	base      *url.URL
+	publicUrl string
+	debug     io.Writer
+}
+
+func newHttpTarget(targetUrl, publicUrl string, debug io.Writer) (*httpTarget, error) {
+	if targetUrl == "" {
+		return nil, fmt.Errorf("the %s target needs a URL - use the --target-url flag", TargetHttp)
+	}
+	base, err := url.Parse(targetUrl)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("the %s target URL should start with http:// or https://", TargetHttp)
+	}
+	if publicUrl == "" {
+		public := *base
+		public.User = nil
+		publicUrl = public.String()
+	}
+	return &httpTarget{base: base, publicUrl: publicUrl, debug: debug}, nil
+}
+
+func (t *httpTarget) URL(key messages.DeployFileKey) string {
+	return joinUrl(t.publicUrl, fileName(key))
+}
+
+func (t *httpTarget) Deploy(ctx context.Context, files []messages.DeployFile) error {
+	for _, file := range files {
+		if err := t.put(ctx, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *httpTarget) put(ctx context.Context, file messages.DeployFile) error {
+	u := *t.base
+	u.User = nil
+	fileUrl := joinUrl(u.String(), fileName(file.DeployFileKey))
+
+	head, err := t.request(ctx, http.MethodHead, fileUrl, nil)
+	if err != nil {
+		return err
+	}
+	head.Body.Close()
+	if head.StatusCode == http.StatusOK {
+		fmt.Fprintf(t.debug, "%s already exists.\n", fileUrl)
+		return nil
+	}
+
+	fmt.Fprintf(t.debug, "Uploading %s.\n", fileUrl)
+	resp, err := t.request(ctx, http.MethodPut, fileUrl, &file)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &ServerError{
+			Message:    fmt.Sprintf("uploading %s: %s: %s", fileUrl, resp.Status, string(body)),
+			StatusCode: resp.StatusCode,
+		}
+	}
+	return nil
+}
+
+// request sends a request for fileUrl, with file as the body if it's not nil.
+func (t *httpTarget) request(ctx context.Context, method, fileUrl string, file *messages.DeployFile) (*http.Response, error) {
+	var body io.Reader
+	if file != nil {
+		body = bytes.NewReader(file.Contents)
+	}
+	req, err := http.NewRequest(method, fileUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		req.Header.Set("Content-Type", contentType(file.DeployFileKey))
+	}
+	if t.base.User != nil {
+		password, _ := t.base.User.Password()
+		req.SetBasicAuth(t.base.User.Username(), password)
+	}
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
@@ -0,0 +1,170 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dave/jsgo/server/servermsg"
+	"github.com/dave/jsgo/server/wasm/messages"
+	"github.com/dave/services/constor/constormsg"
+	"github.com/dave/wasmgo/cmd/config"
+	"github.com/gorilla/websocket"
+)
+
+// jsgoTarget deploys to the jsgo.io CDN using the jsgo websocket protocol.
+type jsgoTarget struct {
+	endpoints *config.Endpoints
+	debug     io.Writer
+}
+
+func (t *jsgoTarget) URL(key messages.DeployFileKey) string {
+	switch key.Type {
+	case messages.DeployFileTypeIndex:
+		return t.endpoints.URL(config.Index, key.Hash)
+	case messages.DeployFileTypeWasm:
+		return t.endpoints.URL(config.Pkg, key.Hash+".wasm")
+	default:
+		return t.endpoints.URL(config.Pkg, key.Hash+".js")
+	}
+}
+
+func (t *jsgoTarget) Deploy(ctx context.Context, files []messages.DeployFile) error {
+
+	// several files can have the same type, e.g. the loader and the runtime script
+	byKey := map[messages.DeployFileKey]messages.DeployFile{}
+	message := messages.DeployQuery{Version: CLIENT_VERSION}
+	for _, file := range files {
+		byKey[file.DeployFileKey] = file
+		message.Files = append(message.Files, file.DeployFileKey)
+	}
+
+	fmt.Fprintln(t.debug, "Querying server...")
+
+	// endpoints are validated as http or https URLs when they're loaded
+	wasmUrl := t.endpoints.URL(config.Wasm, "_wasm/")
+	socketUrl := "ws" + strings.TrimPrefix(wasmUrl, "http")
+	conn, _, err := websocket.DefaultDialer.DialContext(
+		ctx,
+		socketUrl,
+		http.Header{"Origin": []string{t.endpoints.URL(config.Wasm, "")}},
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// closing the connection unblocks any pending reads when the context is cancelled
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-finished:
+		}
+	}()
+
+	messageBytes, messageType, err := messages.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if err := conn.WriteMessage(messageType, messageBytes); err != nil {
+		return err
+	}
+
+	var response messages.DeployQueryResponse
+	var done bool
+	for !done {
+		_, replyBytes, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		message, err := messages.Unmarshal(replyBytes)
+		if err != nil {
+			return err
+		}
+		switch message := message.(type) {
+		case messages.DeployQueryResponse:
+			response = message
+			done = true
+		case servermsg.Queueing:
+			// don't print
+		case servermsg.Error:
+			return &ServerError{Message: message.Message}
+		case messages.DeployClientVersionNotSupported:
+			return ErrClientVersionNotSupported
+		default:
+			// unexpected
+			fmt.Fprintf(t.debug, "Unexpected message from server: %#v\n", message)
+		}
+	}
+
+	if len(response.Required) > 0 {
+
+		fmt.Fprintf(t.debug, "Files required: %d.\n", len(response.Required))
+		fmt.Fprintln(t.debug, "Bundling required files...")
+
+		var required []messages.DeployFile
+		for _, k := range response.Required {
+			file, ok := byKey[k]
+			if !ok {
+				return &ServerError{Message: fmt.Sprintf("server requested unknown %s file %s", k.Type, k.Hash)}
+			}
+			required = append(required, file)
+		}
+
+		payload := messages.DeployPayload{Files: required}
+		payloadBytes, payloadType, err := messages.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if err := conn.WriteMessage(payloadType, payloadBytes); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(t.debug, "Sending payload: %dKB.\n", len(payloadBytes)/1024)
+
+		done = false
+		for !done {
+			_, replyBytes, err := conn.ReadMessage()
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return err
+			}
+			message, err := messages.Unmarshal(replyBytes)
+			if err != nil {
+				return err
+			}
+			switch message := message.(type) {
+			case messages.DeployDone:
+				done = true
+			case servermsg.Queueing:
+				// don't print
+			case servermsg.Error:
+				return &ServerError{Message: message.Message}
+			case constormsg.Storing:
+				if message.Remain > 0 || message.Finished > 0 {
+					fmt.Fprintf(t.debug, "Storing, %d to go.\n", message.Remain)
+				}
+			default:
+				// unexpected
+				fmt.Fprintf(t.debug, "Unexpected message from server: %#v\n", message)
+			}
+		}
+
+		fmt.Fprintln(t.debug, "Sending done.")
+
+	} else {
+		fmt.Fprintln(t.debug, "No files required.")
+	}
+
+	return nil
+}
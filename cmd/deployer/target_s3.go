@@ -0,0 +1,235 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dave/jsgo/server/wasm/messages"
+)
+
+// s3Target deploys to an S3 compatible endpoint. The target URL is the endpoint and bucket in path
+// style, with an optional prefix - e.g. https://s3.eu-west-1.amazonaws.com/bucket/prefix. Requests
+// are signed with AWS signature version 4, using credentials from the standard AWS environment
+// variables.
+type s3Target struct {
+	base      *url.URL
+	publicUrl string
+	region    string
+	keyId     string
+	secret    string
+	token     string
+	debug     io.Writer
+}
+
+func newS3Target(targetUrl, publicUrl string, debug io.Writer) (*s3Target, error) {
+	if targetUrl == "" {
+		return nil, fmt.Errorf("the %s target needs the endpoint and bucket URL - use the --target-url flag", TargetS3)
+	}
+	base, err := url.Parse(targetUrl)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("the %s target URL should start with http:// or https://", TargetS3)
+	}
+	t := &s3Target{
+		base:      base,
+		publicUrl: publicUrl,
+		region:    os.Getenv("AWS_REGION"),
+		keyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		debug:     debug,
+	}
+	if t.region == "" {
+		t.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if t.region == "" {
+		t.region = "us-east-1"
+	}
+	if t.keyId == "" || t.secret == "" {
+		return nil, fmt.Errorf("the %s target needs the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables", TargetS3)
+	}
+	if t.publicUrl == "" {
+		t.publicUrl = base.String()
+	}
+	return t, nil
+}
+
+func (t *s3Target) URL(key messages.DeployFileKey) string {
+	return joinUrl(t.publicUrl, fileName(key))
+}
+
+func (t *s3Target) Deploy(ctx context.Context, files []messages.DeployFile) error {
+	for _, file := range files {
+		if err := t.put(ctx, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *s3Target) put(ctx context.Context, file messages.DeployFile) error {
+	fileUrl := joinUrl(t.base.String(), fileName(file.DeployFileKey))
+
+	head, err := t.request(ctx, http.MethodHead, fileUrl, nil)
+	if err != nil {
+		return err
+	}
+	head.Body.Close()
+	if head.StatusCode == http.StatusOK {
+		fmt.Fprintf(t.debug, "%s already exists.\n", fileUrl)
+		return nil
+	}
+
+	fmt.Fprintf(t.debug, "Uploading %s.\n", fileUrl)
+	resp, err := t.request(ctx, http.MethodPut, fileUrl, &file)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &ServerError{
+			Message:    fmt.Sprintf("uploading %s: %s: %s", fileUrl, resp.Status, string(body)),
+			StatusCode: resp.StatusCode,
+		}
+	}
+	return nil
+}
+
+// request sends a signed request for fileUrl, with file as the body if it's not nil.
+func (t *s3Target) request(ctx context.Context, method, fileUrl string, file *messages.DeployFile) (*http.Response, error) {
+	var contents []byte
+	if file != nil {
+		contents = file.Contents
+	}
+	req, err := http.NewRequest(method, fileUrl, bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		req.Header.Set("Content-Type", contentType(file.DeployFileKey))
+		// files are named by the hash of their contents, so they never change
+		req.Header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	t.sign(req, contents, time.Now().UTC())
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+// sign adds AWS signature version 4 headers to the request. Every header of the request is signed,
+// along with the host.
+func (t *s3Target) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if t.token != "" {
+		req.Header.Set("X-Amz-Security-Token", t.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); lower != "authorization" {
+			var trimmed []string
+			for _, v := range values {
+				trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+			}
+			headers[lower] = strings.Join(trimmed, ",")
+		}
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, true),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, t.region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+t.secret), date)
+	key = hmacSha256(key, t.region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.keyId, scope, signedHeaders, signature,
+	))
+}
+
+// canonicalQuery returns the query sorted by name and value, escaped with awsEscape.
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, awsEscape(name, false)+"="+awsEscape(v, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape escapes everything but unreserved characters (and slashes in paths), as signature
+// version 4 requires. Unlike url.PathEscape and url.QueryEscape, characters like $ and spaces are
+// escaped as %XX.
+func awsEscape(s string, path bool) string {
+	if path && s == "" {
+		return "/"
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || path && c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
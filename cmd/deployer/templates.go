@@ -7,6 +7,9 @@ var defaultIndexTemplate = template.Must(template.New("main").Parse(`<html>
 <body>
 	<script src="{{ .Script }}"></script>
 	<script src="{{ .Loader }}"></script>
+	{{- if .Dev }}
+	<script src="{{ .Dev }}"></script>
+	{{- end }}
 </body>
 </html>`))
 
@@ -16,9 +19,408 @@ var loaderTemplate = template.Must(template.New("main").Parse(`if (!WebAssembly.
 		return await WebAssembly.instantiate(source, importObject);
 	};
 }
+{{ if .Dev -}}
+{{ if .Split -}}
+{{ template "lazyLoad" }}
+{{ end -}}
+let go = new Go();
+{{- if .Args }}
+go.argv = go.argv.concat({{ .Args }});
+{{- end }}
+const showErrors = data => {
+	const overlay = document.createElement("div");
+	overlay.id = "wasmgo-errors";
+	overlay.style.cssText = "position:fixed;top:0;left:0;right:0;bottom:0;z-index:2147483647;overflow:auto;margin:0;padding:2em;background:rgba(0,0,0,0.85);color:#e8e8e8;font:14px/1.5 monospace;";
+	const title = document.createElement("h2");
+	title.style.cssText = "color:#ff5555;margin-top:0;";
+	title.textContent = "Build failed";
+	overlay.appendChild(title);
+	(data.diagnostics || []).forEach(d => {
+		const item = document.createElement("pre");
+		item.style.cssText = "white-space:pre-wrap;margin:0 0 1em 0;";
+		const location = d.file ? d.file + ":" + d.line + (d.column ? ":" + d.column : "") + ": " : "";
+		item.textContent = location + d.message;
+		overlay.appendChild(item);
+	});
+	const existing = document.getElementById("wasmgo-errors");
+	if (existing) {
+		existing.remove();
+	}
+	document.body.appendChild(overlay);
+};
+const binaryUrl = new URL("{{ .Binary }}", location.href);
+// hash of the running binary, which the server uses to symbolicate forwarded stack traces
+let loadedHash = "";
+// forward console output, Go stdout and stderr, uncaught errors and the exit code to the terminal
+// running the server, for devices without devtools
+const forward = (() => {
+	const url = new URL("/_wasmgo/console", binaryUrl);
+	url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+	let socket = null;
+	let queue = [];
+	const connect = () => {
+		socket = new WebSocket(url);
+		socket.onopen = () => {
+			queue.forEach(data => socket.send(data));
+			queue = [];
+		};
+		socket.onclose = () => {
+			socket = null;
+			setTimeout(connect, 1000);
+		};
+	};
+	connect();
+	return message => {
+		message.hash = loadedHash;
+		const data = JSON.stringify(message);
+		if (socket && socket.readyState === WebSocket.OPEN) {
+			socket.send(data);
+		} else if (queue.length < 1000) {
+			queue.push(data);
+		}
+	};
+})();
+// forwarding is set while Go output is being written, so it isn't also forwarded as console output
+let forwarding = false;
+const format = arg => {
+	if (typeof arg === "string") {
+		return arg;
+	}
+	if (arg instanceof Error) {
+		return arg.stack || String(arg);
+	}
+	try {
+		return JSON.stringify(arg);
+	} catch (e) {
+		return String(arg);
+	}
+};
+["log", "info", "warn", "error", "debug"].forEach(level => {
+	const original = console[level];
+	console[level] = (...args) => {
+		if (!forwarding) {
+			forward({type: "console", level: level, text: args.map(format).join(" ")});
+		}
+		original.apply(console, args);
+	};
+});
+const decoders = {};
+const writeSync = fs.writeSync;
+fs.writeSync = function(fd, buf) {
+	decoders[fd] = decoders[fd] || new TextDecoder("utf-8");
+	forward({type: "output", fd: fd, text: decoders[fd].decode(buf, {stream: true})});
+	forwarding = true;
+	try {
+		return writeSync.apply(this, arguments);
+	} finally {
+		forwarding = false;
+	}
+};
+{{- if .CoverFile }}
+// the test binary writes coverage data to an in-memory filesystem under /wasmgo, and the profile is
+// sent to the server when it exits
+const memfs = (() => {
+	const entries = {"/wasmgo": {dir: true, mtime: Date.now()}, "{{ .CoverDir }}": {dir: true, mtime: Date.now()}};
+	const files = {};
+	let nextFd = 100;
+	const errorCode = code => {
+		const err = new Error(code);
+		err.code = code;
+		return err;
+	};
+	const parent = path => path.slice(0, path.lastIndexOf("/"));
+	const virtual = path => path.startsWith("/wasmgo/") || path === "/wasmgo";
+	const stat = entry => ({
+		dev: 0, ino: 0, nlink: 1, uid: 0, gid: 0, rdev: 0, blksize: 4096, blocks: 0,
+		mode: entry.dir ? 0o40755 : 0o100644,
+		size: entry.dir ? 0 : entry.data.length,
+		atimeMs: entry.mtime, mtimeMs: entry.mtime, ctimeMs: entry.mtime,
+		isDirectory: () => !!entry.dir,
+	});
+	const resize = (entry, size) => {
+		const data = new Uint8Array(size);
+		data.set(entry.data.subarray(0, size));
+		entry.data = data;
+	};
+	// the go runtime reads the flags from fs.constants, so they must be set before it's run
+	const c = fs.constants = {O_WRONLY: 1, O_RDWR: 2, O_CREAT: 64, O_EXCL: 128, O_TRUNC: 512, O_APPEND: 1024, O_DIRECTORY: 65536};
+	// coverage files are named with the process id, which must not be negative
+	process.pid = 1;
+	const byPath = (name, fn) => {
+		const original = fs[name];
+		fs[name] = function(path, ...args) {
+			if (!virtual(path)) {
+				return original.apply(this, arguments);
+			}
+			const callback = args.pop();
+			try {
+				callback(null, fn(path, ...args));
+			} catch (err) {
+				callback(err);
+			}
+		};
+	};
+	const byFd = (name, fn) => {
+		const original = fs[name];
+		fs[name] = function(fd, ...args) {
+			if (!files[fd]) {
+				return original.apply(this, arguments);
+			}
+			const callback = args.pop();
+			try {
+				callback(null, fn(files[fd], ...args));
+			} catch (err) {
+				callback(err);
+			}
+		};
+	};
+	const lookup = path => {
+		if (!entries[path]) {
+			throw errorCode("ENOENT");
+		}
+		return entries[path];
+	};
+	byPath("open", (path, flags) => {
+		let entry = entries[path];
+		if (entry && flags & c.O_CREAT && flags & c.O_EXCL) {
+			throw errorCode("EEXIST");
+		}
+		if (!entry) {
+			if (!(flags & c.O_CREAT)) {
+				throw errorCode("ENOENT");
+			}
+			if (!(entries[parent(path)] || {}).dir) {
+				throw errorCode("ENOENT");
+			}
+			entry = entries[path] = {data: new Uint8Array(0), mtime: Date.now()};
+		}
+		if (flags & c.O_TRUNC && !entry.dir) {
+			entry.data = new Uint8Array(0);
+		}
+		const fd = nextFd++;
+		files[fd] = {entry: entry, pos: 0, append: !!(flags & c.O_APPEND)};
+		return fd;
+	});
+	byPath("stat", path => stat(lookup(path)));
+	byPath("lstat", path => stat(lookup(path)));
+	byPath("mkdir", path => {
+		if (entries[path]) {
+			throw errorCode("EEXIST");
+		}
+		lookup(parent(path));
+		entries[path] = {dir: true, mtime: Date.now()};
+	});
+	byPath("readdir", path => Object.keys(entries).filter(name => parent(name) === path).map(name => name.slice(path.length + 1)));
+	byPath("rename", (from, to) => {
+		entries[to] = lookup(from);
+		delete entries[from];
+	});
+	byPath("unlink", path => {
+		lookup(path);
+		delete entries[path];
+	});
+	byPath("rmdir", path => {
+		lookup(path);
+		delete entries[path];
+	});
+	const close = fs.close;
+	fs.close = function(fd, callback) {
+		if (!files[fd]) {
+			return close.apply(this, arguments);
+		}
+		delete files[fd];
+		callback(null);
+	};
+	byFd("fstat", file => stat(file.entry));
+	byFd("ftruncate", (file, length) => resize(file.entry, length));
+	byFd("read", (file, buffer, offset, length, position) => {
+		const data = file.entry.data;
+		const start = position === null ? file.pos : position;
+		const n = Math.max(0, Math.min(length, data.length - start));
+		buffer.set(data.subarray(start, start + n), offset);
+		if (position === null) {
+			file.pos += n;
+		}
+		return n;
+	});
+	byFd("write", (file, buffer, offset, length, position) => {
+		const entry = file.entry;
+		const start = position !== null ? position : file.append ? entry.data.length : file.pos;
+		if (start + length > entry.data.length) {
+			resize(entry, start + length);
+		}
+		entry.data.set(buffer.subarray(offset, offset + length), start);
+		entry.mtime = Date.now();
+		if (position === null) {
+			file.pos = start + length;
+		}
+		return length;
+	});
+	return {
+		read: path => entries[path] && !entries[path].dir ? new TextDecoder("utf-8").decode(entries[path].data) : "",
+	};
+})();
+{{- end }}
+const hookExit = instance => {
+	const exit = instance.exit;
+	instance.exit = code => {
+		{{- if .CoverFile }}
+		forward({type: "coverage", text: memfs.read("{{ .CoverFile }}")});
+		{{- end }}
+		forward({type: "exit", code: code});
+		forwarding = true;
+		try {
+			exit.call(instance, code);
+		} finally {
+			forwarding = false;
+		}
+	};
+};
+hookExit(go);
+window.addEventListener("error", event => {
+	forward({type: "error", text: event.error ? format(event.error) : event.message});
+});
+window.addEventListener("unhandledrejection", event => {
+	forward({type: "error", text: format(event.reason)});
+});
+const showStatus = status => {
+	let badge = document.getElementById("wasmgo-status");
+	let text = "";
+	let color = "";
+	if (status.building) {
+		text = "Rebuilding...";
+		color = "#b58900";
+	} else if (status.failed) {
+		text = "Build failed - click for details";
+		color = "#dc322f";
+	} else if (loadedHash && status.hash && status.hash !== loadedHash) {
+		text = "New build ready - refresh to load";
+		color = "#268bd2";
+	}
+	if (!text) {
+		if (badge) {
+			badge.remove();
+		}
+		return;
+	}
+	if (!badge) {
+		badge = document.createElement("div");
+		badge.id = "wasmgo-status";
+		badge.onclick = () => fetch(new URL("errors.json", binaryUrl)).then(resp => resp.json()).then(data => {
+			if (data.diagnostics.length) {
+				showErrors(data);
+			}
+		});
+		document.body.appendChild(badge);
+	}
+	badge.style.cssText = "position:fixed;bottom:1em;right:1em;z-index:2147483647;padding:0.5em 1em;border-radius:4px;color:#fff;font:12px/1.5 sans-serif;cursor:pointer;background:" + color + ";";
+	badge.textContent = text;
+};
+const pollStatus = () => {
+	fetch(new URL("status.json", binaryUrl)).then(resp => resp.json()).then(showStatus).catch(() => {}).then(() => setTimeout(pollStatus, 1000));
+};
+// hot restart: hooks registered with wasmgo.onRestart clean up the DOM and event listeners of the
+// running program before it's stopped and the new binary is run.
+const wasmgo = window.wasmgo = window.wasmgo || {};
+let restartHooks = [];
+wasmgo.onRestart = fn => {
+	restartHooks.push(fn);
+};
+wasmgo.restart = (source, hash) => {
+	const hooks = restartHooks;
+	restartHooks = [];
+	hooks.forEach(fn => {
+		try {
+			fn();
+		} catch (e) {
+			console.error(e);
+		}
+	});
+	// callbacks into a stopped program throw, and its pending timers are cancelled
+	if (go._scheduledTimeouts) {
+		go._scheduledTimeouts.forEach(id => clearTimeout(id));
+		go._scheduledTimeouts.clear();
+	}
+	go.exited = true;
+	go = new Go();
+	hookExit(go);
+	{{- if .Split }}
+	const started = lazyLoad(go, "{{ .Split }}?" + hash);
+	{{- end }}
+	return WebAssembly.instantiate(source, go.importObject).then(result => {
+		loadedHash = hash;
+		const errors = document.getElementById("wasmgo-errors");
+		if (errors) {
+			errors.remove();
+		}
+		{{- if .Split }}
+		started(result.instance);
+		{{- end }}
+		go.run(result.instance);
+	});
+};
+fetch(binaryUrl).then(resp => {
+	pollStatus();
+	if (!resp.ok) {
+		return resp.json().then(showErrors);
+	}
+	loadedHash = resp.headers.get("X-Wasmgo-Hash") || "";
+	{{- if .Split }}
+	const started = lazyLoad(go, "{{ .Split }}?" + loadedHash);
+	{{- end }}
+	return WebAssembly.instantiateStreaming(resp, go.importObject).then(result => {
+		{{- if .Split }}
+		started(result.instance);
+		{{- end }}
+		go.run(result.instance);
+	});
+});
+{{- else -}}
 const go = new Go();
 WebAssembly.instantiateStreaming(fetch("{{ .Binary }}"), go.importObject).then(result => {
 	go.run(result.instance);
-});`))
+});
+{{- end }}{{ define "lazyLoad" -}}
+// the secondary module is loaded the first time the program calls one of its functions. It's
+// instantiated in the background once the program has started, and if it's needed before then,
+// it's fetched and instantiated synchronously (browsers may not allow that on the main thread for
+// big modules).
+const lazyLoad = (go, url) => {
+	let primary = null;
+	let loaded = false;
+	const imports = () => Object.assign({}, go.importObject, {"wasmgo.primary": primary.exports});
+	go.importObject.wasmgo = {
+		load: () => {
+			if (loaded) {
+				return;
+			}
+			const xhr = new XMLHttpRequest();
+			xhr.open("GET", url, false);
+			xhr.overrideMimeType("text/plain; charset=x-user-defined");
+			xhr.send();
+			if (xhr.status !== 200) {
+				throw new Error("can't load " + url);
+			}
+			const bytes = new Uint8Array(xhr.responseText.length);
+			for (let i = 0; i < bytes.length; i++) {
+				bytes[i] = xhr.responseText.charCodeAt(i) & 0xff;
+			}
+			new WebAssembly.Instance(new WebAssembly.Module(bytes), imports());
+			loaded = true;
+		},
+	};
+	// started is called with the primary instance before the program is run
+	return instance => {
+		primary = instance;
+		fetch(url).then(resp => resp.ok ? resp.arrayBuffer() : null).then(bytes => {
+			if (bytes && !loaded) {
+				return WebAssembly.instantiate(bytes, imports()).then(() => {
+					loaded = true;
+				});
+			}
+		});
+	};
+};
+{{- end }}`))
 
-var loaderTemplateMin = template.Must(template.New("main").Parse(`WebAssembly.instantiateStreaming||(WebAssembly.instantiateStreaming=(async(t,a)=>{const e=await(await t).arrayBuffer();return await WebAssembly.instantiate(e,a)}));const go=new Go;WebAssembly.instantiateStreaming(fetch("{{ .Binary }}"),go.importObject).then(t=>{go.run(t.instance)});`))
+var loaderTemplateMin = template.Must(template.New("main").Parse(`WebAssembly.instantiateStreaming||(WebAssembly.instantiateStreaming=(async(t,a)=>{const e=await(await t).arrayBuffer();return await WebAssembly.instantiate(e,a)}));const go=new Go;{{ if .Split }}const started=((o,n)=>{let e=null,a=!1;const s=()=>Object.assign({},o.importObject,{"wasmgo.primary":e.exports});return o.importObject.wasmgo={load:()=>{if(a)return;const t=new XMLHttpRequest;if(t.open("GET",n,!1),t.overrideMimeType("text/plain; charset=x-user-defined"),t.send(),200!==t.status)throw new Error("can't load "+n);const r=new Uint8Array(t.responseText.length);for(let c=0;c<r.length;c++)r[c]=255&t.responseText.charCodeAt(c);new WebAssembly.Instance(new WebAssembly.Module(r),s()),a=!0}},t=>{e=t,fetch(n).then(t=>t.ok?t.arrayBuffer():null).then(t=>{if(t&&!a)return WebAssembly.instantiate(t,s()).then(()=>{a=!0})})}})(go,"{{ .Split }}");{{ end }}WebAssembly.instantiateStreaming(fetch("{{ .Binary }}"),go.importObject).then(t=>{ {{- if .Split }}started(t.instance);{{ end -}} go.run(t.instance)});`))
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/dave/wasmgo/cmd/cmdconfig"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func init() {
+	envCmd.PersistentFlags().BoolVarP(&global.Json, "json", "j", false, "Print the config as json.")
+	rootCmd.AddCommand(envCmd)
+}
+
+var envCmd = &cobra.Command{
+	Use:   "env [package]",
+	Short: "Print the effective config",
+	Long:  "Prints the config in effect for the package after merging the flag defaults, the project config file, the selected profile and the command line flags.",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := printEnv(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+type envOutput struct {
+	Project  string            `json:"project" yaml:"project"`
+	Profile  string            `json:"profile" yaml:"profile"`
+	Settings map[string]string `json:"settings" yaml:"settings"`
+	Flags    []string          `json:"flags" yaml:"flags"`
+	Env      []string          `json:"env" yaml:"env"`
+}
+
+func printEnv(cmd *cobra.Command) error {
+	args, err := cmdconfig.SplitArgs(global.Flags)
+	if err != nil {
+		return fmt.Errorf("parsing flags: %v", err)
+	}
+	out := envOutput{
+		Project:  global.Project,
+		Profile:  global.Profile,
+		Settings: map[string]string{},
+		Flags:    append(append([]string{}, global.BuildArgs...), args...),
+		Env:      global.BuildEnv,
+	}
+	visitFlags(rootCmd, func(f *pflag.Flag) {
+		switch f.Name {
+		case "help", "profile", "json", "flags":
+			return
+		}
+		if _, ok := out.Settings[f.Name]; ok {
+			return
+		}
+		if own := cmd.Flags().Lookup(f.Name); own != nil {
+			// flags of this command have had the project config applied
+			out.Settings[f.Name] = own.Value.String()
+		} else if value, ok := projectValues[f.Name]; ok {
+			out.Settings[f.Name] = value
+		} else {
+			out.Settings[f.Name] = f.DefValue
+		}
+	})
+	if global.Json {
+		b, err := json.MarshalIndent(out, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(b))
+	return nil
+}
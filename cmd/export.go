@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	exportCmd.PersistentFlags().StringVarP(&global.Output, "output", "d", "wasmgo-out", "Output directory.")
+	exportCmd.PersistentFlags().StringVarP(&global.BaseUrl, "base", "u", "", "Base URL the files will be hosted at. Omit to use relative URLs.")
+	exportCmd.PersistentFlags().StringVarP(&global.Archive, "archive", "a", "", "Also write the files to an archive (.zip, .tar, .tar.gz or .tgz).")
+	addSplitFlag(exportCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [package]",
+	Short: "Compile and export a static site",
+	Long:  "Compiles Go to WASM and writes the index page, loader, runtime script and binary to a directory, for hosting on any static web server.",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 0 {
+			global.Path = args[0]
+		}
+		ctx, cancel := interruptContext()
+		defer cancel()
+		d, err := deployer.New(ctx, global)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		files, err := d.Export(ctx, global.BaseUrl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if err := deployer.WriteDir(global.Output, files); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if global.Archive != "" {
+			if err := deployer.WriteArchive(global.Archive, files); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+				os.Exit(1)
+			}
+		}
+		fmt.Println(filepath.Join(global.Output, "index.html"))
+	},
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/wasmgo/cmd/cmdconfig"
+	"github.com/dave/wasmgo/cmd/toolchain"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// projectValues are the flag defaults from the project config file, with the profile applied.
+var projectValues = map[string]string{}
+
+// loadProject finds the project config file for the package and applies its settings, with the
+// selected profile, as defaults for any flags that weren't given on the command line.
+func loadProject(cmd *cobra.Command, args []string) error {
+	dir, err := projectDir(cmd, args)
+	if err != nil {
+		return err
+	}
+	fpath, err := cmdconfig.FindProject(dir)
+	if err != nil {
+		return err
+	}
+	if fpath == "" {
+		if global.Profile != "" {
+			return fmt.Errorf("can't use the %s profile: no %s found in %s or its parent directories", global.Profile, strings.Join(cmdconfig.ProjectFiles, ", "), dir)
+		}
+		return nil
+	}
+	project, err := cmdconfig.LoadProject(fpath)
+	if err != nil {
+		return err
+	}
+	settings, err := project.Merge(global.Profile)
+	if err != nil {
+		return err
+	}
+	projectValues = settings.Values
+	known := knownFlags()
+	for name, value := range settings.Values {
+		if !known[name] || name == "profile" || name == "help" {
+			return fmt.Errorf("%s: unknown setting %q", fpath, name)
+		}
+		f := cmd.Flags().Lookup(name)
+		if f == nil || f.Changed {
+			// not used by this command, or given on the command line
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %v", fpath, value, name, err)
+		}
+		if global.Defaulted == nil {
+			global.Defaulted = map[string]bool{}
+		}
+		global.Defaulted[name] = true
+	}
+	if len(settings.Tags) > 0 && !cmd.Flags().Changed("build") {
+		global.BuildTags = strings.Join(settings.Tags, ",")
+	}
+	global.Project = fpath
+	global.BuildArgs = settings.Args
+	global.BuildEnv = settings.EnvList()
+	return nil
+}
+
+// projectDir returns the directory to start searching for the project config file: the package
+// directory if the command was given a package, or the current directory.
+func projectDir(cmd *cobra.Command, args []string) (string, error) {
+	args = packageArgs(cmd, args)
+	if !strings.Contains(cmd.Use, "[package]") || len(args) == 0 {
+		return ".", nil
+	}
+	path := args[0]
+	if build.IsLocalImport(path) || filepath.IsAbs(path) {
+		return path, nil
+	}
+	// the deployer resolves the toolchain again and reports its progress, so it's quiet here
+	tc, err := toolchain.Resolve(global.Command, ioutil.Discard)
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.Command(tc.Path, "list", "-find", "-f", "{{.Dir}}", path).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, string(output))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// knownFlags returns the names of the flags of all commands.
+func knownFlags() map[string]bool {
+	known := map[string]bool{}
+	visitFlags(rootCmd, func(f *pflag.Flag) {
+		known[f.Name] = true
+	})
+	return known
+}
+
+// visitFlags calls fn for the flags of cmd and all its subcommands.
+func visitFlags(cmd *cobra.Command, fn func(f *pflag.Flag)) {
+	cmd.LocalFlags().VisitAll(fn)
+	for _, c := range cmd.Commands() {
+		visitFlags(c, fn)
+	}
+}
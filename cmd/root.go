@@ -9,12 +9,22 @@ import (
 )
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&global.Index, "index", "i", "index.wasmgo.html", "Specify the index page template. Variables: Script, Loader, Binary.")
+	rootCmd.PersistentFlags().StringVarP(&global.Index, "index", "i", "index.wasmgo.html", "Specify the index page template. Variables: Script, Loader, Binary, Dev.")
 	rootCmd.PersistentFlags().BoolVarP(&global.Verbose, "verbose", "v", false, "Show detailed status messages.")
 	rootCmd.PersistentFlags().BoolVarP(&global.Open, "open", "o", true, "Open the page in a browser.")
 	rootCmd.PersistentFlags().StringVarP(&global.Command, "command", "c", "go", "Name of the go command.")
+	rootCmd.PersistentFlags().StringVar(&global.Compiler, "compiler", "go", "Compiler to use: go or tinygo.")
+	rootCmd.PersistentFlags().StringVar(&global.TinyGo, "tinygo", "tinygo", "Name of the tinygo command, used with the tinygo compiler.")
 	rootCmd.PersistentFlags().StringVarP(&global.Flags, "flags", "f", "", "Flags to pass to the go build command.")
 	rootCmd.PersistentFlags().StringVarP(&global.BuildTags, "build", "b", "", "Build tags to pass to the go build command.")
+	rootCmd.PersistentFlags().StringVar(&global.Profile, "profile", "", "Profile from the project config file to apply.")
+	// set here rather than in the declaration, because loadProject refers to rootCmd
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if err := loadProject(cmd, args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
 }
 
 var global = &cmdconfig.Config{}
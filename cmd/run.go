@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/dave/wasmgo/cmd/runner"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run [package|binary.wasm] [-- arguments]",
+	Short: "Run without a browser",
+	Long:  "Compiles the package to WASM (or takes an existing binary) and runs it with a WASM interpreter written in Go, so no browser or Node.js is needed. Stdin, stdout and stderr are connected to the program, arguments after -- are passed to it, and the command exits with its exit code.",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(packageArgs(cmd, args)) > 1 {
+			return errors.New("accepts at most 1 package or binary")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		pkgs := packageArgs(cmd, args)
+		name := "js"
+		if len(pkgs) > 0 {
+			name = filepath.Base(pkgs[0])
+		}
+		ctx, cancel := interruptContext()
+		defer cancel()
+		var binary []byte
+		var err error
+		if len(pkgs) > 0 && strings.HasSuffix(pkgs[0], ".wasm") {
+			binary, err = ioutil.ReadFile(pkgs[0])
+		} else {
+			if len(pkgs) > 0 {
+				global.Path = pkgs[0]
+			}
+			var d *deployer.State
+			d, err = deployer.New(ctx, global)
+			if err == nil {
+				// stdout belongs to the program
+				if global.Verbose {
+					d.SetDebug(os.Stderr)
+				}
+				binary, _, err = d.Build(ctx)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		code, err := runner.Run(ctx, binary, runner.Options{
+			Args:   append([]string{name}, args[len(pkgs):]...),
+			Env:    runner.Environ(),
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(code)
+	},
+}
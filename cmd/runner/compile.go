@@ -0,0 +1,448 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/dave/wasmgo/cmd/wasmbin"
+)
+
+const (
+	opUnreachable  = 0x00
+	opNop          = 0x01
+	opBlock        = 0x02
+	opLoop         = 0x03
+	opIf           = 0x04
+	opElse         = 0x05
+	opEnd          = 0x0b
+	opBr           = 0x0c
+	opBrIf         = 0x0d
+	opBrTable      = 0x0e
+	opReturn       = 0x0f
+	opCall         = 0x10
+	opCallIndirect = 0x11
+	opDrop         = 0x1a
+	opSelect       = 0x1b
+	opSelectT      = 0x1c
+	opLocalGet     = 0x20
+	opLocalSet     = 0x21
+	opLocalTee     = 0x22
+	opGlobalGet    = 0x23
+	opGlobalSet    = 0x24
+	opI32Load      = 0x28
+	opI64Store32   = 0x3e
+	opMemorySize   = 0x3f
+	opMemoryGrow   = 0x40
+	opI32Const     = 0x41
+	opI64Const     = 0x42
+	opF32Const     = 0x43
+	opF64Const     = 0x44
+	opI32Eqz       = 0x45
+	opI64Eqz       = 0x50
+	opI64Extend32S = 0xc4
+	opMisc         = 0xfc
+
+	// the 0xfc prefixed instructions are compiled to opMiscBase plus their second opcode
+	opMiscBase   = 0xe0
+	opMemoryCopy = opMiscBase + 10
+	opMemoryFill = opMiscBase + 11
+)
+
+// instr is a compiled instruction. Instructions keep their wasm opcode, but structured control flow
+// is compiled to jumps that know how many values to keep and drop, so blocks aren't tracked when the
+// function runs:
+//
+//	br, br_if    jump to a, keeping the top keep values and dropping the b values below them
+//	br_table     like br, with the targets in the function's table a
+//	if           jump to a if the condition is zero
+//	else         jump to a, at the end of the then branch
+//	end          not emitted, except at the end of the function, where it's compiled to return
+type instr struct {
+	op   byte
+	keep byte   // values kept by a branch
+	a    uint32 // index, memory offset, jump target or br_table table
+	b    uint64 // constant, or the values dropped by a branch
+}
+
+type branch struct {
+	target     uint32
+	keep, drop uint32
+}
+
+type function struct {
+	typ     uint32 // first index of an equal type, for call_indirect
+	params  int
+	results int
+	locals  int // including the parameters
+	height  int // maximum height of the operand stack
+	code    []instr
+	tables  [][]branch
+	host    func(args []uint64) []uint64 // the implementation of an imported function
+}
+
+// maxLocals limits the stack space used by a single call.
+const maxLocals = 1 << 16
+
+type compiler struct {
+	m      *module
+	f      *function
+	r      *wasmbin.Reader
+	height int // height of the operand stack
+	ctrls  []control
+}
+
+type control struct {
+	loop            bool
+	height          int // height of the operand stack below the parameters of the block
+	params, results int
+	start           uint32  // target of branches to a loop
+	fixups          []fixup // branches to the end of the block
+	elsePC          int     // the if instruction that jumps to the else branch, or -1
+	unreachable     bool    // the rest of the block can't be reached
+}
+
+// fixup is a forward branch that's given its target at the end of the block. The target is
+// code[index].a if table is -1, or tables[table][index].target otherwise.
+type fixup struct {
+	table, index int
+}
+
+// compile compiles the body of a defined function.
+func compile(m *module, index int, typ uint32) (*function, error) {
+	sig := m.types[m.funcs[index]]
+	f := &function{typ: typ, params: len(sig.params), results: len(sig.results)}
+	r := wasmbin.NewReader(m.bodies[index])
+	f.locals = f.params
+	for n := r.Uint(); n > 0 && r.Err() == nil; n-- {
+		f.locals += int(r.Uint())
+		r.Byte()
+		if f.locals > maxLocals {
+			return nil, fmt.Errorf("function %d has too many locals", len(m.imports)+index)
+		}
+	}
+	c := &compiler{m: m, f: f, r: r}
+	c.ctrls = []control{{results: f.results, elsePC: -1}}
+	for len(c.ctrls) > 0 && r.Err() == nil {
+		c.instr()
+	}
+	if r.Err() == nil && r.Len() != 0 {
+		r.Fail("instructions after the end of the function")
+	}
+	if r.Err() != nil {
+		return nil, fmt.Errorf("function %d: %v", len(m.imports)+index, r.Err())
+	}
+	return f, nil
+}
+
+func (c *compiler) instr() {
+	r, f := c.r, c.f
+	op := r.Byte()
+	switch {
+	case op == opUnreachable:
+		c.emit(instr{op: op})
+		c.unreachable()
+	case op == opNop:
+	case op == opBlock || op == opLoop:
+		params, results := c.blockType()
+		c.ctrls = append(c.ctrls, control{
+			loop:    op == opLoop,
+			height:  c.height - params,
+			params:  params,
+			results: results,
+			start:   uint32(len(f.code)),
+			elsePC:  -1,
+		})
+	case op == opIf:
+		params, results := c.blockType()
+		c.pop(1)
+		c.ctrls = append(c.ctrls, control{
+			height:  c.height - params,
+			params:  params,
+			results: results,
+			elsePC:  len(f.code),
+		})
+		c.emit(instr{op: op})
+	case op == opElse:
+		ctrl := &c.ctrls[len(c.ctrls)-1]
+		if ctrl.elsePC == -1 {
+			r.Fail("else without if")
+			return
+		}
+		ctrl.fixups = append(ctrl.fixups, fixup{table: -1, index: len(f.code)})
+		c.emit(instr{op: op})
+		f.code[ctrl.elsePC].a = uint32(len(f.code))
+		ctrl.elsePC = -1
+		ctrl.unreachable = false
+		c.height = ctrl.height + ctrl.params
+	case op == opEnd:
+		ctrl := c.ctrls[len(c.ctrls)-1]
+		end := uint32(len(f.code))
+		if ctrl.elsePC != -1 {
+			f.code[ctrl.elsePC].a = end
+		}
+		for _, fix := range ctrl.fixups {
+			if fix.table == -1 {
+				f.code[fix.index].a = end
+			} else {
+				f.tables[fix.table][fix.index].target = end
+			}
+		}
+		c.ctrls = c.ctrls[:len(c.ctrls)-1]
+		c.height = ctrl.height
+		c.push(ctrl.results)
+		if len(c.ctrls) == 0 {
+			c.emit(instr{op: opReturn})
+		}
+	case op == opBr || op == opBrIf:
+		depth := r.Uint()
+		if op == opBrIf {
+			c.pop(1)
+		}
+		b := c.branch(depth, fixup{table: -1, index: len(f.code)})
+		c.emit(instr{op: op, keep: byte(b.keep), a: b.target, b: uint64(b.drop)})
+		if op == opBr {
+			c.unreachable()
+		}
+	case op == opBrTable:
+		n := r.Uint()
+		if n > uint64(r.Len()) {
+			r.Fail("br_table too long")
+			return
+		}
+		c.pop(1)
+		table := make([]branch, n+1)
+		f.tables = append(f.tables, table)
+		for i := range table {
+			table[i] = c.branch(r.Uint(), fixup{table: len(f.tables) - 1, index: i})
+		}
+		c.emit(instr{op: op, a: uint32(len(f.tables) - 1)})
+		c.unreachable()
+	case op == opReturn:
+		c.emit(instr{op: op})
+		c.unreachable()
+	case op == opCall:
+		index := r.Uint()
+		if index >= uint64(len(c.m.imports)+len(c.m.funcs)) {
+			r.Fail("call to unknown function")
+			return
+		}
+		sig := c.m.signature(uint32(index))
+		c.pop(len(sig.params))
+		c.push(len(sig.results))
+		c.emit(instr{op: op, a: uint32(index)})
+	case op == opCallIndirect:
+		typ := r.Uint()
+		r.Uint() // table
+		if typ >= uint64(len(c.m.types)) {
+			r.Fail("call_indirect with unknown type")
+			return
+		}
+		sig := c.m.types[typ]
+		c.pop(1 + len(sig.params))
+		c.push(len(sig.results))
+		c.emit(instr{op: op, a: canonicalType(c.m, uint32(typ))})
+	case op == opDrop:
+		c.pop(1)
+		c.emit(instr{op: op})
+	case op == opSelect || op == opSelectT:
+		if op == opSelectT {
+			r.Bytes(int(r.Uint()))
+		}
+		c.pop(3)
+		c.push(1)
+		c.emit(instr{op: opSelect})
+	case op >= opLocalGet && op <= opLocalTee:
+		index := r.Uint()
+		if index >= uint64(f.locals) {
+			r.Fail("unknown local")
+			return
+		}
+		if op != opLocalGet {
+			c.pop(1)
+		}
+		if op != opLocalSet {
+			c.push(1)
+		}
+		c.emit(instr{op: op, a: uint32(index)})
+	case op == opGlobalGet || op == opGlobalSet:
+		index := r.Uint()
+		if index >= uint64(len(c.m.globals)) {
+			r.Fail("unknown global")
+			return
+		}
+		if op == opGlobalGet {
+			c.push(1)
+		} else {
+			c.pop(1)
+		}
+		c.emit(instr{op: op, a: uint32(index)})
+	case op >= opI32Load && op <= opI64Store32:
+		r.Uint() // alignment
+		offset := r.Uint()
+		if op <= 0x35 {
+			c.pop(1)
+			c.push(1)
+		} else {
+			c.pop(2)
+		}
+		c.emit(instr{op: op, a: uint32(offset)})
+	case op == opMemorySize || op == opMemoryGrow:
+		r.Byte()
+		if op == opMemoryGrow {
+			c.pop(1)
+		}
+		c.push(1)
+		c.emit(instr{op: op})
+	case op >= opI32Const && op <= opF64Const:
+		var v uint64
+		switch op {
+		case opI32Const:
+			v = uint64(uint32(r.Int()))
+		case opI64Const:
+			v = uint64(r.Int())
+		case opF32Const:
+			v = r.Fixed(4)
+		case opF64Const:
+			v = r.Fixed(8)
+		}
+		c.push(1)
+		c.emit(instr{op: op, b: v})
+	case op >= opI32Eqz && op <= opI64Extend32S:
+		c.pop(numericArgs(op))
+		c.push(1)
+		c.emit(instr{op: op})
+	case op == opMisc:
+		sub := r.Uint()
+		switch {
+		case sub <= 7: // saturating truncation
+			c.pop(1)
+			c.push(1)
+		case sub == 10: // memory.copy
+			r.Byte()
+			r.Byte()
+			c.pop(3)
+		case sub == 11: // memory.fill
+			r.Byte()
+			c.pop(3)
+		default:
+			r.Fail(fmt.Sprintf("unsupported instruction 0xfc %d", sub))
+			return
+		}
+		c.emit(instr{op: opMiscBase + byte(sub)})
+	default:
+		r.Fail(fmt.Sprintf("unsupported instruction 0x%02x", op))
+	}
+}
+
+// numericArgs returns the number of operands of a numeric instruction. All of them have one result.
+func numericArgs(op byte) int {
+	switch {
+	case op == opI32Eqz || op == opI64Eqz:
+		return 1
+	case op <= 0x66: // comparisons
+		return 2
+	case op <= 0x69: // i32 clz, ctz, popcnt
+		return 1
+	case op <= 0x78: // i32 binary
+		return 2
+	case op <= 0x7b: // i64 clz, ctz, popcnt
+		return 1
+	case op <= 0x8a: // i64 binary
+		return 2
+	case op <= 0x91: // f32 unary
+		return 1
+	case op <= 0x98: // f32 binary
+		return 2
+	case op <= 0x9f: // f64 unary
+		return 1
+	case op <= 0xa6: // f64 binary
+		return 2
+	default: // conversions and sign extension
+		return 1
+	}
+}
+
+// blockType reads a block type and returns the number of parameters and results.
+func (c *compiler) blockType() (params, results int) {
+	t := c.r.Int()
+	switch {
+	case t == -0x40: // empty
+		return 0, 0
+	case t < 0: // value type
+		return 0, 1
+	case t < int64(len(c.m.types)):
+		return len(c.m.types[t].params), len(c.m.types[t].results)
+	}
+	c.r.Fail("unknown block type")
+	return 0, 0
+}
+
+// branch returns the branch to the block at depth. Branches to the end of a block are given their
+// target with fix when the block ends.
+func (c *compiler) branch(depth uint64, fix fixup) branch {
+	if depth >= uint64(len(c.ctrls)) {
+		c.r.Fail("branch depth out of range")
+		return branch{}
+	}
+	ctrl := &c.ctrls[len(c.ctrls)-1-int(depth)]
+	keep := ctrl.results
+	if ctrl.loop {
+		keep = ctrl.params
+	}
+	if keep > 0xff {
+		c.r.Fail("too many block results")
+		return branch{}
+	}
+	drop := c.height - ctrl.height - keep
+	if drop < 0 {
+		// only in unreachable code
+		drop = 0
+	}
+	b := branch{keep: uint32(keep), drop: uint32(drop)}
+	if ctrl.loop {
+		b.target = ctrl.start
+	} else {
+		ctrl.fixups = append(ctrl.fixups, fix)
+	}
+	return b
+}
+
+func (c *compiler) emit(in instr) {
+	c.f.code = append(c.f.code, in)
+}
+
+func (c *compiler) push(n int) {
+	c.height += n
+	if c.height > c.f.height {
+		c.f.height = c.height
+	}
+}
+
+func (c *compiler) pop(n int) {
+	ctrl := &c.ctrls[len(c.ctrls)-1]
+	c.height -= n
+	if c.height < ctrl.height {
+		if !ctrl.unreachable {
+			c.r.Fail("operand stack underflow")
+		}
+		c.height = ctrl.height
+	}
+}
+
+// unreachable marks the rest of the block as unreachable. The operand stack is polymorphic there,
+// so its height is reset to the bottom of the block.
+func (c *compiler) unreachable() {
+	ctrl := &c.ctrls[len(c.ctrls)-1]
+	ctrl.unreachable = true
+	c.height = ctrl.height
+}
+
+// canonicalType returns the first type index with the same signature as typ, so call_indirect can
+// compare signatures by index.
+func canonicalType(m *module, typ uint32) uint32 {
+	for i := range m.types[:typ] {
+		if m.types[i].equal(m.types[typ]) {
+			return uint32(i)
+		}
+	}
+	return typ
+}
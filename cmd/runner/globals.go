@@ -0,0 +1,354 @@
+package runner
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// globals creates the global object, with the parts of the browser and Node.js APIs that Go uses:
+// the constructors for syscall/js, console, Date for the local time zone, fs for stdin, stdout and
+// stderr, and the process, path, crypto and performance polyfills from wasm_exec.js.
+func (h *host) globals() *object {
+	h.objectProto = newObject(nil)
+	h.functionProto = newObject(h.objectProto)
+	h.arrayProto = newObject(h.objectProto)
+	h.bytesProto = newObject(h.objectProto)
+	h.errorProto = newObject(h.objectProto)
+	h.typeErrorProto = newObject(h.errorProto)
+	dateProto := newObject(h.objectProto)
+
+	g := newObject(h.objectProto)
+	g.props["globalThis"] = g
+	g.props["global"] = g
+
+	g.props["Object"] = h.class("Object", h.objectProto, func(args []value) value {
+		if o, ok := arg(args, 0).(*object); ok {
+			return o
+		}
+		return newObject(h.objectProto)
+	})
+	h.objectProto.props["toString"] = h.fn(func(this value, args []value) value {
+		return "[object Object]"
+	})
+
+	g.props["Array"] = h.class("Array", h.arrayProto, func(args []value) value {
+		if n, ok := arg(args, 0).(float64); ok && len(args) == 1 {
+			if n < 0 || n != float64(int(n)) {
+				throw(h.newError(h.errorProto, "Invalid array length"))
+			}
+			return h.newArray(make([]value, int(n)))
+		}
+		return h.newArray(append([]value(nil), args...))
+	})
+
+	g.props["Uint8Array"] = h.class("Uint8Array", h.bytesProto, func(args []value) value {
+		switch a := arg(args, 0).(type) {
+		case float64:
+			if a < 0 || a != float64(int(a)) {
+				throw(h.newError(h.errorProto, "Invalid typed array length"))
+			}
+			return h.newBytes(make([]byte, int(a)))
+		case *object:
+			b := make([]byte, a.length())
+			for i := range b {
+				b[i] = byte(int64(toNumber(a.index(i))))
+			}
+			return h.newBytes(b)
+		}
+		return h.newBytes(nil)
+	})
+	h.bytesProto.props["subarray"] = h.fn(func(this value, args []value) value {
+		o, ok := this.(*object)
+		if !ok || !o.isBytes {
+			throw(h.typeError("this is not a typed array"))
+		}
+		start, end := sliceRange(len(o.bytes), arg(args, 0), arg(args, 1))
+		// the subarray shares its contents, like in JavaScript
+		return h.newBytes(o.bytes[start:end:end])
+	})
+
+	h.errorProto.props["name"] = "Error"
+	h.errorProto.props["toString"] = h.fn(func(this value, args []value) value {
+		return toString(h.get(this, "name")) + ": " + toString(h.get(this, "message"))
+	})
+	g.props["Error"] = h.class("Error", h.errorProto, func(args []value) value {
+		return h.newError(h.errorProto, toString(arg(args, 0)))
+	})
+	h.typeErrorProto.props["name"] = "TypeError"
+	g.props["TypeError"] = h.class("TypeError", h.typeErrorProto, func(args []value) value {
+		return h.newError(h.typeErrorProto, toString(arg(args, 0)))
+	})
+
+	date := h.class("Date", dateProto, func(args []value) value {
+		d := newObject(dateProto)
+		d.date = time.Now()
+		if ms, ok := arg(args, 0).(float64); ok {
+			d.date = time.Unix(0, int64(ms*1e6))
+			if len(args) > 1 {
+				d.date = dateOf(args, time.Local)
+			}
+		}
+		return d
+	})
+	date.props["now"] = h.fn(func(this value, args []value) value {
+		return float64(time.Now().UnixNano() / 1e6)
+	})
+	date.props["UTC"] = h.fn(func(this value, args []value) value {
+		return float64(dateOf(args, time.UTC).UnixNano() / 1e6)
+	})
+	dateMethod := func(name string, f func(t time.Time) value) {
+		dateProto.props[name] = h.fn(func(this value, args []value) value {
+			d, ok := this.(*object)
+			if !ok || d.proto != dateProto {
+				throw(h.typeError("this is not a Date object."))
+			}
+			return f(d.date)
+		})
+	}
+	dateMethod("getTime", func(t time.Time) value {
+		return float64(t.UnixNano() / 1e6)
+	})
+	dateMethod("valueOf", func(t time.Time) value {
+		return float64(t.UnixNano() / 1e6)
+	})
+	dateFields := map[string]func(t time.Time) int{
+		"FullYear":     time.Time.Year,
+		"Month":        func(t time.Time) int { return int(t.Month()) - 1 },
+		"Date":         time.Time.Day,
+		"Day":          func(t time.Time) int { return int(t.Weekday()) },
+		"Hours":        time.Time.Hour,
+		"Minutes":      time.Time.Minute,
+		"Seconds":      time.Time.Second,
+		"Milliseconds": func(t time.Time) int { return t.Nanosecond() / 1e6 },
+	}
+	for name, field := range dateFields {
+		field := field
+		dateMethod("get"+name, func(t time.Time) value {
+			return float64(field(t.Local()))
+		})
+		dateMethod("getUTC"+name, func(t time.Time) value {
+			return float64(field(t.UTC()))
+		})
+	}
+	dateMethod("getTimezoneOffset", func(t time.Time) value {
+		_, offset := t.Zone()
+		return float64(-offset / 60)
+	})
+	dateMethod("toISOString", func(t time.Time) value {
+		return t.UTC().Format("2006-01-02T15:04:05.000Z")
+	})
+	dateMethod("toJSON", func(t time.Time) value {
+		return t.UTC().Format("2006-01-02T15:04:05.000Z")
+	})
+	dateMethod("toUTCString", func(t time.Time) value {
+		return t.UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")
+	})
+	dateMethod("toString", func(t time.Time) value {
+		return t.Local().Format("Mon Jan 02 2006 15:04:05 GMT-0700 (MST)")
+	})
+	g.props["Date"] = date
+
+	console := newObject(h.objectProto)
+	for name, w := range map[string]io.Writer{"log": h.stdout, "info": h.stdout, "debug": h.stdout, "warn": h.stderr, "error": h.stderr} {
+		w := w
+		console.props[name] = h.fn(func(this value, args []value) value {
+			h.log(w, args)
+			return nil
+		})
+	}
+	g.props["console"] = console
+
+	g.props["fs"] = h.fs()
+
+	process := newObject(h.objectProto)
+	for _, name := range []string{"getuid", "getgid", "geteuid", "getegid"} {
+		process.props[name] = h.fn(func(this value, args []value) value {
+			return float64(-1)
+		})
+	}
+	for _, name := range []string{"getgroups", "umask", "cwd", "chdir"} {
+		process.props[name] = h.fn(func(this value, args []value) value {
+			throw(h.enosys())
+			return nil
+		})
+	}
+	process.props["pid"] = float64(-1)
+	process.props["ppid"] = float64(-1)
+	g.props["process"] = process
+
+	path := newObject(h.objectProto)
+	path.props["resolve"] = h.fn(func(this value, args []value) value {
+		parts := make([]string, len(args))
+		for i, a := range args {
+			parts[i] = toString(a)
+		}
+		return strings.Join(parts, "/")
+	})
+	g.props["path"] = path
+
+	crypto := newObject(h.objectProto)
+	crypto.props["getRandomValues"] = h.fn(func(this value, args []value) value {
+		o, ok := arg(args, 0).(*object)
+		if !ok || !o.isBytes {
+			throw(h.typeError("The provided value is not of type 'ArrayBufferView'"))
+		}
+		rand.Read(o.bytes)
+		return o
+	})
+	g.props["crypto"] = crypto
+
+	performance := newObject(h.objectProto)
+	performance.props["now"] = h.fn(func(this value, args []value) value {
+		return float64(time.Since(h.origin)) / 1e6
+	})
+	g.props["performance"] = performance
+
+	return g
+}
+
+// dateOf returns the date with the components given to the Date constructor and Date.UTC: the
+// year, month and optionally the day, hours, minutes, seconds and milliseconds. Like in JavaScript,
+// months start at 0, years from 0 to 99 are in the 1900s, and out of range values carry over.
+func dateOf(args []value, loc *time.Location) time.Time {
+	c := [7]float64{0, 0, 1, 0, 0, 0, 0}
+	for i := range c {
+		if i < len(args) {
+			c[i] = toNumber(args[i])
+		}
+	}
+	if c[0] >= 0 && c[0] <= 99 {
+		c[0] += 1900
+	}
+	return time.Date(int(c[0]), time.Month(c[1]+1), int(c[2]), int(c[3]), int(c[4]), int(c[5]), int(c[6]*1e6), loc)
+}
+
+// fs implements the fs module used by the syscall package. Like the polyfill in wasm_exec.js, only
+// writing to stdout and stderr is supported, along with reading from stdin. Other functions give
+// ENOSYS to their callback.
+func (h *host) fs() *object {
+	fs := newObject(h.objectProto)
+	constants := newObject(h.objectProto)
+	for _, name := range []string{"O_WRONLY", "O_RDWR", "O_CREAT", "O_TRUNC", "O_APPEND", "O_EXCL", "O_DIRECTORY"} {
+		constants.props[name] = float64(-1)
+	}
+	fs.props["constants"] = constants
+
+	fs.props["writeSync"] = h.fn(func(this value, args []value) value {
+		buf, ok := arg(args, 1).(*object)
+		if !ok || !buf.isBytes {
+			throw(h.typeError("The \"buffer\" argument must be an instance of Uint8Array"))
+		}
+		n, err := h.write(toNumber(arg(args, 0)), buf.bytes)
+		if err != nil {
+			throw(err)
+		}
+		return float64(n)
+	})
+	fs.props["write"] = h.fn(func(this value, args []value) value {
+		callback := arg(args, 5)
+		buf, ok := arg(args, 1).(*object)
+		offset, length := toNumber(arg(args, 2)), toNumber(arg(args, 3))
+		if !ok || !buf.isBytes || offset < 0 || length < 0 || offset+length > float64(len(buf.bytes)) || arg(args, 4) != null {
+			h.callValue(callback, nil, []value{h.enosys()})
+			return nil
+		}
+		n, err := h.write(toNumber(arg(args, 0)), buf.bytes[int(offset):int(offset+length)])
+		if err != nil {
+			h.callValue(callback, nil, []value{err})
+			return nil
+		}
+		h.callValue(callback, nil, []value{null, float64(n)})
+		return nil
+	})
+	fs.props["read"] = h.fn(func(this value, args []value) value {
+		callback := arg(args, 5)
+		buf, ok := arg(args, 1).(*object)
+		offset, length := toNumber(arg(args, 2)), toNumber(arg(args, 3))
+		if toNumber(arg(args, 0)) != 0 || h.stdin == nil || !ok || !buf.isBytes || offset < 0 || length < 0 || offset+length > float64(len(buf.bytes)) || arg(args, 4) != null {
+			h.callValue(callback, nil, []value{h.enosys()})
+			return nil
+		}
+		n, err := h.stdin.Read(buf.bytes[int(offset):int(offset+length)])
+		if err != nil && err != io.EOF {
+			h.callValue(callback, nil, []value{h.newError(h.errorProto, err.Error())})
+			return nil
+		}
+		h.callValue(callback, nil, []value{null, float64(n)})
+		return nil
+	})
+	fs.props["fsync"] = h.fn(func(this value, args []value) value {
+		h.callValue(arg(args, 1), nil, []value{null})
+		return nil
+	})
+	unsupported := map[string]int{
+		"chmod": 2, "chown": 3, "close": 1, "fchmod": 2, "fchown": 3, "fstat": 1, "ftruncate": 2,
+		"lchown": 3, "link": 2, "lstat": 1, "mkdir": 2, "open": 3, "readdir": 1, "readlink": 1,
+		"rename": 2, "rmdir": 1, "stat": 1, "symlink": 2, "truncate": 2, "unlink": 1, "utimes": 3,
+	}
+	for name, callback := range unsupported {
+		callback := callback
+		fs.props[name] = h.fn(func(this value, args []value) value {
+			h.callValue(arg(args, callback), nil, []value{h.enosys()})
+			return nil
+		})
+	}
+	return fs
+}
+
+// write writes to stdout or stderr.
+func (h *host) write(fd float64, b []byte) (int, *object) {
+	var w io.Writer
+	switch fd {
+	case 1:
+		w = h.stdout
+	case 2:
+		w = h.stderr
+	default:
+		return 0, h.enosys()
+	}
+	n, err := w.Write(b)
+	if err != nil {
+		return n, h.newError(h.errorProto, err.Error())
+	}
+	return n, nil
+}
+
+// log writes the arguments of a console method as a line.
+func (h *host) log(w io.Writer, args []value) {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = toString(a)
+	}
+	fmt.Fprintln(w, strings.Join(parts, " "))
+}
+
+// sliceRange returns the range of a subarray, like TypedArray.prototype.subarray.
+func sliceRange(n int, begin, end value) (int, int) {
+	clamp := func(v value, def int) int {
+		if v == nil {
+			return def
+		}
+		f := toNumber(v)
+		if f != f {
+			return 0
+		}
+		if f < 0 {
+			f += float64(n)
+		}
+		switch {
+		case f < 0:
+			return 0
+		case f > float64(n):
+			return n
+		}
+		return int(f)
+	}
+	start, stop := clamp(begin, 0), clamp(end, n)
+	if stop < start {
+		stop = start
+	}
+	return start, stop
+}
@@ -0,0 +1,397 @@
+package runner
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// host implements the go import module of wasm_exec.js. Each imported function takes the Go stack
+// pointer, and reads its arguments from and writes its results to the Go stack in linear memory.
+type host struct {
+	vm     *machine
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	origin time.Time
+
+	// Binaries from before Go 1.14 (which added finalizeRef) use the old type flags in references,
+	// and binaries from before Go 1.13 (which added the copyBytes functions) also keep the linear
+	// memory at reference 6.
+	legacyFlags bool
+	memoryRef   bool
+
+	values []value         // values Go has references to, indexed by reference id
+	counts []int           // number of references Go has to each value, or -1 if it's never released
+	ids    map[value]int   // reference ids of the values
+	pool   []int           // unused reference ids
+	goObj  *object         // the instance of the Go class
+	timers map[int32]timer // scheduled timeout events
+	nextID int32
+
+	objectProto, functionProto, arrayProto, bytesProto, errorProto, typeErrorProto *object
+}
+
+type timer struct {
+	id       int32
+	deadline time.Time
+}
+
+// exit is the panic value of runtime.wasmExit.
+type exit int32
+
+// nanHead is the upper half of the NaN boxed references that represent values other than numbers.
+const nanHead = 0x7ff80000
+
+// init creates the predefined references: NaN, 0, null, true, false, the global object and the Go
+// object, which syscall/js uses to receive events.
+func (h *host) init() {
+	h.goObj = newObject(nil)
+	h.goObj.props["_pendingEvent"] = null
+	h.goObj.props["_makeFuncWrapper"] = h.fn(func(this value, args []value) value {
+		id := arg(args, 0)
+		return h.fn(func(this value, args []value) value {
+			event := newObject(h.objectProto)
+			event.props["id"] = id
+			event.props["this"] = this
+			event.props["args"] = h.newArray(args)
+			h.goObj.props["_pendingEvent"] = event
+			h.resume()
+			return event.props["result"]
+		})
+	})
+	h.values = []value{math.NaN(), float64(0), null, true, false, h.globals()}
+	if h.memoryRef {
+		// the linear memory, only used by js.TypedArrayOf
+		h.values = append(h.values, newObject(h.objectProto))
+	}
+	h.values = append(h.values, h.goObj)
+	for i, v := range h.values {
+		h.counts = append(h.counts, -1)
+		if i > 0 {
+			h.ids[v] = i
+		}
+	}
+}
+
+// resume runs Go until it's waiting for an event.
+func (h *host) resume() {
+	h.vm.invoke("resume")
+}
+
+// sp returns the current Go stack pointer. It changes if Go runs during an import, because the
+// goroutine may move to a bigger stack.
+func (h *host) sp() uint32 {
+	return uint32(h.vm.invoke("getsp")[0])
+}
+
+// imports returns the implementation of a function of the go import module.
+func (h *host) imports(module, name string) func(args []uint64) []uint64 {
+	if module != "go" && module != "gojs" {
+		return nil
+	}
+	f, ok := map[string]func(sp uint32){
+		"runtime.wasmExit": func(sp uint32) {
+			panic(exit(h.getInt32(sp + 8)))
+		},
+		"runtime.wasmWrite": func(sp uint32) {
+			fd := h.getInt64(sp + 8)
+			b := h.bytesAt(h.getInt64(sp+16), int64(h.getInt32(sp+24)))
+			if _, err := h.write(float64(fd), b); err != nil {
+				throw(err)
+			}
+		},
+		"runtime.resetMemoryDataView": func(sp uint32) {},
+		"runtime.nanotime": func(sp uint32) {
+			h.setInt64(sp+8, h.origin.UnixNano()+int64(time.Since(h.origin)))
+		},
+		"runtime.nanotime1": func(sp uint32) {
+			h.setInt64(sp+8, h.origin.UnixNano()+int64(time.Since(h.origin)))
+		},
+		"runtime.walltime": func(sp uint32) {
+			now := time.Now()
+			h.setInt64(sp+8, now.Unix())
+			h.setInt32(sp+16, int32(now.Nanosecond()))
+		},
+		"runtime.walltime1": func(sp uint32) {
+			now := time.Now()
+			h.setInt64(sp+8, now.Unix())
+			h.setInt32(sp+16, int32(now.Nanosecond()))
+		},
+		"runtime.scheduleTimeoutEvent": func(sp uint32) {
+			id := h.nextID
+			h.nextID++
+			delay := time.Duration(h.getInt64(sp+8)) * time.Millisecond
+			h.timers[id] = timer{id: id, deadline: time.Now().Add(delay)}
+			h.setInt32(sp+16, id)
+		},
+		"runtime.clearTimeoutEvent": func(sp uint32) {
+			delete(h.timers, h.getInt32(sp+8))
+		},
+		"runtime.getRandomData": func(sp uint32) {
+			rand.Read(h.loadSlice(sp + 8))
+		},
+		"syscall/js.finalizeRef": func(sp uint32) {
+			id := int(h.getUint32(sp + 8))
+			if id >= len(h.counts) || h.counts[id] <= 0 {
+				return
+			}
+			h.counts[id]--
+			if h.counts[id] == 0 {
+				delete(h.ids, h.values[id])
+				h.values[id] = nil
+				h.pool = append(h.pool, id)
+			}
+		},
+		"syscall/js.stringVal": func(sp uint32) {
+			h.storeValue(sp+24, h.loadString(sp+8))
+		},
+		"syscall/js.valueGet": func(sp uint32) {
+			result := h.get(h.loadValue(sp+8), h.loadString(sp+16))
+			h.storeValue(h.sp()+32, result)
+		},
+		"syscall/js.valueSet": func(sp uint32) {
+			h.set(h.loadValue(sp+8), h.loadString(sp+16), h.loadValue(sp+32))
+		},
+		"syscall/js.valueDelete": func(sp uint32) {
+			if o, ok := h.loadValue(sp + 8).(*object); ok {
+				delete(o.props, h.loadString(sp+16))
+			}
+		},
+		"syscall/js.valueIndex": func(sp uint32) {
+			h.storeValue(sp+24, h.index(h.loadValue(sp+8), h.getInt64(sp+16)))
+		},
+		"syscall/js.valueSetIndex": func(sp uint32) {
+			h.setIndex(h.loadValue(sp+8), h.getInt64(sp+16), h.loadValue(sp+24))
+		},
+		"syscall/js.valueCall": func(sp uint32) {
+			h.catch(56, func() value {
+				v := h.loadValue(sp + 8)
+				m := h.get(v, h.loadString(sp+16))
+				return h.callValue(m, v, h.loadSliceOfValues(sp+32))
+			})
+		},
+		"syscall/js.valueInvoke": func(sp uint32) {
+			h.catch(40, func() value {
+				return h.callValue(h.loadValue(sp+8), nil, h.loadSliceOfValues(sp+16))
+			})
+		},
+		"syscall/js.valueNew": func(sp uint32) {
+			h.catch(40, func() value {
+				return h.construct(h.loadValue(sp+8), h.loadSliceOfValues(sp+16))
+			})
+		},
+		"syscall/js.valueLength": func(sp uint32) {
+			h.setInt64(sp+16, int64(toNumber(h.get(h.loadValue(sp+8), "length"))))
+		},
+		"syscall/js.valuePrepareString": func(sp uint32) {
+			s := []byte(toString(h.loadValue(sp + 8)))
+			h.storeValue(sp+16, h.newBytes(s))
+			h.setInt64(sp+24, int64(len(s)))
+		},
+		"syscall/js.valueLoadString": func(sp uint32) {
+			if b, ok := h.loadValue(sp + 8).(*object); ok && b.isBytes {
+				copy(h.loadSlice(sp+16), b.bytes)
+			}
+		},
+		"syscall/js.valueInstanceOf": func(sp uint32) {
+			h.setBool(sp+24, h.instanceOf(h.loadValue(sp+8), h.loadValue(sp+16)))
+		},
+		"syscall/js.copyBytesToGo": func(sp uint32) {
+			dst := h.loadSlice(sp + 8)
+			src, ok := h.loadValue(sp + 32).(*object)
+			if !ok || !src.isBytes {
+				h.setBool(sp+48, false)
+				return
+			}
+			h.setInt64(sp+40, int64(copy(dst, src.bytes)))
+			h.setBool(sp+48, true)
+		},
+		"syscall/js.copyBytesToJS": func(sp uint32) {
+			dst, ok := h.loadValue(sp + 8).(*object)
+			if !ok || !dst.isBytes {
+				h.setBool(sp+48, false)
+				return
+			}
+			h.setInt64(sp+40, int64(copy(dst.bytes, h.loadSlice(sp+16))))
+			h.setBool(sp+48, true)
+		},
+		"debug": func(sp uint32) {
+			h.log(h.stdout, []value{float64(int32(sp))})
+		},
+	}[name]
+	if !ok {
+		return nil
+	}
+	return func(args []uint64) []uint64 {
+		if len(args) != 1 {
+			panic(trap(fmt.Sprintf("bad call to %s.%s", module, name)))
+		}
+		f(uint32(args[0]))
+		return nil
+	}
+}
+
+// catch stores the result of f, or the exception it throws, and whether it succeeded in the Go
+// stack at offset.
+func (h *host) catch(offset uint32, f func() value) {
+	result, ok := func() (result value, ok bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				t, isThrown := r.(thrown)
+				if !isThrown {
+					panic(r)
+				}
+				result = t.v
+			}
+		}()
+		return f(), true
+	}()
+	sp := h.sp()
+	h.storeValue(sp+offset, result)
+	h.setBool(sp+offset+8, ok)
+}
+
+// index returns the element i of v, like Reflect.get with a number.
+func (h *host) index(v value, i int64) value {
+	if o, ok := v.(*object); ok && (o.isArray || o.isBytes) {
+		if i < 0 {
+			return nil
+		}
+		return o.index(int(i))
+	}
+	return h.get(v, numberString(float64(i)))
+}
+
+// setIndex sets the element i of v, like Reflect.set with a number.
+func (h *host) setIndex(v value, i int64, x value) {
+	if o, ok := v.(*object); ok && (o.isArray || o.isBytes) && i >= 0 {
+		o.setIndex(int(i), x)
+		return
+	}
+	h.set(v, numberString(float64(i)), x)
+}
+
+// loadValue decodes a reference. Numbers are stored as themselves, other values as a NaN with the
+// reference id in the lower half.
+func (h *host) loadValue(addr uint32) value {
+	bits := binary.LittleEndian.Uint64(h.slice(addr, 8))
+	f := math.Float64frombits(bits)
+	if f == 0 {
+		return nil
+	}
+	if f == f {
+		return f
+	}
+	id := int(uint32(bits))
+	if id >= len(h.values) {
+		return nil
+	}
+	return h.values[id]
+}
+
+// storeValue stores v as a reference, adding it to the values Go has references to.
+func (h *host) storeValue(addr uint32, v value) {
+	if f, ok := v.(float64); ok && f != 0 {
+		if f != f {
+			h.setUint32(addr+4, nanHead)
+			h.setUint32(addr, 0)
+			return
+		}
+		binary.LittleEndian.PutUint64(h.slice(addr, 8), math.Float64bits(f))
+		return
+	}
+	if v == nil {
+		binary.LittleEndian.PutUint64(h.slice(addr, 8), 0)
+		return
+	}
+	id, ok := h.ids[v]
+	if !ok {
+		if n := len(h.pool); n > 0 {
+			id = h.pool[n-1]
+			h.pool = h.pool[:n-1]
+			h.values[id], h.counts[id] = v, 0
+		} else {
+			id = len(h.values)
+			h.values = append(h.values, v)
+			h.counts = append(h.counts, 0)
+		}
+		h.ids[v] = id
+	}
+	if h.counts[id] >= 0 {
+		h.counts[id]++
+	}
+	h.setUint32(addr+4, nanHead|typeFlag(v, h.legacyFlags))
+	h.setUint32(addr, uint32(id))
+}
+
+func (h *host) loadSlice(addr uint32) []byte {
+	return h.bytesAt(h.getInt64(addr), h.getInt64(addr+8))
+}
+
+func (h *host) loadSliceOfValues(addr uint32) []value {
+	array, n := h.getInt64(addr), h.getInt64(addr+8)
+	if n < 0 || n > int64(len(h.vm.mem))/8 {
+		panic(trapMemory)
+	}
+	h.bytesAt(array, n*8)
+	values := make([]value, n)
+	for i := range values {
+		values[i] = h.loadValue(uint32(array) + uint32(i)*8)
+	}
+	return values
+}
+
+func (h *host) loadString(addr uint32) string {
+	b := h.loadSlice(addr)
+	if !utf8.Valid(b) {
+		// TextDecoder replaces invalid sequences
+		return string([]rune(string(b)))
+	}
+	return string(b)
+}
+
+// slice returns n bytes of linear memory at addr.
+func (h *host) slice(addr, n uint32) []byte {
+	return h.bytesAt(int64(addr), int64(n))
+}
+
+// bytesAt returns n bytes of linear memory at p, for pointers and lengths read from Go values.
+func (h *host) bytesAt(p, n int64) []byte {
+	if p < 0 || n < 0 || p+n > int64(len(h.vm.mem)) {
+		panic(trapMemory)
+	}
+	return h.vm.mem[p : p+n]
+}
+
+func (h *host) getUint32(addr uint32) uint32 {
+	return binary.LittleEndian.Uint32(h.slice(addr, 4))
+}
+
+func (h *host) getInt32(addr uint32) int32 {
+	return int32(h.getUint32(addr))
+}
+
+func (h *host) getInt64(addr uint32) int64 {
+	return int64(binary.LittleEndian.Uint64(h.slice(addr, 8)))
+}
+
+func (h *host) setUint32(addr, v uint32) {
+	binary.LittleEndian.PutUint32(h.slice(addr, 4), v)
+}
+
+func (h *host) setInt32(addr uint32, v int32) {
+	h.setUint32(addr, uint32(v))
+}
+
+func (h *host) setInt64(addr uint32, v int64) {
+	binary.LittleEndian.PutUint64(h.slice(addr, 8), uint64(v))
+}
+
+func (h *host) setBool(addr uint32, v bool) {
+	h.slice(addr, 1)[0] = byte(b2u(v))
+}
@@ -0,0 +1,335 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// value is a JavaScript value: nil (undefined), null, bool, float64, string or *object.
+type value interface{}
+
+type nullValue struct{}
+
+var null value = nullValue{}
+
+// object is a JavaScript object. Functions are objects with call set, and constructors also have
+// construct set.
+type object struct {
+	props     map[string]value
+	proto     *object
+	call      func(this value, args []value) value
+	construct func(args []value) value
+	array     []value   // the elements of an Array
+	bytes     []byte    // the contents of a Uint8Array
+	date      time.Time // the time of a Date
+	isArray   bool
+	isBytes   bool
+}
+
+func newObject(proto *object) *object {
+	return &object{props: map[string]value{}, proto: proto}
+}
+
+// thrown is the panic value of a JavaScript exception. Exceptions are caught by the functions of the
+// go import module that catch them in wasm_exec.js, and otherwise unwind to Run.
+type thrown struct {
+	v value
+}
+
+func throw(v value) {
+	panic(thrown{v})
+}
+
+// get returns the property of v, like Reflect.get.
+func (h *host) get(v value, key string) value {
+	switch v := v.(type) {
+	case *object:
+		if v.isArray || v.isBytes {
+			if key == "length" || (v.isBytes && key == "byteLength") {
+				return float64(v.length())
+			}
+			if i, ok := arrayIndex(key); ok {
+				return v.index(i)
+			}
+		}
+		return v.lookup(key)
+	case string:
+		if key == "length" {
+			return float64(len(utf16.Encode([]rune(v))))
+		}
+		return nil
+	case nil, nullValue:
+		throw(h.typeError("Cannot read properties of %s (reading '%s')", toString(v), key))
+	}
+	return nil
+}
+
+// set sets the property of v, like Reflect.set.
+func (h *host) set(v value, key string, x value) {
+	switch v := v.(type) {
+	case *object:
+		if v.isArray || v.isBytes {
+			if i, ok := arrayIndex(key); ok {
+				v.setIndex(i, x)
+				return
+			}
+			if v.isArray && key == "length" {
+				n, _ := x.(float64)
+				v.array = append(v.array, make([]value, int(math.Max(n-float64(len(v.array)), 0)))...)[:int(math.Max(n, 0))]
+				return
+			}
+		}
+		v.props[key] = x
+	case nil, nullValue:
+		throw(h.typeError("Cannot set properties of %s (setting '%s')", toString(v), key))
+	}
+}
+
+func (o *object) length() int {
+	if o.isBytes {
+		return len(o.bytes)
+	}
+	return len(o.array)
+}
+
+func (o *object) index(i int) value {
+	switch {
+	case i >= o.length():
+		return nil
+	case o.isBytes:
+		return float64(o.bytes[i])
+	}
+	return o.array[i]
+}
+
+func (o *object) setIndex(i int, x value) {
+	if o.isBytes {
+		if i < len(o.bytes) {
+			o.bytes[i] = byte(int64(toNumber(x)))
+		}
+		return
+	}
+	if i >= len(o.array) {
+		o.array = append(o.array, make([]value, i+1-len(o.array))...)
+	}
+	o.array[i] = x
+}
+
+// arrayIndex converts a property key to an array index.
+func arrayIndex(key string) (int, bool) {
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 || strconv.Itoa(i) != key {
+		return 0, false
+	}
+	return i, true
+}
+
+// callValue calls f, like Reflect.apply.
+func (h *host) callValue(f, this value, args []value) value {
+	o, ok := f.(*object)
+	if !ok || o.call == nil {
+		throw(h.typeError("%s is not a function", toString(f)))
+	}
+	return o.call(this, args)
+}
+
+// construct calls the constructor c, like Reflect.construct.
+func (h *host) construct(c value, args []value) value {
+	o, ok := c.(*object)
+	if !ok || o.construct == nil {
+		throw(h.typeError("%s is not a constructor", toString(c)))
+	}
+	return o.construct(args)
+}
+
+// instanceOf reports whether the prototype of the constructor c is in the prototype chain of v.
+func (h *host) instanceOf(v, c value) bool {
+	o, ok := c.(*object)
+	if !ok || o.call == nil {
+		throw(h.typeError("Right-hand side of 'instanceof' is not callable"))
+	}
+	proto, _ := o.props["prototype"].(*object)
+	obj, ok := v.(*object)
+	if !ok || proto == nil {
+		return false
+	}
+	for p := obj.proto; p != nil; p = p.proto {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
+
+// typeFlag returns the type of v, encoded as in the NaN boxed references of wasm_exec.js.
+func typeFlag(v value, legacy bool) uint32 {
+	o, isObject := v.(*object)
+	_, isString := v.(string)
+	switch {
+	case legacy && isString:
+		return 1
+	case legacy && isObject && o.call != nil:
+		return 3
+	case legacy:
+		return 0
+	case isString:
+		return 2
+	case isObject && o.call != nil:
+		return 4
+	case isObject:
+		return 1
+	}
+	return 0
+}
+
+// toString converts v to a string, like String(v).
+func toString(v value) string {
+	switch v := v.(type) {
+	case nil:
+		return "undefined"
+	case nullValue:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return numberString(v)
+	case string:
+		return v
+	case *object:
+		switch {
+		case v.call != nil:
+			return "function () { [native code] }"
+		case v.isBytes:
+			parts := make([]string, len(v.bytes))
+			for i, b := range v.bytes {
+				parts[i] = strconv.Itoa(int(b))
+			}
+			return strings.Join(parts, ",")
+		case v.isArray:
+			parts := make([]string, len(v.array))
+			for i, e := range v.array {
+				if e != nil && e != null {
+					parts[i] = toString(e)
+				}
+			}
+			return strings.Join(parts, ",")
+		}
+		if s, ok := v.lookup("toString").(*object); ok && s.call != nil {
+			return toString(s.call(v, nil))
+		}
+		return "[object Object]"
+	}
+	return ""
+}
+
+// lookup returns a property from the prototype chain of o.
+func (o *object) lookup(key string) value {
+	for ; o != nil; o = o.proto {
+		if p, ok := o.props[key]; ok {
+			return p
+		}
+	}
+	return nil
+}
+
+func numberString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == math.Trunc(f) && math.Abs(f) < 1e21:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// toNumber converts v to a number, like Number(v).
+func toNumber(v value) float64 {
+	switch v := v.(type) {
+	case nullValue:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return math.NaN()
+}
+
+// fn returns a function object.
+func (h *host) fn(call func(this value, args []value) value) *object {
+	o := newObject(h.functionProto)
+	o.call = call
+	return o
+}
+
+// class returns a constructor for objects with the prototype proto. Like the built in
+// constructors, calling it without new constructs too.
+func (h *host) class(name string, proto *object, construct func(args []value) value) *object {
+	c := h.fn(func(this value, args []value) value {
+		return construct(args)
+	})
+	c.construct = construct
+	c.props["prototype"] = proto
+	c.props["name"] = name
+	proto.props["constructor"] = c
+	return c
+}
+
+func (h *host) newArray(elements []value) *object {
+	o := newObject(h.arrayProto)
+	o.isArray = true
+	o.array = elements
+	return o
+}
+
+func (h *host) newBytes(b []byte) *object {
+	o := newObject(h.bytesProto)
+	o.isBytes = true
+	o.bytes = b
+	return o
+}
+
+func (h *host) newError(proto *object, message string) *object {
+	e := newObject(proto)
+	e.props["message"] = message
+	e.props["stack"] = toString(proto.lookup("name")) + ": " + message
+	return e
+}
+
+func (h *host) typeError(format string, args ...interface{}) *object {
+	return h.newError(h.typeErrorProto, fmt.Sprintf(format, args...))
+}
+
+// enosys returns the error that wasm_exec.js gives to the callbacks of unsupported fs functions.
+func (h *host) enosys() *object {
+	e := h.newError(h.errorProto, "not implemented")
+	e.props["code"] = "ENOSYS"
+	return e
+}
+
+// arg returns the argument i, or undefined.
+func arg(args []value, i int) value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
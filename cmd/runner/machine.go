@@ -0,0 +1,830 @@
+package runner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// machine is an instance of a module. Values on the stack are stored as uint64: i32 values are zero
+// extended, and floats are stored as their bits.
+type machine struct {
+	funcs   []*function
+	table   []*function
+	globals []uint64
+	mem     []byte
+	pages   uint32 // maximum size of the memory
+	exports map[string]export
+	stack   []uint64
+	top     int // top of the stack while a host function runs, where nested calls start
+	depth   int // number of wasm calls on the Go stack
+}
+
+// trap is the panic value of a wasm trap. Traps and the exit of the program unwind the Go stack to
+// Run.
+type trap string
+
+func (t trap) Error() string {
+	return "wasm trap: " + string(t)
+}
+
+const (
+	trapUnreachable   = trap("unreachable executed")
+	trapMemory        = trap("out of bounds memory access")
+	trapDivideByZero  = trap("integer divide by zero")
+	trapOverflow      = trap("integer overflow")
+	trapConversion    = trap("invalid conversion to integer")
+	trapElement       = trap("undefined table element")
+	trapSignature     = trap("indirect call signature mismatch")
+	trapStackExceeded = trap("call stack exhausted")
+)
+
+// maxDepth limits the depth of wasm calls, so runaway recursion traps before the Go stack
+// overflows.
+const maxDepth = 50000
+
+// instantiate compiles the functions of the module and initializes the memory, table and globals.
+// Imported functions are given by the imports callback.
+func instantiate(m *module, imports func(module, name string) func(args []uint64) []uint64) (*machine, error) {
+	vm := &machine{exports: m.exports, stack: make([]uint64, 1<<16), pages: maxPages}
+	for _, i := range m.imports {
+		host := imports(i.module, i.name)
+		if host == nil {
+			return nil, fmt.Errorf("unsupported import %s.%s", i.module, i.name)
+		}
+		sig := m.types[i.typ]
+		vm.funcs = append(vm.funcs, &function{
+			typ:     canonicalType(m, i.typ),
+			params:  len(sig.params),
+			results: len(sig.results),
+			host:    host,
+		})
+	}
+	types := make([]uint32, len(m.types))
+	for i := range m.types {
+		types[i] = canonicalType(m, uint32(i))
+	}
+	for i, typ := range m.funcs {
+		f, err := compile(m, i, types[typ])
+		if err != nil {
+			return nil, err
+		}
+		vm.funcs = append(vm.funcs, f)
+	}
+
+	vm.table = make([]*function, m.table)
+	for _, e := range m.elements {
+		if uint64(e.offset)+uint64(len(e.funcs)) > uint64(len(vm.table)) {
+			return nil, fmt.Errorf("element segment out of range")
+		}
+		for i, index := range e.funcs {
+			if int(index) >= len(vm.funcs) {
+				return nil, fmt.Errorf("element segment refers to unknown function %d", index)
+			}
+			vm.table[int(e.offset)+i] = vm.funcs[index]
+		}
+	}
+
+	for _, g := range m.globals {
+		vm.globals = append(vm.globals, g.init)
+	}
+
+	if m.memory.HasMax {
+		vm.pages = m.memory.Max
+	}
+	vm.mem = make([]byte, int(m.memory.Min)*pageSize)
+	for _, s := range m.segments {
+		if uint64(s.addr)+uint64(len(s.data)) > uint64(len(vm.mem)) {
+			return nil, fmt.Errorf("data segment out of range")
+		}
+		copy(vm.mem[s.addr:], s.data)
+	}
+	return vm, nil
+}
+
+// invoke calls an exported function. Calls from host functions start above the stack of the
+// calling function.
+func (vm *machine) invoke(name string, args ...uint64) []uint64 {
+	e, ok := vm.exports[name]
+	if !ok || e.kind != kindFunc {
+		panic(fmt.Errorf("no exported function %s", name))
+	}
+	f := vm.funcs[e.index]
+	base, depth := vm.top, vm.depth
+	if len(args) != f.params || base+len(args)+f.results > len(vm.stack) {
+		panic(fmt.Errorf("bad call to %s", name))
+	}
+	// a JavaScript exception thrown through wasm frames unwinds them, like in a browser
+	defer func() {
+		vm.top, vm.depth = base, depth
+	}()
+	copy(vm.stack[base:], args)
+	sp := vm.call(f, base+len(args))
+	return append([]uint64(nil), vm.stack[base:sp]...)
+}
+
+// call calls f with its arguments at the top of the stack, and returns the new top of the stack
+// after they're replaced by the results.
+func (vm *machine) call(f *function, sp int) int {
+	fp := sp - f.params
+	if f.host != nil {
+		top := vm.top
+		vm.top = sp
+		results := f.host(vm.stack[fp:sp])
+		vm.top = top
+		copy(vm.stack[fp:], results)
+		return fp + len(results)
+	}
+	vm.depth++
+	if vm.depth > maxDepth {
+		panic(trapStackExceeded)
+	}
+	if need := fp + f.locals + f.height; need > len(vm.stack) {
+		stack := make([]uint64, 2*need)
+		copy(stack, vm.stack[:sp])
+		vm.stack = stack
+	}
+	locals := vm.stack[sp : fp+f.locals]
+	for i := range locals {
+		locals[i] = 0
+	}
+	vm.exec(f, fp)
+	vm.depth--
+	return fp + f.results
+}
+
+// exec runs the code of f, with the locals starting at fp.
+func (vm *machine) exec(f *function, fp int) {
+	code := f.code
+	stack := vm.stack
+	mem := vm.mem
+	sp := fp + f.locals
+	pc := 0
+	for {
+		in := &code[pc]
+		pc++
+		switch in.op {
+		case opUnreachable:
+			panic(trapUnreachable)
+		case opIf:
+			sp--
+			if uint32(stack[sp]) == 0 {
+				pc = int(in.a)
+			}
+		case opElse:
+			pc = int(in.a)
+		case opBr:
+			if in.b != 0 {
+				copy(stack[sp-int(in.keep)-int(in.b):], stack[sp-int(in.keep):sp])
+				sp -= int(in.b)
+			}
+			pc = int(in.a)
+		case opBrIf:
+			sp--
+			if uint32(stack[sp]) != 0 {
+				if in.b != 0 {
+					copy(stack[sp-int(in.keep)-int(in.b):], stack[sp-int(in.keep):sp])
+					sp -= int(in.b)
+				}
+				pc = int(in.a)
+			}
+		case opBrTable:
+			sp--
+			table := f.tables[in.a]
+			i := uint64(uint32(stack[sp]))
+			if i >= uint64(len(table)) {
+				i = uint64(len(table) - 1)
+			}
+			b := table[i]
+			if b.drop != 0 {
+				copy(stack[sp-int(b.keep)-int(b.drop):], stack[sp-int(b.keep):sp])
+				sp -= int(b.drop)
+			}
+			pc = int(b.target)
+		case opReturn:
+			copy(stack[fp:], stack[sp-f.results:sp])
+			return
+		case opCall:
+			sp = vm.call(vm.funcs[in.a], sp)
+			stack, mem = vm.stack, vm.mem
+		case opCallIndirect:
+			sp--
+			i := uint64(uint32(stack[sp]))
+			if i >= uint64(len(vm.table)) || vm.table[i] == nil {
+				panic(trapElement)
+			}
+			callee := vm.table[i]
+			if callee.typ != in.a {
+				panic(trapSignature)
+			}
+			sp = vm.call(callee, sp)
+			stack, mem = vm.stack, vm.mem
+		case opDrop:
+			sp--
+		case opSelect:
+			sp -= 2
+			if uint32(stack[sp+1]) == 0 {
+				stack[sp-1] = stack[sp]
+			}
+
+		case opLocalGet:
+			stack[sp] = stack[fp+int(in.a)]
+			sp++
+		case opLocalSet:
+			sp--
+			stack[fp+int(in.a)] = stack[sp]
+		case opLocalTee:
+			stack[fp+int(in.a)] = stack[sp-1]
+		case opGlobalGet:
+			stack[sp] = vm.globals[in.a]
+			sp++
+		case opGlobalSet:
+			sp--
+			vm.globals[in.a] = stack[sp]
+
+		case 0x28: // i32.load
+			stack[sp-1] = uint64(binary.LittleEndian.Uint32(access(mem, stack[sp-1], in.a, 4)))
+		case 0x29: // i64.load
+			stack[sp-1] = binary.LittleEndian.Uint64(access(mem, stack[sp-1], in.a, 8))
+		case 0x2a: // f32.load
+			stack[sp-1] = uint64(binary.LittleEndian.Uint32(access(mem, stack[sp-1], in.a, 4)))
+		case 0x2b: // f64.load
+			stack[sp-1] = binary.LittleEndian.Uint64(access(mem, stack[sp-1], in.a, 8))
+		case 0x2c: // i32.load8_s
+			stack[sp-1] = uint64(uint32(int8(access(mem, stack[sp-1], in.a, 1)[0])))
+		case 0x2d: // i32.load8_u
+			stack[sp-1] = uint64(access(mem, stack[sp-1], in.a, 1)[0])
+		case 0x2e: // i32.load16_s
+			stack[sp-1] = uint64(uint32(int16(binary.LittleEndian.Uint16(access(mem, stack[sp-1], in.a, 2)))))
+		case 0x2f: // i32.load16_u
+			stack[sp-1] = uint64(binary.LittleEndian.Uint16(access(mem, stack[sp-1], in.a, 2)))
+		case 0x30: // i64.load8_s
+			stack[sp-1] = uint64(int8(access(mem, stack[sp-1], in.a, 1)[0]))
+		case 0x31: // i64.load8_u
+			stack[sp-1] = uint64(access(mem, stack[sp-1], in.a, 1)[0])
+		case 0x32: // i64.load16_s
+			stack[sp-1] = uint64(int16(binary.LittleEndian.Uint16(access(mem, stack[sp-1], in.a, 2))))
+		case 0x33: // i64.load16_u
+			stack[sp-1] = uint64(binary.LittleEndian.Uint16(access(mem, stack[sp-1], in.a, 2)))
+		case 0x34: // i64.load32_s
+			stack[sp-1] = uint64(int32(binary.LittleEndian.Uint32(access(mem, stack[sp-1], in.a, 4))))
+		case 0x35: // i64.load32_u
+			stack[sp-1] = uint64(binary.LittleEndian.Uint32(access(mem, stack[sp-1], in.a, 4)))
+		case 0x36, 0x38, 0x3e: // i32.store, f32.store, i64.store32
+			sp -= 2
+			binary.LittleEndian.PutUint32(access(mem, stack[sp], in.a, 4), uint32(stack[sp+1]))
+		case 0x37, 0x39: // i64.store, f64.store
+			sp -= 2
+			binary.LittleEndian.PutUint64(access(mem, stack[sp], in.a, 8), stack[sp+1])
+		case 0x3a, 0x3c: // i32.store8, i64.store8
+			sp -= 2
+			access(mem, stack[sp], in.a, 1)[0] = byte(stack[sp+1])
+		case 0x3b, 0x3d: // i32.store16, i64.store16
+			sp -= 2
+			binary.LittleEndian.PutUint16(access(mem, stack[sp], in.a, 2), uint16(stack[sp+1]))
+		case opMemorySize:
+			stack[sp] = uint64(len(mem) / pageSize)
+			sp++
+		case opMemoryGrow:
+			stack[sp-1] = uint64(vm.grow(uint32(stack[sp-1])))
+			mem = vm.mem
+
+		case opI32Const, opI64Const, opF32Const, opF64Const:
+			stack[sp] = in.b
+			sp++
+
+		case 0x45: // i32.eqz
+			stack[sp-1] = b2u(uint32(stack[sp-1]) == 0)
+		case 0x46: // i32.eq
+			sp--
+			stack[sp-1] = b2u(uint32(stack[sp-1]) == uint32(stack[sp]))
+		case 0x47: // i32.ne
+			sp--
+			stack[sp-1] = b2u(uint32(stack[sp-1]) != uint32(stack[sp]))
+		case 0x48: // i32.lt_s
+			sp--
+			stack[sp-1] = b2u(int32(stack[sp-1]) < int32(stack[sp]))
+		case 0x49: // i32.lt_u
+			sp--
+			stack[sp-1] = b2u(uint32(stack[sp-1]) < uint32(stack[sp]))
+		case 0x4a: // i32.gt_s
+			sp--
+			stack[sp-1] = b2u(int32(stack[sp-1]) > int32(stack[sp]))
+		case 0x4b: // i32.gt_u
+			sp--
+			stack[sp-1] = b2u(uint32(stack[sp-1]) > uint32(stack[sp]))
+		case 0x4c: // i32.le_s
+			sp--
+			stack[sp-1] = b2u(int32(stack[sp-1]) <= int32(stack[sp]))
+		case 0x4d: // i32.le_u
+			sp--
+			stack[sp-1] = b2u(uint32(stack[sp-1]) <= uint32(stack[sp]))
+		case 0x4e: // i32.ge_s
+			sp--
+			stack[sp-1] = b2u(int32(stack[sp-1]) >= int32(stack[sp]))
+		case 0x4f: // i32.ge_u
+			sp--
+			stack[sp-1] = b2u(uint32(stack[sp-1]) >= uint32(stack[sp]))
+
+		case 0x50: // i64.eqz
+			stack[sp-1] = b2u(stack[sp-1] == 0)
+		case 0x51: // i64.eq
+			sp--
+			stack[sp-1] = b2u(stack[sp-1] == stack[sp])
+		case 0x52: // i64.ne
+			sp--
+			stack[sp-1] = b2u(stack[sp-1] != stack[sp])
+		case 0x53: // i64.lt_s
+			sp--
+			stack[sp-1] = b2u(int64(stack[sp-1]) < int64(stack[sp]))
+		case 0x54: // i64.lt_u
+			sp--
+			stack[sp-1] = b2u(stack[sp-1] < stack[sp])
+		case 0x55: // i64.gt_s
+			sp--
+			stack[sp-1] = b2u(int64(stack[sp-1]) > int64(stack[sp]))
+		case 0x56: // i64.gt_u
+			sp--
+			stack[sp-1] = b2u(stack[sp-1] > stack[sp])
+		case 0x57: // i64.le_s
+			sp--
+			stack[sp-1] = b2u(int64(stack[sp-1]) <= int64(stack[sp]))
+		case 0x58: // i64.le_u
+			sp--
+			stack[sp-1] = b2u(stack[sp-1] <= stack[sp])
+		case 0x59: // i64.ge_s
+			sp--
+			stack[sp-1] = b2u(int64(stack[sp-1]) >= int64(stack[sp]))
+		case 0x5a: // i64.ge_u
+			sp--
+			stack[sp-1] = b2u(stack[sp-1] >= stack[sp])
+
+		case 0x5b: // f32.eq
+			sp--
+			stack[sp-1] = b2u(f32(stack[sp-1]) == f32(stack[sp]))
+		case 0x5c: // f32.ne
+			sp--
+			stack[sp-1] = b2u(f32(stack[sp-1]) != f32(stack[sp]))
+		case 0x5d: // f32.lt
+			sp--
+			stack[sp-1] = b2u(f32(stack[sp-1]) < f32(stack[sp]))
+		case 0x5e: // f32.gt
+			sp--
+			stack[sp-1] = b2u(f32(stack[sp-1]) > f32(stack[sp]))
+		case 0x5f: // f32.le
+			sp--
+			stack[sp-1] = b2u(f32(stack[sp-1]) <= f32(stack[sp]))
+		case 0x60: // f32.ge
+			sp--
+			stack[sp-1] = b2u(f32(stack[sp-1]) >= f32(stack[sp]))
+		case 0x61: // f64.eq
+			sp--
+			stack[sp-1] = b2u(f64(stack[sp-1]) == f64(stack[sp]))
+		case 0x62: // f64.ne
+			sp--
+			stack[sp-1] = b2u(f64(stack[sp-1]) != f64(stack[sp]))
+		case 0x63: // f64.lt
+			sp--
+			stack[sp-1] = b2u(f64(stack[sp-1]) < f64(stack[sp]))
+		case 0x64: // f64.gt
+			sp--
+			stack[sp-1] = b2u(f64(stack[sp-1]) > f64(stack[sp]))
+		case 0x65: // f64.le
+			sp--
+			stack[sp-1] = b2u(f64(stack[sp-1]) <= f64(stack[sp]))
+		case 0x66: // f64.ge
+			sp--
+			stack[sp-1] = b2u(f64(stack[sp-1]) >= f64(stack[sp]))
+
+		case 0x67: // i32.clz
+			stack[sp-1] = uint64(bits.LeadingZeros32(uint32(stack[sp-1])))
+		case 0x68: // i32.ctz
+			stack[sp-1] = uint64(bits.TrailingZeros32(uint32(stack[sp-1])))
+		case 0x69: // i32.popcnt
+			stack[sp-1] = uint64(bits.OnesCount32(uint32(stack[sp-1])))
+		case 0x6a: // i32.add
+			sp--
+			stack[sp-1] = uint64(uint32(stack[sp-1]) + uint32(stack[sp]))
+		case 0x6b: // i32.sub
+			sp--
+			stack[sp-1] = uint64(uint32(stack[sp-1]) - uint32(stack[sp]))
+		case 0x6c: // i32.mul
+			sp--
+			stack[sp-1] = uint64(uint32(stack[sp-1]) * uint32(stack[sp]))
+		case 0x6d: // i32.div_s
+			sp--
+			x, y := int32(stack[sp-1]), int32(stack[sp])
+			if y == 0 {
+				panic(trapDivideByZero)
+			}
+			if x == math.MinInt32 && y == -1 {
+				panic(trapOverflow)
+			}
+			stack[sp-1] = uint64(uint32(x / y))
+		case 0x6e: // i32.div_u
+			sp--
+			x, y := uint32(stack[sp-1]), uint32(stack[sp])
+			if y == 0 {
+				panic(trapDivideByZero)
+			}
+			stack[sp-1] = uint64(x / y)
+		case 0x6f: // i32.rem_s
+			sp--
+			x, y := int32(stack[sp-1]), int32(stack[sp])
+			if y == 0 {
+				panic(trapDivideByZero)
+			}
+			stack[sp-1] = uint64(uint32(x % y))
+		case 0x70: // i32.rem_u
+			sp--
+			x, y := uint32(stack[sp-1]), uint32(stack[sp])
+			if y == 0 {
+				panic(trapDivideByZero)
+			}
+			stack[sp-1] = uint64(x % y)
+		case 0x71: // i32.and
+			sp--
+			stack[sp-1] = uint64(uint32(stack[sp-1]) & uint32(stack[sp]))
+		case 0x72: // i32.or
+			sp--
+			stack[sp-1] = uint64(uint32(stack[sp-1]) | uint32(stack[sp]))
+		case 0x73: // i32.xor
+			sp--
+			stack[sp-1] = uint64(uint32(stack[sp-1]) ^ uint32(stack[sp]))
+		case 0x74: // i32.shl
+			sp--
+			stack[sp-1] = uint64(uint32(stack[sp-1]) << (stack[sp] & 31))
+		case 0x75: // i32.shr_s
+			sp--
+			stack[sp-1] = uint64(uint32(int32(stack[sp-1]) >> (stack[sp] & 31)))
+		case 0x76: // i32.shr_u
+			sp--
+			stack[sp-1] = uint64(uint32(stack[sp-1]) >> (stack[sp] & 31))
+		case 0x77: // i32.rotl
+			sp--
+			stack[sp-1] = uint64(bits.RotateLeft32(uint32(stack[sp-1]), int(stack[sp]&31)))
+		case 0x78: // i32.rotr
+			sp--
+			stack[sp-1] = uint64(bits.RotateLeft32(uint32(stack[sp-1]), -int(stack[sp]&31)))
+
+		case 0x79: // i64.clz
+			stack[sp-1] = uint64(bits.LeadingZeros64(stack[sp-1]))
+		case 0x7a: // i64.ctz
+			stack[sp-1] = uint64(bits.TrailingZeros64(stack[sp-1]))
+		case 0x7b: // i64.popcnt
+			stack[sp-1] = uint64(bits.OnesCount64(stack[sp-1]))
+		case 0x7c: // i64.add
+			sp--
+			stack[sp-1] += stack[sp]
+		case 0x7d: // i64.sub
+			sp--
+			stack[sp-1] -= stack[sp]
+		case 0x7e: // i64.mul
+			sp--
+			stack[sp-1] *= stack[sp]
+		case 0x7f: // i64.div_s
+			sp--
+			x, y := int64(stack[sp-1]), int64(stack[sp])
+			if y == 0 {
+				panic(trapDivideByZero)
+			}
+			if x == math.MinInt64 && y == -1 {
+				panic(trapOverflow)
+			}
+			stack[sp-1] = uint64(x / y)
+		case 0x80: // i64.div_u
+			sp--
+			if stack[sp] == 0 {
+				panic(trapDivideByZero)
+			}
+			stack[sp-1] /= stack[sp]
+		case 0x81: // i64.rem_s
+			sp--
+			x, y := int64(stack[sp-1]), int64(stack[sp])
+			if y == 0 {
+				panic(trapDivideByZero)
+			}
+			stack[sp-1] = uint64(x % y)
+		case 0x82: // i64.rem_u
+			sp--
+			if stack[sp] == 0 {
+				panic(trapDivideByZero)
+			}
+			stack[sp-1] %= stack[sp]
+		case 0x83: // i64.and
+			sp--
+			stack[sp-1] &= stack[sp]
+		case 0x84: // i64.or
+			sp--
+			stack[sp-1] |= stack[sp]
+		case 0x85: // i64.xor
+			sp--
+			stack[sp-1] ^= stack[sp]
+		case 0x86: // i64.shl
+			sp--
+			stack[sp-1] <<= stack[sp] & 63
+		case 0x87: // i64.shr_s
+			sp--
+			stack[sp-1] = uint64(int64(stack[sp-1]) >> (stack[sp] & 63))
+		case 0x88: // i64.shr_u
+			sp--
+			stack[sp-1] >>= stack[sp] & 63
+		case 0x89: // i64.rotl
+			sp--
+			stack[sp-1] = bits.RotateLeft64(stack[sp-1], int(stack[sp]&63))
+		case 0x8a: // i64.rotr
+			sp--
+			stack[sp-1] = bits.RotateLeft64(stack[sp-1], -int(stack[sp]&63))
+
+		case 0x8b: // f32.abs
+			stack[sp-1] &^= 1 << 31
+		case 0x8c: // f32.neg
+			stack[sp-1] ^= 1 << 31
+		case 0x8d: // f32.ceil
+			stack[sp-1] = fromF32(float32(math.Ceil(float64(f32(stack[sp-1])))))
+		case 0x8e: // f32.floor
+			stack[sp-1] = fromF32(float32(math.Floor(float64(f32(stack[sp-1])))))
+		case 0x8f: // f32.trunc
+			stack[sp-1] = fromF32(float32(math.Trunc(float64(f32(stack[sp-1])))))
+		case 0x90: // f32.nearest
+			stack[sp-1] = fromF32(float32(math.RoundToEven(float64(f32(stack[sp-1])))))
+		case 0x91: // f32.sqrt
+			stack[sp-1] = fromF32(float32(math.Sqrt(float64(f32(stack[sp-1])))))
+		case 0x92: // f32.add
+			sp--
+			stack[sp-1] = fromF32(f32(stack[sp-1]) + f32(stack[sp]))
+		case 0x93: // f32.sub
+			sp--
+			stack[sp-1] = fromF32(f32(stack[sp-1]) - f32(stack[sp]))
+		case 0x94: // f32.mul
+			sp--
+			stack[sp-1] = fromF32(f32(stack[sp-1]) * f32(stack[sp]))
+		case 0x95: // f32.div
+			sp--
+			stack[sp-1] = fromF32(f32(stack[sp-1]) / f32(stack[sp]))
+		case 0x96: // f32.min
+			sp--
+			stack[sp-1] = fromF32(float32(math.Min(float64(f32(stack[sp-1])), float64(f32(stack[sp])))))
+		case 0x97: // f32.max
+			sp--
+			stack[sp-1] = fromF32(float32(math.Max(float64(f32(stack[sp-1])), float64(f32(stack[sp])))))
+		case 0x98: // f32.copysign
+			sp--
+			stack[sp-1] = stack[sp-1]&^(1<<31) | stack[sp]&(1<<31)
+
+		case 0x99: // f64.abs
+			stack[sp-1] &^= 1 << 63
+		case 0x9a: // f64.neg
+			stack[sp-1] ^= 1 << 63
+		case 0x9b: // f64.ceil
+			stack[sp-1] = fromF64(math.Ceil(f64(stack[sp-1])))
+		case 0x9c: // f64.floor
+			stack[sp-1] = fromF64(math.Floor(f64(stack[sp-1])))
+		case 0x9d: // f64.trunc
+			stack[sp-1] = fromF64(math.Trunc(f64(stack[sp-1])))
+		case 0x9e: // f64.nearest
+			stack[sp-1] = fromF64(math.RoundToEven(f64(stack[sp-1])))
+		case 0x9f: // f64.sqrt
+			stack[sp-1] = fromF64(math.Sqrt(f64(stack[sp-1])))
+		case 0xa0: // f64.add
+			sp--
+			stack[sp-1] = fromF64(f64(stack[sp-1]) + f64(stack[sp]))
+		case 0xa1: // f64.sub
+			sp--
+			stack[sp-1] = fromF64(f64(stack[sp-1]) - f64(stack[sp]))
+		case 0xa2: // f64.mul
+			sp--
+			stack[sp-1] = fromF64(f64(stack[sp-1]) * f64(stack[sp]))
+		case 0xa3: // f64.div
+			sp--
+			stack[sp-1] = fromF64(f64(stack[sp-1]) / f64(stack[sp]))
+		case 0xa4: // f64.min
+			sp--
+			stack[sp-1] = fromF64(math.Min(f64(stack[sp-1]), f64(stack[sp])))
+		case 0xa5: // f64.max
+			sp--
+			stack[sp-1] = fromF64(math.Max(f64(stack[sp-1]), f64(stack[sp])))
+		case 0xa6: // f64.copysign
+			sp--
+			stack[sp-1] = stack[sp-1]&^(1<<63) | stack[sp]&(1<<63)
+
+		case 0xa7: // i32.wrap_i64
+			stack[sp-1] = uint64(uint32(stack[sp-1]))
+		case 0xa8: // i32.trunc_f32_s
+			stack[sp-1] = truncS32(float64(f32(stack[sp-1])))
+		case 0xa9: // i32.trunc_f32_u
+			stack[sp-1] = truncU32(float64(f32(stack[sp-1])))
+		case 0xaa: // i32.trunc_f64_s
+			stack[sp-1] = truncS32(f64(stack[sp-1]))
+		case 0xab: // i32.trunc_f64_u
+			stack[sp-1] = truncU32(f64(stack[sp-1]))
+		case 0xac: // i64.extend_i32_s
+			stack[sp-1] = uint64(int32(stack[sp-1]))
+		case 0xad: // i64.extend_i32_u
+			stack[sp-1] = uint64(uint32(stack[sp-1]))
+		case 0xae: // i64.trunc_f32_s
+			stack[sp-1] = truncS64(float64(f32(stack[sp-1])))
+		case 0xaf: // i64.trunc_f32_u
+			stack[sp-1] = truncU64(float64(f32(stack[sp-1])))
+		case 0xb0: // i64.trunc_f64_s
+			stack[sp-1] = truncS64(f64(stack[sp-1]))
+		case 0xb1: // i64.trunc_f64_u
+			stack[sp-1] = truncU64(f64(stack[sp-1]))
+		case 0xb2: // f32.convert_i32_s
+			stack[sp-1] = fromF32(float32(int32(stack[sp-1])))
+		case 0xb3: // f32.convert_i32_u
+			stack[sp-1] = fromF32(float32(uint32(stack[sp-1])))
+		case 0xb4: // f32.convert_i64_s
+			stack[sp-1] = fromF32(float32(int64(stack[sp-1])))
+		case 0xb5: // f32.convert_i64_u
+			stack[sp-1] = fromF32(float32(stack[sp-1]))
+		case 0xb6: // f32.demote_f64
+			stack[sp-1] = fromF32(float32(f64(stack[sp-1])))
+		case 0xb7: // f64.convert_i32_s
+			stack[sp-1] = fromF64(float64(int32(stack[sp-1])))
+		case 0xb8: // f64.convert_i32_u
+			stack[sp-1] = fromF64(float64(uint32(stack[sp-1])))
+		case 0xb9: // f64.convert_i64_s
+			stack[sp-1] = fromF64(float64(int64(stack[sp-1])))
+		case 0xba: // f64.convert_i64_u
+			stack[sp-1] = fromF64(float64(stack[sp-1]))
+		case 0xbb: // f64.promote_f32
+			stack[sp-1] = fromF64(float64(f32(stack[sp-1])))
+		case 0xbc, 0xbd, 0xbe, 0xbf: // reinterpretations
+		case 0xc0: // i32.extend8_s
+			stack[sp-1] = uint64(uint32(int8(stack[sp-1])))
+		case 0xc1: // i32.extend16_s
+			stack[sp-1] = uint64(uint32(int16(stack[sp-1])))
+		case 0xc2: // i64.extend8_s
+			stack[sp-1] = uint64(int8(stack[sp-1]))
+		case 0xc3: // i64.extend16_s
+			stack[sp-1] = uint64(int16(stack[sp-1]))
+		case 0xc4: // i64.extend32_s
+			stack[sp-1] = uint64(int32(stack[sp-1]))
+
+		case opMiscBase + 0: // i32.trunc_sat_f32_s
+			stack[sp-1] = satS32(float64(f32(stack[sp-1])))
+		case opMiscBase + 1: // i32.trunc_sat_f32_u
+			stack[sp-1] = satU32(float64(f32(stack[sp-1])))
+		case opMiscBase + 2: // i32.trunc_sat_f64_s
+			stack[sp-1] = satS32(f64(stack[sp-1]))
+		case opMiscBase + 3: // i32.trunc_sat_f64_u
+			stack[sp-1] = satU32(f64(stack[sp-1]))
+		case opMiscBase + 4: // i64.trunc_sat_f32_s
+			stack[sp-1] = satS64(float64(f32(stack[sp-1])))
+		case opMiscBase + 5: // i64.trunc_sat_f32_u
+			stack[sp-1] = satU64(float64(f32(stack[sp-1])))
+		case opMiscBase + 6: // i64.trunc_sat_f64_s
+			stack[sp-1] = satS64(f64(stack[sp-1]))
+		case opMiscBase + 7: // i64.trunc_sat_f64_u
+			stack[sp-1] = satU64(f64(stack[sp-1]))
+		case opMemoryCopy:
+			sp -= 3
+			dst, src, n := uint64(uint32(stack[sp])), uint64(uint32(stack[sp+1])), uint64(uint32(stack[sp+2]))
+			if src+n > uint64(len(mem)) || dst+n > uint64(len(mem)) {
+				panic(trapMemory)
+			}
+			copy(mem[dst:dst+n], mem[src:src+n])
+		case opMemoryFill:
+			sp -= 3
+			dst, v, n := uint64(uint32(stack[sp])), byte(stack[sp+1]), uint64(uint32(stack[sp+2]))
+			if dst+n > uint64(len(mem)) {
+				panic(trapMemory)
+			}
+			for i := range mem[dst : dst+n] {
+				mem[dst+uint64(i)] = v
+			}
+
+		default:
+			panic(trap(fmt.Sprintf("unknown instruction 0x%02x", in.op)))
+		}
+	}
+}
+
+// grow grows the memory by delta pages, and returns the previous size in pages, or -1 if the memory
+// can't grow.
+func (vm *machine) grow(delta uint32) uint32 {
+	size := uint32(len(vm.mem) / pageSize)
+	if uint64(size)+uint64(delta) > uint64(vm.pages) {
+		return math.MaxUint32
+	}
+	vm.mem = append(vm.mem, make([]byte, int(delta)*pageSize)...)
+	return size
+}
+
+// access returns the n bytes of memory at the effective address of a load or store.
+func access(mem []byte, base uint64, offset uint32, n uint64) []byte {
+	addr := uint64(uint32(base)) + uint64(offset)
+	if addr+n > uint64(len(mem)) {
+		panic(trapMemory)
+	}
+	return mem[addr : addr+n]
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func f32(v uint64) float32 {
+	return math.Float32frombits(uint32(v))
+}
+
+func f64(v uint64) float64 {
+	return math.Float64frombits(v)
+}
+
+func fromF32(f float32) uint64 {
+	return uint64(math.Float32bits(f))
+}
+
+func fromF64(f float64) uint64 {
+	return math.Float64bits(f)
+}
+
+func truncS32(f float64) uint64 {
+	if f != f {
+		panic(trapConversion)
+	}
+	if t := math.Trunc(f); t < math.MinInt32 || t > math.MaxInt32 {
+		panic(trapOverflow)
+	}
+	return uint64(uint32(int32(f)))
+}
+
+func truncU32(f float64) uint64 {
+	if f != f {
+		panic(trapConversion)
+	}
+	if t := math.Trunc(f); t < 0 || t > math.MaxUint32 {
+		panic(trapOverflow)
+	}
+	return uint64(uint32(f))
+}
+
+func truncS64(f float64) uint64 {
+	if f != f {
+		panic(trapConversion)
+	}
+	if t := math.Trunc(f); t < math.MinInt64 || t >= -math.MinInt64 {
+		panic(trapOverflow)
+	}
+	return uint64(int64(f))
+}
+
+func truncU64(f float64) uint64 {
+	if f != f {
+		panic(trapConversion)
+	}
+	if t := math.Trunc(f); t < 0 || t >= 2*-math.MinInt64 {
+		panic(trapOverflow)
+	}
+	return uint64(f)
+}
+
+func satS32(f float64) uint64 {
+	switch {
+	case f != f:
+		return 0
+	case f < math.MinInt32:
+		return 1 << 31
+	case f > math.MaxInt32:
+		return math.MaxInt32
+	}
+	return uint64(uint32(int32(f)))
+}
+
+func satU32(f float64) uint64 {
+	switch {
+	case f != f || f < 0:
+		return 0
+	case f > math.MaxUint32:
+		return math.MaxUint32
+	}
+	return uint64(uint32(f))
+}
+
+func satS64(f float64) uint64 {
+	switch {
+	case f != f:
+		return 0
+	case f < math.MinInt64:
+		return 1 << 63
+	case f >= -math.MinInt64:
+		return math.MaxInt64
+	}
+	return uint64(int64(f))
+}
+
+func satU64(f float64) uint64 {
+	switch {
+	case f != f || f < 0:
+		return 0
+	case f >= 2*-math.MinInt64:
+		return math.MaxUint64
+	}
+	return uint64(f)
+}
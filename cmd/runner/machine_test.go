@@ -0,0 +1,233 @@
+package runner
+
+import (
+	"math"
+	"testing"
+)
+
+// value types
+const (
+	typeI32 = 0x7f
+	typeI64 = 0x7e
+	typeF32 = 0x7d
+	typeF64 = 0x7c
+)
+
+func fromI32(v int32) uint64 {
+	return uint64(uint32(v))
+}
+
+func fromI64(v int64) uint64 {
+	return uint64(v)
+}
+
+// numericModule returns a module that exports a function f, which applies op to its parameters.
+func numericModule(op []byte, params []byte, result byte) []byte {
+	b := []byte("\x00asm\x01\x00\x00\x00")
+	section := func(id byte, contents []byte) {
+		b = append(b, id, byte(len(contents)))
+		b = append(b, contents...)
+	}
+	typ := append([]byte{1, 0x60, byte(len(params))}, params...)
+	section(sectionType, append(typ, 1, result))
+	section(sectionFunction, []byte{1, 0})
+	section(sectionExport, []byte{1, 1, 'f', kindFunc, 0})
+	body := []byte{0} // no locals
+	for i := range params {
+		body = append(body, opLocalGet, byte(i))
+	}
+	body = append(append(body, op...), opEnd)
+	section(sectionCode, append([]byte{1, byte(len(body))}, body...))
+	return b
+}
+
+// TestNumeric runs the numeric instructions, including the edge cases where they wrap, trap or
+// saturate.
+func TestNumeric(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name   string
+		op     []byte
+		params []byte
+		result byte
+		args   []uint64
+		want   uint64
+		trap   trap
+	}{
+		{"i32.eqz", []byte{0x45}, []byte{typeI32}, typeI32, []uint64{0}, 1, ""},
+		{"i32.eq", []byte{0x46}, []byte{typeI32, typeI32}, typeI32, []uint64{5, 5}, 1, ""},
+		{"i32.ne", []byte{0x47}, []byte{typeI32, typeI32}, typeI32, []uint64{5, 5}, 0, ""},
+		{"i32.lt_s", []byte{0x48}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-1), 1}, 1, ""},
+		{"i32.lt_u", []byte{0x49}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-1), 1}, 0, ""},
+		{"i32.gt_s", []byte{0x4a}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-1), 1}, 0, ""},
+		{"i32.gt_u", []byte{0x4b}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-1), 1}, 1, ""},
+		{"i32.le_s", []byte{0x4c}, []byte{typeI32, typeI32}, typeI32, []uint64{2, 2}, 1, ""},
+		{"i32.le_u", []byte{0x4d}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-1), 2}, 0, ""},
+		{"i32.ge_s", []byte{0x4e}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-2), fromI32(-1)}, 0, ""},
+		{"i32.ge_u", []byte{0x4f}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-1), 2}, 1, ""},
+		{"i32.clz", []byte{0x67}, []byte{typeI32}, typeI32, []uint64{1}, 31, ""},
+		{"i32.clz zero", []byte{0x67}, []byte{typeI32}, typeI32, []uint64{0}, 32, ""},
+		{"i32.ctz", []byte{0x68}, []byte{typeI32}, typeI32, []uint64{0x80}, 7, ""},
+		{"i32.popcnt", []byte{0x69}, []byte{typeI32}, typeI32, []uint64{0xff00ff}, 16, ""},
+		{"i32.add wraps", []byte{0x6a}, []byte{typeI32, typeI32}, typeI32, []uint64{0xffffffff, 1}, 0, ""},
+		{"i32.sub wraps", []byte{0x6b}, []byte{typeI32, typeI32}, typeI32, []uint64{0, 1}, 0xffffffff, ""},
+		{"i32.mul wraps", []byte{0x6c}, []byte{typeI32, typeI32}, typeI32, []uint64{0x10001, 0x10000}, 0x10000, ""},
+		{"i32.div_s", []byte{0x6d}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-7), 2}, fromI32(-3), ""},
+		{"i32.div_s by zero", []byte{0x6d}, []byte{typeI32, typeI32}, typeI32, []uint64{1, 0}, 0, trapDivideByZero},
+		{"i32.div_s overflow", []byte{0x6d}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(math.MinInt32), fromI32(-1)}, 0, trapOverflow},
+		{"i32.div_u", []byte{0x6e}, []byte{typeI32, typeI32}, typeI32, []uint64{0xffffffff, 2}, 0x7fffffff, ""},
+		{"i32.div_u by zero", []byte{0x6e}, []byte{typeI32, typeI32}, typeI32, []uint64{1, 0}, 0, trapDivideByZero},
+		{"i32.rem_s", []byte{0x6f}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-7), 2}, fromI32(-1), ""},
+		{"i32.rem_s min", []byte{0x6f}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(math.MinInt32), fromI32(-1)}, 0, ""},
+		{"i32.rem_u", []byte{0x70}, []byte{typeI32, typeI32}, typeI32, []uint64{0xffffffff, 10}, 5, ""},
+		{"i32.rem_u by zero", []byte{0x70}, []byte{typeI32, typeI32}, typeI32, []uint64{1, 0}, 0, trapDivideByZero},
+		{"i32.and", []byte{0x71}, []byte{typeI32, typeI32}, typeI32, []uint64{0xff0, 0x0ff}, 0x0f0, ""},
+		{"i32.or", []byte{0x72}, []byte{typeI32, typeI32}, typeI32, []uint64{0xf00, 0x00f}, 0xf0f, ""},
+		{"i32.xor", []byte{0x73}, []byte{typeI32, typeI32}, typeI32, []uint64{0xff0, 0x0ff}, 0xf0f, ""},
+		{"i32.shl masks count", []byte{0x74}, []byte{typeI32, typeI32}, typeI32, []uint64{1, 33}, 2, ""},
+		{"i32.shr_s", []byte{0x75}, []byte{typeI32, typeI32}, typeI32, []uint64{fromI32(-8), 1}, fromI32(-4), ""},
+		{"i32.shr_u", []byte{0x76}, []byte{typeI32, typeI32}, typeI32, []uint64{0x80000000, 31}, 1, ""},
+		{"i32.rotl", []byte{0x77}, []byte{typeI32, typeI32}, typeI32, []uint64{0x80000001, 1}, 3, ""},
+		{"i32.rotr", []byte{0x78}, []byte{typeI32, typeI32}, typeI32, []uint64{3, 1}, 0x80000001, ""},
+
+		{"i64.eqz", []byte{0x50}, []byte{typeI64}, typeI32, []uint64{1 << 40}, 0, ""},
+		{"i64.eq", []byte{0x51}, []byte{typeI64, typeI64}, typeI32, []uint64{1 << 40, 1 << 40}, 1, ""},
+		{"i64.lt_s", []byte{0x53}, []byte{typeI64, typeI64}, typeI32, []uint64{fromI64(-1), 1}, 1, ""},
+		{"i64.lt_u", []byte{0x54}, []byte{typeI64, typeI64}, typeI32, []uint64{fromI64(-1), 1}, 0, ""},
+		{"i64.ge_u", []byte{0x5a}, []byte{typeI64, typeI64}, typeI32, []uint64{fromI64(-1), 1}, 1, ""},
+		{"i64.clz", []byte{0x79}, []byte{typeI64}, typeI64, []uint64{1}, 63, ""},
+		{"i64.ctz", []byte{0x7a}, []byte{typeI64}, typeI64, []uint64{1 << 40}, 40, ""},
+		{"i64.popcnt", []byte{0x7b}, []byte{typeI64}, typeI64, []uint64{math.MaxUint64}, 64, ""},
+		{"i64.add wraps", []byte{0x7c}, []byte{typeI64, typeI64}, typeI64, []uint64{math.MaxUint64, 2}, 1, ""},
+		{"i64.sub", []byte{0x7d}, []byte{typeI64, typeI64}, typeI64, []uint64{0, 1}, math.MaxUint64, ""},
+		{"i64.mul", []byte{0x7e}, []byte{typeI64, typeI64}, typeI64, []uint64{1 << 32, 1 << 31}, 1 << 63, ""},
+		{"i64.div_s", []byte{0x7f}, []byte{typeI64, typeI64}, typeI64, []uint64{fromI64(-7), 2}, fromI64(-3), ""},
+		{"i64.div_s by zero", []byte{0x7f}, []byte{typeI64, typeI64}, typeI64, []uint64{1, 0}, 0, trapDivideByZero},
+		{"i64.div_s overflow", []byte{0x7f}, []byte{typeI64, typeI64}, typeI64, []uint64{fromI64(math.MinInt64), fromI64(-1)}, 0, trapOverflow},
+		{"i64.div_u", []byte{0x80}, []byte{typeI64, typeI64}, typeI64, []uint64{math.MaxUint64, 2}, math.MaxInt64, ""},
+		{"i64.rem_s", []byte{0x81}, []byte{typeI64, typeI64}, typeI64, []uint64{fromI64(-7), 2}, fromI64(-1), ""},
+		{"i64.rem_s min", []byte{0x81}, []byte{typeI64, typeI64}, typeI64, []uint64{fromI64(math.MinInt64), fromI64(-1)}, 0, ""},
+		{"i64.rem_u by zero", []byte{0x82}, []byte{typeI64, typeI64}, typeI64, []uint64{1, 0}, 0, trapDivideByZero},
+		{"i64.shl masks count", []byte{0x86}, []byte{typeI64, typeI64}, typeI64, []uint64{1, 65}, 2, ""},
+		{"i64.shr_s", []byte{0x87}, []byte{typeI64, typeI64}, typeI64, []uint64{fromI64(-8), 1}, fromI64(-4), ""},
+		{"i64.shr_u", []byte{0x88}, []byte{typeI64, typeI64}, typeI64, []uint64{1 << 63, 63}, 1, ""},
+		{"i64.rotl", []byte{0x89}, []byte{typeI64, typeI64}, typeI64, []uint64{1<<63 | 1, 1}, 3, ""},
+		{"i64.rotr", []byte{0x8a}, []byte{typeI64, typeI64}, typeI64, []uint64{3, 1}, 1<<63 | 1, ""},
+
+		{"f32.eq", []byte{0x5b}, []byte{typeF32, typeF32}, typeI32, []uint64{fromF32(0), fromF32(float32(math.Copysign(0, -1)))}, 1, ""},
+		{"f32.ne nan", []byte{0x5c}, []byte{typeF32, typeF32}, typeI32, []uint64{fromF32(float32(nan)), fromF32(float32(nan))}, 1, ""},
+		{"f32.lt", []byte{0x5d}, []byte{typeF32, typeF32}, typeI32, []uint64{fromF32(-1), fromF32(1)}, 1, ""},
+		{"f32.ge nan", []byte{0x60}, []byte{typeF32, typeF32}, typeI32, []uint64{fromF32(float32(nan)), fromF32(1)}, 0, ""},
+		{"f32.abs", []byte{0x8b}, []byte{typeF32}, typeF32, []uint64{fromF32(-1.5)}, fromF32(1.5), ""},
+		{"f32.neg", []byte{0x8c}, []byte{typeF32}, typeF32, []uint64{fromF32(1.5)}, fromF32(-1.5), ""},
+		{"f32.ceil", []byte{0x8d}, []byte{typeF32}, typeF32, []uint64{fromF32(1.2)}, fromF32(2), ""},
+		{"f32.floor", []byte{0x8e}, []byte{typeF32}, typeF32, []uint64{fromF32(-1.2)}, fromF32(-2), ""},
+		{"f32.trunc", []byte{0x8f}, []byte{typeF32}, typeF32, []uint64{fromF32(-1.7)}, fromF32(-1), ""},
+		{"f32.nearest even", []byte{0x90}, []byte{typeF32}, typeF32, []uint64{fromF32(2.5)}, fromF32(2), ""},
+		{"f32.nearest odd", []byte{0x90}, []byte{typeF32}, typeF32, []uint64{fromF32(3.5)}, fromF32(4), ""},
+		{"f32.sqrt", []byte{0x91}, []byte{typeF32}, typeF32, []uint64{fromF32(2.25)}, fromF32(1.5), ""},
+		{"f32.add", []byte{0x92}, []byte{typeF32, typeF32}, typeF32, []uint64{fromF32(0.5), fromF32(0.25)}, fromF32(0.75), ""},
+		{"f32.sub", []byte{0x93}, []byte{typeF32, typeF32}, typeF32, []uint64{fromF32(0.5), fromF32(0.25)}, fromF32(0.25), ""},
+		{"f32.mul", []byte{0x94}, []byte{typeF32, typeF32}, typeF32, []uint64{fromF32(1.5), fromF32(-2)}, fromF32(-3), ""},
+		{"f32.div by zero", []byte{0x95}, []byte{typeF32, typeF32}, typeF32, []uint64{fromF32(1), fromF32(0)}, fromF32(float32(math.Inf(1))), ""},
+		{"f32.min zeros", []byte{0x96}, []byte{typeF32, typeF32}, typeF32, []uint64{fromF32(0), fromF32(float32(math.Copysign(0, -1)))}, 1 << 31, ""},
+		{"f32.max", []byte{0x97}, []byte{typeF32, typeF32}, typeF32, []uint64{fromF32(-1), fromF32(2)}, fromF32(2), ""},
+		{"f32.copysign", []byte{0x98}, []byte{typeF32, typeF32}, typeF32, []uint64{fromF32(1.5), fromF32(-2)}, fromF32(-1.5), ""},
+
+		{"f64.eq", []byte{0x61}, []byte{typeF64, typeF64}, typeI32, []uint64{fromF64(0.1), fromF64(0.1)}, 1, ""},
+		{"f64.ne nan", []byte{0x62}, []byte{typeF64, typeF64}, typeI32, []uint64{fromF64(nan), fromF64(nan)}, 1, ""},
+		{"f64.gt", []byte{0x64}, []byte{typeF64, typeF64}, typeI32, []uint64{fromF64(2), fromF64(1)}, 1, ""},
+		{"f64.le nan", []byte{0x65}, []byte{typeF64, typeF64}, typeI32, []uint64{fromF64(nan), fromF64(1)}, 0, ""},
+		{"f64.abs", []byte{0x99}, []byte{typeF64}, typeF64, []uint64{fromF64(-1.5)}, fromF64(1.5), ""},
+		{"f64.neg", []byte{0x9a}, []byte{typeF64}, typeF64, []uint64{fromF64(1.5)}, fromF64(-1.5), ""},
+		{"f64.ceil", []byte{0x9b}, []byte{typeF64}, typeF64, []uint64{fromF64(-1.2)}, fromF64(-1), ""},
+		{"f64.floor", []byte{0x9c}, []byte{typeF64}, typeF64, []uint64{fromF64(1.8)}, fromF64(1), ""},
+		{"f64.trunc", []byte{0x9d}, []byte{typeF64}, typeF64, []uint64{fromF64(1.8)}, fromF64(1), ""},
+		{"f64.nearest", []byte{0x9e}, []byte{typeF64}, typeF64, []uint64{fromF64(-2.5)}, fromF64(-2), ""},
+		{"f64.sqrt", []byte{0x9f}, []byte{typeF64}, typeF64, []uint64{fromF64(16)}, fromF64(4), ""},
+		{"f64.add", []byte{0xa0}, []byte{typeF64, typeF64}, typeF64, []uint64{fromF64(0.5), fromF64(0.25)}, fromF64(0.75), ""},
+		{"f64.sub", []byte{0xa1}, []byte{typeF64, typeF64}, typeF64, []uint64{fromF64(0.5), fromF64(0.75)}, fromF64(-0.25), ""},
+		{"f64.mul", []byte{0xa2}, []byte{typeF64, typeF64}, typeF64, []uint64{fromF64(1.5), fromF64(4)}, fromF64(6), ""},
+		{"f64.div", []byte{0xa3}, []byte{typeF64, typeF64}, typeF64, []uint64{fromF64(-1), fromF64(0)}, fromF64(math.Inf(-1)), ""},
+		{"f64.min", []byte{0xa4}, []byte{typeF64, typeF64}, typeF64, []uint64{fromF64(-1), fromF64(2)}, fromF64(-1), ""},
+		{"f64.max zeros", []byte{0xa5}, []byte{typeF64, typeF64}, typeF64, []uint64{fromF64(math.Copysign(0, -1)), fromF64(0)}, 0, ""},
+		{"f64.copysign", []byte{0xa6}, []byte{typeF64, typeF64}, typeF64, []uint64{fromF64(-1.5), fromF64(2)}, fromF64(1.5), ""},
+
+		{"i32.wrap_i64", []byte{0xa7}, []byte{typeI64}, typeI32, []uint64{1<<32 | 7}, 7, ""},
+		{"i32.trunc_f32_s", []byte{0xa8}, []byte{typeF32}, typeI32, []uint64{fromF32(-1.9)}, fromI32(-1), ""},
+		{"i32.trunc_f32_u", []byte{0xa9}, []byte{typeF32}, typeI32, []uint64{fromF32(3e9)}, 3e9, ""},
+		{"i32.trunc_f64_s", []byte{0xaa}, []byte{typeF64}, typeI32, []uint64{fromF64(-2147483648.9)}, fromI32(math.MinInt32), ""},
+		{"i32.trunc_f64_s overflow", []byte{0xaa}, []byte{typeF64}, typeI32, []uint64{fromF64(2147483648)}, 0, trapOverflow},
+		{"i32.trunc_f64_s nan", []byte{0xaa}, []byte{typeF64}, typeI32, []uint64{fromF64(nan)}, 0, trapConversion},
+		{"i32.trunc_f64_u", []byte{0xab}, []byte{typeF64}, typeI32, []uint64{fromF64(4294967295.9)}, math.MaxUint32, ""},
+		{"i32.trunc_f64_u negative", []byte{0xab}, []byte{typeF64}, typeI32, []uint64{fromF64(-0.9)}, 0, ""},
+		{"i32.trunc_f64_u overflow", []byte{0xab}, []byte{typeF64}, typeI32, []uint64{fromF64(-1)}, 0, trapOverflow},
+		{"i64.extend_i32_s", []byte{0xac}, []byte{typeI32}, typeI64, []uint64{fromI32(-1)}, math.MaxUint64, ""},
+		{"i64.extend_i32_u", []byte{0xad}, []byte{typeI32}, typeI64, []uint64{fromI32(-1)}, math.MaxUint32, ""},
+		{"i64.trunc_f32_s", []byte{0xae}, []byte{typeF32}, typeI64, []uint64{fromF32(-1e10)}, fromI64(-1e10), ""},
+		{"i64.trunc_f32_u", []byte{0xaf}, []byte{typeF32}, typeI64, []uint64{fromF32(1e10)}, 1e10, ""},
+		{"i64.trunc_f64_s", []byte{0xb0}, []byte{typeF64}, typeI64, []uint64{fromF64(math.MinInt64)}, fromI64(math.MinInt64), ""},
+		{"i64.trunc_f64_s overflow", []byte{0xb0}, []byte{typeF64}, typeI64, []uint64{fromF64(-math.MinInt64)}, 0, trapOverflow},
+		{"i64.trunc_f64_u", []byte{0xb1}, []byte{typeF64}, typeI64, []uint64{fromF64(1 << 63)}, 1 << 63, ""},
+		{"i64.trunc_f64_u overflow", []byte{0xb1}, []byte{typeF64}, typeI64, []uint64{fromF64(1 << 64)}, 0, trapOverflow},
+		{"i64.trunc_f64_u nan", []byte{0xb1}, []byte{typeF64}, typeI64, []uint64{fromF64(nan)}, 0, trapConversion},
+		{"f32.convert_i32_s", []byte{0xb2}, []byte{typeI32}, typeF32, []uint64{fromI32(-3)}, fromF32(-3), ""},
+		{"f32.convert_i32_u", []byte{0xb3}, []byte{typeI32}, typeF32, []uint64{fromI32(-1)}, fromF32(1 << 32), ""},
+		{"f32.convert_i64_s", []byte{0xb4}, []byte{typeI64}, typeF32, []uint64{fromI64(-1 << 40)}, fromF32(-1 << 40), ""},
+		{"f32.convert_i64_u", []byte{0xb5}, []byte{typeI64}, typeF32, []uint64{math.MaxUint64}, fromF32(1 << 64), ""},
+		{"f32.demote_f64", []byte{0xb6}, []byte{typeF64}, typeF32, []uint64{fromF64(1.5)}, fromF32(1.5), ""},
+		{"f64.convert_i32_s", []byte{0xb7}, []byte{typeI32}, typeF64, []uint64{fromI32(-3)}, fromF64(-3), ""},
+		{"f64.convert_i32_u", []byte{0xb8}, []byte{typeI32}, typeF64, []uint64{fromI32(-1)}, fromF64(math.MaxUint32), ""},
+		{"f64.convert_i64_s", []byte{0xb9}, []byte{typeI64}, typeF64, []uint64{fromI64(-1)}, fromF64(-1), ""},
+		{"f64.convert_i64_u", []byte{0xba}, []byte{typeI64}, typeF64, []uint64{math.MaxUint64}, fromF64(1 << 64), ""},
+		{"f64.promote_f32", []byte{0xbb}, []byte{typeF32}, typeF64, []uint64{fromF32(-0.5)}, fromF64(-0.5), ""},
+		{"i32.reinterpret_f32", []byte{0xbc}, []byte{typeF32}, typeI32, []uint64{fromF32(1)}, 0x3f800000, ""},
+		{"i64.reinterpret_f64", []byte{0xbd}, []byte{typeF64}, typeI64, []uint64{fromF64(1)}, 0x3ff0000000000000, ""},
+		{"f32.reinterpret_i32", []byte{0xbe}, []byte{typeI32}, typeF32, []uint64{0x3f800000}, fromF32(1), ""},
+		{"f64.reinterpret_i64", []byte{0xbf}, []byte{typeI64}, typeF64, []uint64{0x3ff0000000000000}, fromF64(1), ""},
+		{"i32.extend8_s", []byte{0xc0}, []byte{typeI32}, typeI32, []uint64{0x180}, 0xffffff80, ""},
+		{"i32.extend16_s", []byte{0xc1}, []byte{typeI32}, typeI32, []uint64{0x7fff}, 0x7fff, ""},
+		{"i64.extend8_s", []byte{0xc2}, []byte{typeI64}, typeI64, []uint64{0x80}, fromI64(-128), ""},
+		{"i64.extend16_s", []byte{0xc3}, []byte{typeI64}, typeI64, []uint64{0x8000}, fromI64(-32768), ""},
+		{"i64.extend32_s", []byte{0xc4}, []byte{typeI64}, typeI64, []uint64{0x80000000}, fromI64(math.MinInt32), ""},
+
+		{"i32.trunc_sat_f32_s", []byte{0xfc, 0}, []byte{typeF32}, typeI32, []uint64{fromF32(-1e10)}, fromI32(math.MinInt32), ""},
+		{"i32.trunc_sat_f32_u", []byte{0xfc, 1}, []byte{typeF32}, typeI32, []uint64{fromF32(-1)}, 0, ""},
+		{"i32.trunc_sat_f64_s nan", []byte{0xfc, 2}, []byte{typeF64}, typeI32, []uint64{fromF64(nan)}, 0, ""},
+		{"i32.trunc_sat_f64_s", []byte{0xfc, 2}, []byte{typeF64}, typeI32, []uint64{fromF64(1e10)}, math.MaxInt32, ""},
+		{"i32.trunc_sat_f64_u", []byte{0xfc, 3}, []byte{typeF64}, typeI32, []uint64{fromF64(1e10)}, math.MaxUint32, ""},
+		{"i64.trunc_sat_f32_s", []byte{0xfc, 4}, []byte{typeF32}, typeI64, []uint64{fromF32(-2.5)}, fromI64(-2), ""},
+		{"i64.trunc_sat_f32_u", []byte{0xfc, 5}, []byte{typeF32}, typeI64, []uint64{fromF32(float32(math.Inf(1)))}, math.MaxUint64, ""},
+		{"i64.trunc_sat_f64_s", []byte{0xfc, 6}, []byte{typeF64}, typeI64, []uint64{fromF64(1e19)}, math.MaxInt64, ""},
+		{"i64.trunc_sat_f64_s min", []byte{0xfc, 6}, []byte{typeF64}, typeI64, []uint64{fromF64(math.Inf(-1))}, fromI64(math.MinInt64), ""},
+		{"i64.trunc_sat_f64_u", []byte{0xfc, 7}, []byte{typeF64}, typeI64, []uint64{fromF64(-5)}, 0, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := parseModule(numericModule(test.op, test.params, test.result))
+			if err != nil {
+				t.Fatal(err)
+			}
+			vm, err := instantiate(m, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var results []uint64
+			var trapped trap
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						trapped = r.(trap)
+					}
+				}()
+				results = vm.invoke("f", test.args...)
+			}()
+			if trapped != test.trap {
+				t.Fatalf("got trap %q, expected %q", trapped, test.trap)
+			}
+			if test.trap == "" && (len(results) != 1 || results[0] != test.want) {
+				t.Fatalf("got %#x, expected %#x", results, test.want)
+			}
+		})
+	}
+}
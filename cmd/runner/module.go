@@ -0,0 +1,239 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/dave/wasmgo/cmd/wasmbin"
+)
+
+// module is a decoded wasm module. Only the features the Go compiler emits are supported: function
+// imports, a single table and memory, and constant initializers.
+type module struct {
+	types    []signature
+	imports  []imported // imported functions, which come first in the function index space
+	funcs    []uint32   // type index of each defined function
+	bodies   [][]byte   // locals and instructions of each defined function
+	table    uint32     // initial size of the table
+	memory   wasmbin.Limits
+	globals  []global
+	exports  map[string]export
+	start    int // index of the start function, or -1
+	elements []element
+	segments []segment
+}
+
+type signature struct {
+	params  []byte
+	results []byte
+}
+
+func (s signature) equal(t signature) bool {
+	return bytes.Equal(s.params, t.params) && bytes.Equal(s.results, t.results)
+}
+
+type imported struct {
+	module, name string
+	typ          uint32
+}
+
+type global struct {
+	mutable bool
+	init    uint64
+}
+
+type export struct {
+	kind  byte
+	index uint32
+}
+
+type element struct {
+	offset uint32
+	funcs  []uint32
+}
+
+type segment struct {
+	addr uint32
+	data []byte
+}
+
+const (
+	sectionCustom   = 0
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionTable    = 4
+	sectionMemory   = 5
+	sectionGlobal   = 6
+	sectionExport   = 7
+	sectionStart    = 8
+	sectionElement  = 9
+	sectionCode     = 10
+	sectionData     = 11
+)
+
+const (
+	kindFunc   = 0
+	kindTable  = 1
+	kindMemory = 2
+	kindGlobal = 3
+)
+
+func parseModule(b []byte) (*module, error) {
+	if len(b) < 8 || !bytes.Equal(b[:4], []byte("\x00asm")) {
+		return nil, errors.New("not a wasm binary")
+	}
+	m := &module{exports: map[string]export{}, start: -1}
+	r := wasmbin.NewReader(b[8:])
+	for r.Len() > 0 {
+		id := r.Byte()
+		size := int(r.Uint())
+		if r.Err() != nil || size > r.Len() {
+			return nil, errors.New("malformed wasm section")
+		}
+		sec := wasmbin.NewReader(r.Bytes(size))
+		switch id {
+		case sectionType:
+			m.decodeTypes(sec)
+		case sectionImport:
+			m.decodeImports(sec)
+		case sectionFunction:
+			for n := sec.Uint(); n > 0 && sec.Err() == nil; n-- {
+				m.funcs = append(m.funcs, uint32(sec.Uint()))
+			}
+		case sectionTable:
+			for n := sec.Uint(); n > 0 && sec.Err() == nil; n-- {
+				if sec.Byte() != 0x70 {
+					sec.Fail("unsupported table type")
+				}
+				m.table = sec.Limits().Min
+			}
+		case sectionMemory:
+			for n := sec.Uint(); n > 0 && sec.Err() == nil; n-- {
+				m.memory = sec.Limits()
+			}
+		case sectionGlobal:
+			for n := sec.Uint(); n > 0 && sec.Err() == nil; n-- {
+				sec.Byte()
+				g := global{mutable: sec.Byte() == 1}
+				g.init = constant(sec)
+				m.globals = append(m.globals, g)
+			}
+		case sectionExport:
+			for n := sec.Uint(); n > 0 && sec.Err() == nil; n-- {
+				name := sec.Name()
+				m.exports[name] = export{kind: sec.Byte(), index: uint32(sec.Uint())}
+			}
+		case sectionStart:
+			m.start = int(sec.Uint())
+		case sectionElement:
+			m.decodeElements(sec)
+		case sectionCode:
+			for n := sec.Uint(); n > 0 && sec.Err() == nil; n-- {
+				m.bodies = append(m.bodies, sec.Bytes(int(sec.Uint())))
+			}
+		case sectionData:
+			m.decodeData(sec)
+		}
+		if sec.Err() != nil {
+			return nil, fmt.Errorf("malformed wasm section %d: %v", id, sec.Err())
+		}
+	}
+	if len(m.funcs) != len(m.bodies) {
+		return nil, errors.New("function and code sections don't match")
+	}
+	return m, nil
+}
+
+func (m *module) decodeTypes(r *wasmbin.Reader) {
+	for n := r.Uint(); n > 0 && r.Err() == nil; n-- {
+		if r.Byte() != 0x60 {
+			r.Fail("unsupported type")
+			return
+		}
+		var s signature
+		s.params = r.Bytes(int(r.Uint()))
+		s.results = r.Bytes(int(r.Uint()))
+		m.types = append(m.types, s)
+	}
+}
+
+func (m *module) decodeImports(r *wasmbin.Reader) {
+	for n := r.Uint(); n > 0 && r.Err() == nil; n-- {
+		i := imported{module: r.Name(), name: r.Name()}
+		if r.Byte() != kindFunc {
+			// Go defines its own memory and table, and only imports functions
+			r.Fail(fmt.Sprintf("unsupported import %s.%s", i.module, i.name))
+			return
+		}
+		i.typ = uint32(r.Uint())
+		m.imports = append(m.imports, i)
+	}
+}
+
+func (m *module) decodeElements(r *wasmbin.Reader) {
+	for n := r.Uint(); n > 0 && r.Err() == nil; n-- {
+		if r.Uint() != 0 {
+			r.Fail("unsupported element segment")
+			return
+		}
+		e := element{offset: uint32(constant(r))}
+		for n := r.Uint(); n > 0 && r.Err() == nil; n-- {
+			e.funcs = append(e.funcs, uint32(r.Uint()))
+		}
+		m.elements = append(m.elements, e)
+	}
+}
+
+func (m *module) decodeData(r *wasmbin.Reader) {
+	for n := r.Uint(); n > 0 && r.Err() == nil; n-- {
+		switch r.Uint() {
+		case 0:
+		case 2:
+			r.Uint()
+		default:
+			r.Fail("unsupported data segment")
+			return
+		}
+		addr := uint32(constant(r))
+		m.segments = append(m.segments, segment{addr: addr, data: r.Bytes(int(r.Uint()))})
+	}
+}
+
+// signature returns the signature of a function in the function index space.
+func (m *module) signature(index uint32) signature {
+	if int(index) < len(m.imports) {
+		return m.types[m.imports[index].typ]
+	}
+	return m.types[m.funcs[int(index)-len(m.imports)]]
+}
+
+// constant reads a constant expression. Go only emits single const instructions, so global.get
+// isn't supported.
+func constant(r *wasmbin.Reader) uint64 {
+	var v uint64
+	switch r.Byte() {
+	case opI32Const:
+		v = uint64(uint32(r.Int()))
+	case opI64Const:
+		v = uint64(r.Int())
+	case opF32Const:
+		v = r.Fixed(4)
+	case opF64Const:
+		v = r.Fixed(8)
+	default:
+		r.Fail("unsupported constant expression")
+		return 0
+	}
+	if r.Byte() != opEnd {
+		r.Fail("unsupported constant expression")
+	}
+	return v
+}
+
+const pageSize = 65536
+
+// maxPages is the number of pages in a full 32 bit memory.
+const maxPages = math.MaxUint32/pageSize + 1
@@ -0,0 +1,180 @@
+// Package runner runs Go js/wasm binaries without a browser or Node.js. The binary is run by a wasm
+// interpreter, and the go import module of wasm_exec.js is implemented against a small JavaScript
+// object model with the parts of the global object that Go uses.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// Options configure a run. Stdin may be nil, and nil writers discard the output.
+type Options struct {
+	Args   []string // command line arguments, starting with the program name
+	Env    []string // environment variables, as KEY=value pairs
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// ErrDeadlock is returned if the program is waiting for an event that can't happen, and didn't exit
+// with Go's deadlock error.
+var ErrDeadlock = errors.New("all goroutines are asleep and no events are scheduled")
+
+// Run runs the binary until it exits, and returns the exit code. An error is returned if the binary
+// can't be run, it traps, or a JavaScript exception isn't caught. If ctx is cancelled, the program
+// is stopped at the next event.
+func Run(ctx context.Context, binary []byte, opts Options) (code int, err error) {
+	m, err := parseModule(binary)
+	if err != nil {
+		return 0, err
+	}
+	h := &host{
+		stdin:  opts.Stdin,
+		stdout: opts.Stdout,
+		stderr: opts.Stderr,
+		origin: time.Now(),
+		ids:    map[value]int{},
+		timers: map[int32]timer{},
+		nextID: 1,
+	}
+	if h.stdout == nil {
+		h.stdout = ioutil.Discard
+	}
+	if h.stderr == nil {
+		h.stderr = ioutil.Discard
+	}
+	imported := map[string]bool{}
+	for _, i := range m.imports {
+		imported[i.name] = true
+	}
+	h.legacyFlags = !imported["syscall/js.finalizeRef"]
+	h.memoryRef = h.legacyFlags && !imported["syscall/js.copyBytesToGo"] && !imported["syscall/js.copyBytesToJS"]
+	for _, name := range []string{"mem", "run", "resume", "getsp"} {
+		if _, ok := m.exports[name]; !ok {
+			return 0, fmt.Errorf("not a Go js/wasm binary: no %s export", name)
+		}
+	}
+	vm, err := instantiate(m, h.imports)
+	if err != nil {
+		return 0, err
+	}
+	h.vm = vm
+	h.init()
+
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+		case exit:
+			code, err = int(r), nil
+		case trap:
+			err = r
+		case thrown:
+			err = fmt.Errorf("uncaught exception: %s", toString(r.v))
+		default:
+			panic(r)
+		}
+	}()
+
+	argc, argv, err := h.writeArgs(opts.Args, opts.Env)
+	if err != nil {
+		return 0, err
+	}
+	vm.invoke("run", uint64(argc), uint64(argv))
+	for {
+		t, ok := h.nextTimer()
+		if !ok {
+			// like wasm_exec_node.js, resume with event 0, which makes Go report the deadlock
+			event := newObject(h.objectProto)
+			event.props["id"] = float64(0)
+			h.goObj.props["_pendingEvent"] = event
+			h.resume()
+			return 0, ErrDeadlock
+		}
+		wait := time.NewTimer(time.Until(t.deadline))
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return 0, ctx.Err()
+		case <-wait.C:
+		}
+		delete(h.timers, t.id)
+		h.resume()
+	}
+}
+
+// nextTimer returns the timeout event that's due first.
+func (h *host) nextTimer() (timer, bool) {
+	var timers []timer
+	for _, t := range h.timers {
+		timers = append(timers, t)
+	}
+	if len(timers) == 0 {
+		return timer{}, false
+	}
+	sort.Slice(timers, func(i, j int) bool {
+		if timers[i].deadline.Equal(timers[j].deadline) {
+			return timers[i].id < timers[j].id
+		}
+		return timers[i].deadline.Before(timers[j].deadline)
+	})
+	return timers[0], true
+}
+
+// writeArgs writes the command line arguments and environment to linear memory, as in
+// wasm_exec.js, and returns the arguments of the run export.
+func (h *host) writeArgs(args, env []string) (argc, argv uint32, err error) {
+	offset := uint32(4096)
+	// the linker puts global data after wasmMinDataAddr
+	const wasmMinDataAddr = 4096 + 8192
+	var overflow bool
+	str := func(s string) uint32 {
+		ptr := offset
+		if uint64(offset)+uint64(len(s))+1 >= wasmMinDataAddr {
+			overflow = true
+			return 0
+		}
+		copy(h.vm.mem[offset:], s)
+		h.vm.mem[int(offset)+len(s)] = 0
+		offset += uint32(len(s)) + 1
+		offset = (offset + 7) &^ 7
+		return ptr
+	}
+	var ptrs []uint32
+	for _, a := range args {
+		ptrs = append(ptrs, str(a))
+	}
+	ptrs = append(ptrs, 0)
+	env = append([]string(nil), env...)
+	sort.Strings(env)
+	for _, e := range env {
+		ptrs = append(ptrs, str(e))
+	}
+	ptrs = append(ptrs, 0)
+	argv = offset
+	if overflow || uint64(offset)+8*uint64(len(ptrs)) >= wasmMinDataAddr || len(h.vm.mem) < wasmMinDataAddr {
+		return 0, 0, errors.New("total length of command line and environment variables exceeds limit")
+	}
+	for _, p := range ptrs {
+		h.setUint32(offset, p)
+		h.setUint32(offset+4, 0)
+		offset += 8
+	}
+	return uint32(len(args)), argv, nil
+}
+
+// Environ returns the environment for a run: the current environment, with TMPDIR defaulting to
+// the temp directory like in go_js_wasm_exec.
+func Environ() []string {
+	env := os.Environ()
+	if _, ok := os.LookupEnv("TMPDIR"); !ok {
+		env = append(env, "TMPDIR="+os.TempDir())
+	}
+	return env
+}
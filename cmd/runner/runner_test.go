@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// build compiles a program with GOOS=js and returns the binary.
+func build(t *testing.T, source string) []byte {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module hello\n\ngo 1.21\n",
+		"main.go": source,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("go", "build", "-o", "main.wasm", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestRun runs programs that use the arguments, environment, timers and standard streams, and
+// checks their output and exit code.
+func TestRun(t *testing.T) {
+	tests := map[string]struct {
+		source string
+		code   int
+		stdout string
+		stderr string
+	}{
+		"exit": {
+			source: `package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	time.Sleep(time.Millisecond)
+	fmt.Println(strings.Join(os.Args[1:], " "), os.Getenv("WASMGO_TEST"))
+	fmt.Fprintln(os.Stderr, "to stderr")
+	os.Exit(3)
+}
+`,
+			code:   3,
+			stdout: "a b value\n",
+			stderr: "to stderr\n",
+		},
+		"return": {
+			source: `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`,
+			code:   0,
+			stdout: "hello\n",
+		},
+		"date": {
+			source: `package main
+
+import (
+	"fmt"
+	"syscall/js"
+	"time"
+)
+
+func main() {
+	date := js.Global().Get("Date")
+	d := date.New(2021, 0, 31, 13, 4, 5, 6)
+	for _, name := range []string{"getFullYear", "getMonth", "getDate", "getDay", "getHours", "getMinutes", "getSeconds", "getMilliseconds"} {
+		fmt.Print(d.Call(name).Int(), " ")
+	}
+	fmt.Println()
+	u := date.New(date.Call("UTC", 2021, 0, 31, 13, 4, 5, 6))
+	fmt.Println(u.Call("toISOString").String(), u.Call("getUTCHours").Int(), int64(u.Call("getTime").Float()))
+	fmt.Println(date.New().Call("getFullYear").Int() == time.Now().Year())
+}
+`,
+			code:   0,
+			stdout: "2021 0 31 0 13 4 5 6 \n2021-01-31T13:04:05.006Z 13 1612098245006\ntrue\n",
+		},
+		"panic": {
+			source: `package main
+
+func main() {
+	panic("boom")
+}
+`,
+			code:   2,
+			stderr: "panic: boom",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			binary := build(t, test.source)
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			code, err := Run(context.Background(), binary, Options{
+				Args:   []string{"main.wasm", "a", "b"},
+				Env:    []string{"WASMGO_TEST=value"},
+				Stdout: stdout,
+				Stderr: stderr,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != test.code {
+				t.Fatalf("got exit code %d, expected %d; stderr:\n%s", code, test.code, stderr)
+			}
+			if stdout.String() != test.stdout {
+				t.Fatalf("got stdout %q, expected %q", stdout, test.stdout)
+			}
+			if !strings.HasPrefix(stderr.String(), test.stderr) {
+				t.Fatalf("got stderr %q, expected it to start with %q", stderr, test.stderr)
+			}
+		})
+	}
+}
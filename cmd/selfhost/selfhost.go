@@ -0,0 +1,307 @@
+package selfhost
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/dave/jsgo/server/servermsg"
+	"github.com/dave/jsgo/server/wasm/messages"
+	"github.com/dave/services/constor/constormsg"
+	"github.com/dave/wasmgo/cmd/cmdconfig"
+	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/gorilla/websocket"
+)
+
+func init() {
+	servermsg.RegisterTypes()
+	constormsg.RegisterTypes()
+}
+
+// Start runs a jsgo compatible deploy server. The wasm host accepts deploys over websocket, the
+// pkg host serves binaries and scripts, and the index host serves index pages. Files are stored
+// on disk, named by the hash of their contents.
+func Start(cfg *cmdconfig.Config) error {
+
+	var debug io.Writer
+	if cfg.Verbose {
+		debug = os.Stdout
+	} else {
+		debug = ioutil.Discard
+	}
+
+	store := &store{dir: cfg.Dir}
+	for _, dir := range []string{store.pkgDir(), store.indexDir()} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+
+	servers := []*http.Server{
+		{Addr: fmt.Sprintf(":%d", cfg.WasmPort), Handler: &wasmHandler{store: store, debug: debug}},
+		{Addr: fmt.Sprintf(":%d", cfg.PkgPort), Handler: &pkgHandler{store: store}},
+		{Addr: fmt.Sprintf(":%d", cfg.IndexPort), Handler: &indexHandler{store: store}},
+	}
+
+	for _, s := range servers {
+		s := s
+		go func() {
+			fmt.Fprintf(debug, "Starting server on %s\n", s.Addr)
+			if err := s.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	fmt.Fprintf(debug, "Storing files in %s\n", cfg.Dir)
+
+	// Set up graceful shutdown
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// Wait for shutdown signal
+	<-stop
+
+	fmt.Fprintln(debug, "Stopping server")
+
+	return nil
+}
+
+type store struct {
+	dir string
+}
+
+func (s *store) pkgDir() string {
+	return filepath.Join(s.dir, "pkg")
+}
+
+func (s *store) indexDir() string {
+	return filepath.Join(s.dir, "index")
+}
+
+// path returns the location of the file on disk. Index pages are stored separately because the
+// index host serves them without an extension.
+func (s *store) path(key messages.DeployFileKey) string {
+	switch key.Type {
+	case messages.DeployFileTypeIndex:
+		return filepath.Join(s.indexDir(), key.Hash+".html")
+	case messages.DeployFileTypeWasm:
+		return filepath.Join(s.pkgDir(), key.Hash+".wasm")
+	default:
+		return filepath.Join(s.pkgDir(), key.Hash+".js")
+	}
+}
+
+func (s *store) exists(key messages.DeployFileKey) bool {
+	_, err := os.Stat(s.path(key))
+	return err == nil
+}
+
+func (s *store) save(file messages.DeployFile) error {
+	if err := checkKey(file.DeployFileKey); err != nil {
+		return err
+	}
+	if hash := fmt.Sprintf("%x", sha1.Sum(file.Contents)); hash != file.Hash {
+		return fmt.Errorf("hash mismatch for %s file %s", file.Type, file.Hash)
+	}
+	fpath := s.path(file.DeployFileKey)
+	// write to a temp file and rename, so a partially written file is never served
+	f, err := ioutil.TempFile(filepath.Dir(fpath), file.Hash+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(file.Contents); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), fpath)
+}
+
+var hashRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func checkKey(key messages.DeployFileKey) error {
+	switch key.Type {
+	case messages.DeployFileTypeIndex, messages.DeployFileTypeLoader, messages.DeployFileTypeWasm:
+	default:
+		return fmt.Errorf("unknown file type %q", key.Type)
+	}
+	if !hashRegex.MatchString(key.Hash) {
+		return fmt.Errorf("invalid hash %q", key.Hash)
+	}
+	return nil
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wasmHandler implements the server side of the deploy protocol.
+type wasmHandler struct {
+	store *store
+	debug io.Writer
+}
+
+func (h *wasmHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, "/_wasm/") {
+		http.NotFound(w, req)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer conn.Close()
+	if err := h.deploy(conn); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		send(conn, servermsg.Error{Message: err.Error()})
+	}
+}
+
+func (h *wasmHandler) deploy(conn *websocket.Conn) error {
+	message, err := receive(conn)
+	if err != nil {
+		return err
+	}
+	query, ok := message.(messages.DeployQuery)
+	if !ok {
+		return fmt.Errorf("expected deploy query, got %T", message)
+	}
+	if !supportedVersion(query.Version) {
+		return send(conn, messages.DeployClientVersionNotSupported{})
+	}
+
+	offered := map[messages.DeployFileKey]bool{}
+	var response messages.DeployQueryResponse
+	for _, key := range query.Files {
+		if err := checkKey(key); err != nil {
+			return err
+		}
+		offered[key] = true
+		if !h.store.exists(key) {
+			response.Required = append(response.Required, key)
+		}
+	}
+	fmt.Fprintf(h.debug, "Deploy query: %d files offered, %d required.\n", len(query.Files), len(response.Required))
+	if err := send(conn, response); err != nil {
+		return err
+	}
+	if len(response.Required) == 0 {
+		return nil
+	}
+
+	message, err = receive(conn)
+	if err != nil {
+		return err
+	}
+	payload, ok := message.(messages.DeployPayload)
+	if !ok {
+		return fmt.Errorf("expected deploy payload, got %T", message)
+	}
+	if err := send(conn, constormsg.Storing{Starting: true, Remain: len(payload.Files)}); err != nil {
+		return err
+	}
+	for i, file := range payload.Files {
+		if !offered[file.DeployFileKey] {
+			return fmt.Errorf("%s file %s was not offered", file.Type, file.Hash)
+		}
+		if err := h.store.save(file); err != nil {
+			return err
+		}
+		fmt.Fprintf(h.debug, "Stored %s.\n", h.store.path(file.DeployFileKey))
+		if err := send(conn, constormsg.Storing{Finished: i + 1, Remain: len(payload.Files) - i - 1}); err != nil {
+			return err
+		}
+	}
+	return send(conn, messages.DeployDone{})
+}
+
+// supportedVersion accepts clients with the same major version as this one.
+func supportedVersion(version string) bool {
+	major := func(v string) string {
+		return strings.SplitN(v, ".", 2)[0]
+	}
+	return version != "" && major(version) == major(deployer.CLIENT_VERSION)
+}
+
+func receive(conn *websocket.Conn) (interface{}, error) {
+	_, b, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return messages.Unmarshal(b)
+}
+
+func send(conn *websocket.Conn, message interface{}) error {
+	b, messageType, err := messages.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(messageType, b)
+}
+
+// pkgHandler serves binaries, loaders and runtime scripts.
+type pkgHandler struct {
+	store *store
+}
+
+func (h *pkgHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(req.URL.Path, "/")
+	var key messages.DeployFileKey
+	switch {
+	case strings.HasSuffix(name, ".wasm"):
+		key = messages.DeployFileKey{Type: messages.DeployFileTypeWasm, Hash: strings.TrimSuffix(name, ".wasm")}
+		w.Header().Set("Content-Type", "application/wasm")
+	case strings.HasSuffix(name, ".js"):
+		key = messages.DeployFileKey{Type: messages.DeployFileTypeLoader, Hash: strings.TrimSuffix(name, ".js")}
+		w.Header().Set("Content-Type", "application/javascript")
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	serveFile(w, req, h.store, key)
+}
+
+// indexHandler serves index pages.
+type indexHandler struct {
+	store *store
+}
+
+func (h *indexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := messages.DeployFileKey{Type: messages.DeployFileTypeIndex, Hash: strings.TrimPrefix(req.URL.Path, "/")}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveFile(w, req, h.store, key)
+}
+
+func serveFile(w http.ResponseWriter, req *http.Request, s *store, key messages.DeployFileKey) {
+	if checkKey(key) != nil {
+		http.NotFound(w, req)
+		return
+	}
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	defer f.Close()
+	// files are named by the hash of their contents, so they never change
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if _, err := io.Copy(w, f); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
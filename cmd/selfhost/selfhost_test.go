@@ -0,0 +1,269 @@
+package selfhost
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dave/jsgo/server/servermsg"
+	"github.com/dave/jsgo/server/wasm/messages"
+	"github.com/dave/services/constor/constormsg"
+	"github.com/dave/wasmgo/cmd/cmdconfig"
+	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/gorilla/websocket"
+)
+
+// startServers starts the wasm, pkg and index hosts, storing files in a temp dir.
+func startServers(t *testing.T) (wasm, pkg, index *httptest.Server) {
+	s := &store{dir: t.TempDir()}
+	for _, dir := range []string{s.pkgDir(), s.indexDir()} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wasm = httptest.NewServer(&wasmHandler{store: s, debug: ioutil.Discard})
+	pkg = httptest.NewServer(&pkgHandler{store: s})
+	index = httptest.NewServer(&indexHandler{store: s})
+	t.Cleanup(func() {
+		wasm.Close()
+		pkg.Close()
+		index.Close()
+	})
+	return wasm, pkg, index
+}
+
+func get(t *testing.T, url string) []byte {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+var srcRegex = regexp.MustCompile(`(?:src|href)="([^"]+)"`)
+
+// TestDeploy deploys a package with the jsgo target and checks that every URL on the deployed
+// page, and the modules loaded by the loader, can be fetched from the hosts.
+func TestDeploy(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module hello\n\ngo 1.21\n",
+		"main.go": "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, split := range []string{"", deployer.SplitRuntime} {
+		t.Run("split="+split, func(t *testing.T) {
+			wasm, pkg, index := startServers(t)
+			ctx := context.Background()
+			d, err := deployer.New(ctx, &cmdconfig.Config{Command: "go", Split: split, WasmUrl: wasm.URL, PkgUrl: pkg.URL, IndexUrl: index.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache, err := deployer.NewCache(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.SetCache(cache)
+			result, err := d.Deploy(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			page := get(t, result.Page)
+			found := map[string]bool{}
+			for _, m := range srcRegex.FindAllSubmatch(page, -1) {
+				url := string(m[1])
+				found[url] = true
+				get(t, url)
+			}
+			for _, url := range []string{result.Script, result.Loader} {
+				if !found[url] {
+					t.Fatalf("%s isn't on the page:\n%s", url, page)
+				}
+			}
+
+			script, _, err := d.Script()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(get(t, result.Script), script) {
+				t.Fatal("deployed script doesn't match wasm_exec.js")
+			}
+			modules := []string{result.Binary}
+			if split != "" {
+				if result.Split == "" {
+					t.Fatal("binary wasn't split")
+				}
+				modules = append(modules, result.Split)
+			}
+			loader := get(t, result.Loader)
+			for _, url := range modules {
+				if !bytes.Contains(loader, []byte(url)) {
+					t.Fatalf("loader doesn't load %s:\n%s", url, loader)
+				}
+				if !bytes.HasPrefix(get(t, url), []byte("\x00asm")) {
+					t.Fatalf("%s isn't a WASM binary", url)
+				}
+			}
+		})
+	}
+}
+
+func dial(t *testing.T, wasm *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(wasm.URL, "http")+"/_wasm/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func file(typ messages.DeployFileType, contents string) messages.DeployFile {
+	return messages.DeployFile{
+		DeployFileKey: messages.DeployFileKey{Type: typ, Hash: fmt.Sprintf("%x", sha1.Sum([]byte(contents)))},
+		Contents:      []byte(contents),
+	}
+}
+
+// TestDeployExchange runs the deploy protocol against the server: a query, the payload of the
+// required files, and a second query for the same files, which the server already has.
+func TestDeployExchange(t *testing.T) {
+	wasm, pkg, index := startServers(t)
+	files := []messages.DeployFile{
+		file(messages.DeployFileTypeIndex, "<html></html>"),
+		file(messages.DeployFileTypeLoader, "console.log(1);"),
+		file(messages.DeployFileTypeWasm, "\x00asm\x01\x00\x00\x00"),
+	}
+	query := messages.DeployQuery{Version: deployer.CLIENT_VERSION}
+	for _, f := range files {
+		query.Files = append(query.Files, f.DeployFileKey)
+	}
+
+	conn := dial(t, wasm)
+	if err := send(conn, query); err != nil {
+		t.Fatal(err)
+	}
+	message, err := receive(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, ok := message.(messages.DeployQueryResponse)
+	if !ok {
+		t.Fatalf("expected deploy query response, got %#v", message)
+	}
+	if len(response.Required) != len(files) {
+		t.Fatalf("expected %d files to be required, got %d", len(files), len(response.Required))
+	}
+	if err := send(conn, messages.DeployPayload{Files: files}); err != nil {
+		t.Fatal(err)
+	}
+	for done := false; !done; {
+		message, err := receive(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch message := message.(type) {
+		case messages.DeployDone:
+			done = true
+		case constormsg.Storing:
+		default:
+			t.Fatalf("unexpected message %#v", message)
+		}
+	}
+
+	urls := []string{
+		index.URL + "/" + files[0].Hash,
+		pkg.URL + "/" + files[1].Hash + ".js",
+		pkg.URL + "/" + files[2].Hash + ".wasm",
+	}
+	for i, url := range urls {
+		if got := get(t, url); !bytes.Equal(got, files[i].Contents) {
+			t.Fatalf("%s: got %q, expected %q", url, got, files[i].Contents)
+		}
+	}
+
+	conn = dial(t, wasm)
+	if err := send(conn, query); err != nil {
+		t.Fatal(err)
+	}
+	message, err = receive(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, ok := message.(messages.DeployQueryResponse); !ok || len(response.Required) != 0 {
+		t.Fatalf("expected no files to be required, got %#v", message)
+	}
+}
+
+// TestDeployRejected checks the queries that the server refuses.
+func TestDeployRejected(t *testing.T) {
+	wasm, _, _ := startServers(t)
+	tests := map[string]struct {
+		query    messages.DeployQuery
+		expected interface{}
+	}{
+		"old client": {
+			query:    messages.DeployQuery{Version: "0.0.1"},
+			expected: messages.DeployClientVersionNotSupported{},
+		},
+		"unknown type": {
+			query:    messages.DeployQuery{Version: deployer.CLIENT_VERSION, Files: []messages.DeployFileKey{{Type: "script", Hash: file("", "a").Hash}}},
+			expected: servermsg.Error{Message: `unknown file type "script"`},
+		},
+		"invalid hash": {
+			query:    messages.DeployQuery{Version: deployer.CLIENT_VERSION, Files: []messages.DeployFileKey{{Type: messages.DeployFileTypeWasm, Hash: "../x"}}},
+			expected: servermsg.Error{Message: `invalid hash "../x"`},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			conn := dial(t, wasm)
+			if err := send(conn, test.query); err != nil {
+				t.Fatal(err)
+			}
+			message, err := receive(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message != test.expected {
+				t.Fatalf("got %#v, expected %#v", message, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dave/wasmgo/cmd/selfhost"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	serverCmd.PersistentFlags().StringVarP(&global.Dir, "dir", "d", "wasmgo-files", "Directory to store deployed files in.")
+	serverCmd.PersistentFlags().IntVar(&global.WasmPort, "wasm-port", 8083, "Port for the wasm host, which accepts deploys.")
+	serverCmd.PersistentFlags().IntVar(&global.PkgPort, "pkg-port", 8092, "Port for the pkg host, which serves binaries and scripts.")
+	serverCmd.PersistentFlags().IntVar(&global.IndexPort, "index-port", 8093, "Port for the index host, which serves index pages.")
+	rootCmd.AddCommand(serverCmd)
+}
+
+var serverCmd = &cobra.Command{
+	Use:   "server",
+	Short: "Run a deploy server",
+	Long:  "Starts a jsgo compatible deploy server, which accepts deploys from the deploy command and serves the deployed pages. Deploy to it with the --endpoints=local flag.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := selfhost.Start(global); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
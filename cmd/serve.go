@@ -10,13 +10,16 @@ import (
 
 func init() {
 	serveCmd.PersistentFlags().IntVarP(&global.Port, "port", "p", 8080, "Server port.")
+	serveCmd.PersistentFlags().BoolVar(&global.Hot, "hot", false, "Restart the Go program in open pages without reloading them when a rebuild succeeds.")
+	serveCmd.PersistentFlags().BoolVarP(&global.Watch, "watch", "w", true, "Rebuild in the background when a source file changes. If false, the WASM is recompiled on every page refresh.")
+	addSplitFlag(serveCmd)
 	rootCmd.AddCommand(serveCmd)
 }
 
 var serveCmd = &cobra.Command{
 	Use:   "serve [package]",
 	Short: "Serve locally",
-	Long:  "Starts a webserver locally, and recompiles the WASM on every page refresh, for testing and development.",
+	Long:  "Starts a webserver locally for testing and development. The package and its dependencies are watched, and the WASM is rebuilt in the background when a file changes.",
 	Args:  cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) > 0 {
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/dave/wasmgo/cmd/symbolicate"
+)
+
+// builder runs builds in the background and keeps the result of the last good build, so the
+// binary can be served while a newer build is in progress or after a build has failed.
+type builder struct {
+	dep   *deployer.State
+	debug io.Writer
+
+	// changed is called after a successful build that produced a different binary, or that
+	// followed a failed build, so pages showing the error are reloaded
+	changed func(contents, hash []byte)
+
+	mu       sync.Mutex
+	good     *binary       // last successful build
+	err      error         // error from the last build, or nil if it succeeded
+	building bool          // a build is in progress
+	pending  bool          // another build was requested while building
+	done     chan struct{} // closed when the build in progress finishes
+}
+
+type binary struct {
+	contents, hash []byte
+	split          []byte // secondary module, or nil if the binary isn't split
+
+	symOnce sync.Once
+	sym     *symbolicate.Symbolicator // decoded on first use, or nil if it can't be
+}
+
+// status describes the state of the builder for the dev loader.
+type status struct {
+	Building bool   `json:"building"`
+	Failed   bool   `json:"failed"`
+	Hash     string `json:"hash,omitempty"` // hash of the last good build
+}
+
+func newBuilder(dep *deployer.State, debug io.Writer, changed func(contents, hash []byte)) *builder {
+	return &builder{dep: dep, debug: debug, changed: changed}
+}
+
+// Rebuild starts a build in the background. If a build is in progress, another is started when it
+// finishes, so changes made during a build are never missed.
+func (b *builder) Rebuild() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.building {
+		b.pending = true
+		return
+	}
+	b.start()
+}
+
+// start must be called with mu held.
+func (b *builder) start() {
+	b.building = true
+	b.done = make(chan struct{})
+	go b.run()
+}
+
+func (b *builder) run() {
+	fmt.Fprintln(b.debug, "Compiling...")
+	// builds are shared by all requests, so they aren't cancelled with a request context
+	contents, hash, err := b.dep.Build(context.Background())
+	var split []byte
+	if err == nil {
+		contents, split, err = b.dep.Split(contents)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	} else {
+		fmt.Fprintf(b.debug, "Compiled WASM binary with hash %x\n", hash)
+	}
+
+	b.mu.Lock()
+	fixed := b.err != nil
+	b.err = err
+	changed := err == nil && (fixed || b.good != nil && !bytes.Equal(b.good.hash, hash))
+	if err == nil {
+		b.good = &binary{contents: contents, hash: hash, split: split}
+	}
+	close(b.done)
+	b.building = false
+	if b.pending {
+		b.pending = false
+		b.start()
+	}
+	b.mu.Unlock()
+
+	if changed && b.changed != nil {
+		b.changed(contents, hash)
+	}
+}
+
+// Wait blocks until no build is in progress.
+func (b *builder) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		building, done := b.building, b.done
+		b.mu.Unlock()
+		if !building {
+			return nil
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Binary returns the last good build. If there hasn't been a good build yet, it waits for the build
+// in progress, and returns its error if it fails.
+func (b *builder) Binary(ctx context.Context) (contents, hash []byte, err error) {
+	if err := b.Wait(ctx); err != nil {
+		return nil, nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.good == nil {
+		return nil, nil, b.err
+	}
+	return b.good.contents, b.good.hash, nil
+}
+
+// Split returns the secondary module of the last good build, or nil if there isn't one, it doesn't
+// have the given hash or its binary isn't split. An empty hash matches any build.
+func (b *builder) Split(hash string) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.good == nil || (hash != "" && hash != fmt.Sprintf("%x", b.good.hash)) {
+		return nil
+	}
+	return b.good.split
+}
+
+// Err returns the error from the last build, or nil if it succeeded.
+func (b *builder) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Symbolicator returns a symbolicator for the last good build, or nil if there isn't one or it
+// doesn't have the given hash. An empty hash matches any build. The binary is decoded without
+// holding the lock, so builds and status requests aren't held up.
+func (b *builder) Symbolicator(hash string) *symbolicate.Symbolicator {
+	b.mu.Lock()
+	good := b.good
+	b.mu.Unlock()
+	if good == nil || (hash != "" && hash != fmt.Sprintf("%x", good.hash)) {
+		return nil
+	}
+	good.symOnce.Do(func() {
+		sym, err := symbolicate.New(good.contents)
+		if err != nil {
+			fmt.Fprintf(b.debug, "Can't symbolicate binary: %v\n", err)
+			return
+		}
+		good.sym = sym
+	})
+	return good.sym
+}
+
+func (b *builder) Status() status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := status{Building: b.building, Failed: b.err != nil}
+	if b.good != nil {
+		s.Hash = fmt.Sprintf("%x", b.good.hash)
+	}
+	return s
+}
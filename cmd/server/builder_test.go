@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dave/wasmgo/cmd/cmdconfig"
+	"github.com/dave/wasmgo/cmd/deployer"
+)
+
+// TestRebuildAfterFailure checks that the first good build after a failed one is reported as a
+// change, so pages showing the build error are reloaded.
+func TestRebuildAfterFailure(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	write := func(name, contents string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module hello\n\ngo 1.21\n")
+	write("main.go", "package main\n\nfunc main() {\n\tvar s int = \"hello\"\n\tprintln(s)\n}\n")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	ctx := context.Background()
+	dep, err := deployer.New(ctx, &cmdconfig.Config{Command: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := deployer.NewCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep.SetCache(cache)
+	changed := make(chan []byte, 1)
+	b := newBuilder(dep, ioutil.Discard, func(contents, hash []byte) { changed <- hash })
+
+	b.Rebuild()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b.Err() == nil {
+		t.Fatal("expected the build to fail")
+	}
+
+	write("main.go", "package main\n\nfunc main() {\n\tvar s string = \"hello\"\n\tprintln(s)\n}\n")
+	b.Rebuild()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Err(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case hash := <-changed:
+		if status := b.Status(); fmt.Sprintf("%x", hash) != status.Hash {
+			t.Fatalf("reloaded with hash %x, expected %s", hash, status.Hash)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("fixing the build didn't reload the page")
+	}
+}
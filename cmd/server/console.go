@@ -0,0 +1,165 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/dave/wasmgo/cmd/symbolicate"
+)
+
+// console prints the console output, Go stdout and stderr, uncaught errors and exit codes that the
+// dev loader forwards from each page, prefixed by the browser that sent them. Stack traces are
+// symbolicated if the page is running the last good build.
+type console struct {
+	builder *builder
+	plain   bool                 // don't prefix output with the browser, for test runs
+	exited  func(code int)       // if set, called instead of printing the exit code
+	covered func(profile string) // called with the coverage profile of a test run
+	mu      sync.Mutex           // serializes output from different pages
+}
+
+// consoleMessage is sent by the dev loader.
+type consoleMessage struct {
+	Type  string `json:"type"`  // console, output, error, coverage or exit
+	Level string `json:"level"` // console method, for console messages
+	Fd    int    `json:"fd"`    // file descriptor, for output messages
+	Text  string `json:"text"`
+	Code  int    `json:"code"` // exit code, for exit messages
+	Hash  string `json:"hash"` // hash of the binary the page is running
+}
+
+func newConsole(builder *builder) *console {
+	return &console{builder: builder}
+}
+
+func (c *console) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	defer conn.Close()
+	prefix := fmt.Sprintf("[%s] ", shortAgent(req.UserAgent()))
+	if c.plain {
+		prefix = ""
+	}
+	// Go output is written in chunks, so it's buffered until a full line is available
+	partial := map[int]string{}
+	var sym *symbolicate.Symbolicator
+	flush := func() {
+		for fd, text := range partial {
+			if text != "" {
+				c.print(outputWriter(fd), prefix, text, sym)
+			}
+		}
+		partial = map[int]string{}
+	}
+	for {
+		var message consoleMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			flush()
+			return
+		}
+		sym = c.builder.Symbolicator(message.Hash)
+		switch message.Type {
+		case "output":
+			text := partial[message.Fd] + message.Text
+			i := strings.LastIndex(text, "\n")
+			if i == -1 {
+				partial[message.Fd] = text
+				continue
+			}
+			partial[message.Fd] = text[i+1:]
+			c.print(outputWriter(message.Fd), prefix, text[:i], sym)
+		case "console":
+			if message.Level == "log" || message.Level == "info" {
+				c.print(os.Stdout, prefix, message.Text, sym)
+			} else {
+				c.print(os.Stderr, prefix+message.Level+": ", message.Text, sym)
+			}
+		case "error":
+			c.print(os.Stderr, prefix+"uncaught: ", message.Text, sym)
+		case "coverage":
+			if c.covered != nil {
+				c.covered(message.Text)
+			}
+		case "exit":
+			flush()
+			if c.exited != nil {
+				c.exited(message.Code)
+				continue
+			}
+			c.print(os.Stderr, prefix, fmt.Sprintf("exit code: %d", message.Code), nil)
+		}
+	}
+}
+
+// print writes each line of text to w with the prefix. Wasm frames are symbolicated if sym is not
+// nil.
+func (c *console) print(w io.Writer, prefix, text string, sym *symbolicate.Symbolicator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if sym != nil {
+			line = sym.Line(line)
+		}
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
+
+func outputWriter(fd int) io.Writer {
+	if fd == 2 {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+var browserRegex = regexp.MustCompile(`(Edg|OPR|Firefox|FxiOS|CriOS|Chrome|Version)/(\d+)`)
+
+// browsers are the product tokens that identify a browser, in order of precedence - e.g. Edge user
+// agents also contain Chrome, and Chrome user agents also contain Safari.
+var browsers = []struct{ token, name string }{
+	{"Edg", "Edge"},
+	{"OPR", "Opera"},
+	{"Firefox", "Firefox"},
+	{"FxiOS", "Firefox"},
+	{"CriOS", "Chrome"},
+	{"Chrome", "Chrome"},
+	{"Version", "Safari"},
+}
+
+var platforms = []string{"Android", "iPhone", "iPad", "Windows", "Mac OS X", "CrOS", "Linux"}
+
+// shortAgent abbreviates a user agent to the browser, major version and platform, e.g. "Chrome 70
+// Android". Unrecognised user agents are returned in full.
+func shortAgent(ua string) string {
+	versions := map[string]string{}
+	for _, m := range browserRegex.FindAllStringSubmatch(ua, -1) {
+		versions[m[1]] = m[2]
+	}
+	var browser, platform string
+	for _, b := range browsers {
+		if version, ok := versions[b.token]; ok {
+			browser = b.name + " " + version
+			break
+		}
+	}
+	for _, p := range platforms {
+		if strings.Contains(ua, p) {
+			platform = p
+			break
+		}
+	}
+	if browser == "" || platform == "" {
+		if ua == "" {
+			return "unknown"
+		}
+		return ua
+	}
+	return browser + " " + platform
+}
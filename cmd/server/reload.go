@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// reloader keeps a websocket open to every tab showing the page, and tells them to reload when a
+// rebuild succeeds or the index template changes.
+type reloader struct {
+	debug io.Writer
+
+	mu sync.Mutex
+	// clients maps each connection to a mutex that serializes writes, because a websocket
+	// connection supports only one concurrent writer
+	clients map[*websocket.Conn]*sync.Mutex
+}
+
+// writeTimeout limits how long a write to a page can take, so a stalled tab doesn't hold up the
+// others.
+const writeTimeout = 10 * time.Second
+
+// reloadMessage is sent to the live reload client. A restart message is followed by a binary
+// message with the new WASM binary.
+type reloadMessage struct {
+	Type string `json:"type"`           // reload or restart
+	Hash string `json:"hash,omitempty"` // hash of the binary, for restart messages
+}
+
+var upgrader = websocket.Upgrader{
+	// only pages served by this server connect, but the origin may be any of its host names
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func newReloader(debug io.Writer) *reloader {
+	return &reloader{debug: debug, clients: map[*websocket.Conn]*sync.Mutex{}}
+}
+
+// ServeHTTP handles websocket connections from the live reload client.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	r.mu.Lock()
+	r.clients[conn] = &sync.Mutex{}
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, conn)
+		r.mu.Unlock()
+		conn.Close()
+	}()
+	// the client doesn't send anything, but reading is needed to notice when it disconnects
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// Reload tells every connected tab to reload.
+func (r *reloader) Reload() {
+	r.send(reloadMessage{Type: "reload"})
+}
+
+// Restart sends a new binary to every connected tab. The dev loader stops the running Go program
+// and runs the new one without reloading the page.
+func (r *reloader) Restart(contents, hash []byte) {
+	r.send(reloadMessage{Type: "restart", Hash: fmt.Sprintf("%x", hash)}, contents)
+}
+
+// send writes message to every client, followed by payload as a binary message if it's not nil.
+func (r *reloader) send(message reloadMessage, payload ...[]byte) {
+	b, err := json.Marshal(message)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	// the clients are copied so the writes don't hold the lock, which would block new connections
+	// and disconnects while a slow tab is being written to
+	r.mu.Lock()
+	clients := make(map[*websocket.Conn]*sync.Mutex, len(r.clients))
+	for conn, wmu := range r.clients {
+		clients[conn] = wmu
+	}
+	r.mu.Unlock()
+	if len(clients) > 0 {
+		fmt.Fprintf(r.debug, "Sending %s to %d connected pages\n", message.Type, len(clients))
+	}
+	for conn, wmu := range clients {
+		wmu.Lock()
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		err := conn.WriteMessage(websocket.TextMessage, b)
+		for _, p := range payload {
+			if err == nil {
+				err = conn.WriteMessage(websocket.BinaryMessage, p)
+			}
+		}
+		wmu.Unlock()
+		if err != nil {
+			// the read loop will notice the connection has gone and remove it
+			conn.Close()
+		}
+	}
+}
+
+// reloadScript is the live reload client. If the connection drops (e.g. because the server was
+// restarted), it reconnects and reloads the page. New binaries for hot restart are passed to the
+// dev loader, or the page is reloaded if the loader isn't present (e.g. in a custom template).
+const reloadScript = `(() => {
+	const url = new URL("/_wasmgo/reload", document.currentScript.src);
+	url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+	let disconnected = false;
+	let restartHash = "";
+	const connect = () => {
+		const socket = new WebSocket(url);
+		socket.binaryType = "arraybuffer";
+		socket.onopen = () => {
+			if (disconnected) {
+				location.reload();
+			}
+		};
+		socket.onmessage = event => {
+			if (event.data instanceof ArrayBuffer) {
+				if (window.wasmgo && window.wasmgo.restart) {
+					window.wasmgo.restart(event.data, restartHash);
+				} else {
+					location.reload();
+				}
+				return;
+			}
+			const message = JSON.parse(event.data);
+			switch (message.type) {
+			case "reload":
+				location.reload();
+				break;
+			case "restart":
+				restartHash = message.hash;
+				break;
+			}
+		};
+		socket.onclose = () => {
+			disconnected = true;
+			setTimeout(connect, 1000);
+		};
+	};
+	connect();
+})();
+`
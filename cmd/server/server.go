@@ -2,6 +2,9 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,7 +12,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/dave/wasmgo/cmd/cmdconfig"
@@ -19,6 +24,82 @@ import (
 
 func Start(cfg *cmdconfig.Config) error {
 
+	svr, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Watch {
+		svr.builder.Rebuild()
+		go newWatcher(svr.dep, svr.debug, svr.changed).Run(context.Background())
+	}
+
+	svr.listen()
+
+	// Set up graceful shutdown
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// Wait for shutdown signal
+	<-stop
+
+	fmt.Fprintln(svr.debug, "Stopping server")
+
+	return nil
+}
+
+// Test builds the test binary for the package and serves it until a page has run it. The output of
+// the tests is written to stdout and stderr without the browser prefix, and the exit code of the
+// test binary is returned.
+func Test(cfg *cmdconfig.Config) (int, error) {
+
+	svr, err := newServer(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	// build before starting the server, so compiler errors are reported without opening a page
+	if _, _, err := svr.dep.Build(context.Background()); err != nil {
+		return 0, err
+	}
+
+	exited := make(chan int, 1)
+	var coverErr error
+	var coverOnce sync.Once
+	svr.console.plain = true
+	svr.console.covered = func(profile string) {
+		// the profile is sent before the exit code, so it's written before Test returns
+		coverOnce.Do(func() {
+			if cfg.Cover != "" {
+				coverErr = ioutil.WriteFile(cfg.Cover, []byte(profile), 0666)
+			}
+		})
+	}
+	svr.console.exited = func(code int) {
+		select {
+		case exited <- code:
+		default:
+		}
+	}
+
+	svr.listen()
+	if !cfg.Open {
+		fmt.Fprintf(os.Stderr, "Open http://localhost:%d/ in a browser to run the tests.\n", cfg.Port)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case code := <-exited:
+		return code, coverErr
+	case <-stop:
+		return 0, errors.New("interrupted before the tests finished")
+	}
+}
+
+func newServer(cfg *cmdconfig.Config) (*server, error) {
+
 	var debug io.Writer
 	if cfg.Verbose {
 		debug = os.Stdout
@@ -26,64 +107,146 @@ func Start(cfg *cmdconfig.Config) error {
 		debug = ioutil.Discard
 	}
 
-	dep, err := deployer.New(cfg)
+	dep, err := deployer.New(context.Background(), cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	svr := &server{cfg: cfg, dep: dep, debug: debug}
+	svr.reloader = newReloader(debug)
+	svr.builder = newBuilder(dep, debug, svr.rebuilt)
+	svr.console = newConsole(svr.builder)
+	return svr, nil
+}
 
-	s := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Port), Handler: svr}
+// listen starts the server in the background, and opens the page if the open flag is set.
+func (s *server) listen() {
+	h := &http.Server{Addr: fmt.Sprintf(":%d", s.cfg.Port), Handler: s}
 
 	go func() {
-		fmt.Fprintf(debug, "Starting server on %s\n", s.Addr)
-		if err := s.ListenAndServe(); err != http.ErrServerClosed {
+		fmt.Fprintf(s.debug, "Starting server on %s\n", h.Addr)
+		if err := h.ListenAndServe(); err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
 
 	go func() {
-		if cfg.Open {
-			browser.OpenURL(fmt.Sprintf("http://localhost:%d/", cfg.Port))
+		if s.cfg.Open {
+			browser.OpenURL(fmt.Sprintf("http://localhost:%d/", s.cfg.Port))
 		}
 	}()
+}
 
-	// Set up graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-
-	// Wait for shutdown signal
-	<-stop
-
-	fmt.Fprintln(debug, "Stopping server")
+type server struct {
+	cfg      *cmdconfig.Config
+	dep      *deployer.State
+	debug    io.Writer
+	builder  *builder
+	reloader *reloader
+	console  *console
+}
 
-	return nil
+// rebuilt is called by the builder when a build produces a new binary. Open pages are reloaded, or
+// with the hot flag, sent the new binary to run without a reload.
+func (s *server) rebuilt(contents, hash []byte) {
+	if s.cfg.Hot {
+		s.reloader.Restart(contents, hash)
+		return
+	}
+	s.reloader.Reload()
 }
 
-type server struct {
-	cfg   *cmdconfig.Config
-	dep   *deployer.State
-	debug io.Writer
+// changed is called by the watcher. Changes to the index template reload the page straight away,
+// and any other change starts a rebuild, which reloads the page if the binary changes.
+func (s *server) changed(names []string) {
+	index := s.dep.IndexFile()
+	if index != "" {
+		if abs, err := filepath.Abs(index); err == nil {
+			index = abs
+		}
+	}
+	rebuild := false
+	for _, name := range names {
+		if name == index {
+			s.reloader.Reload()
+		} else {
+			rebuild = true
+		}
+	}
+	if rebuild {
+		s.builder.Rebuild()
+	}
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	switch {
 	case strings.HasSuffix(req.RequestURI, "/favicon.ico"):
 		// ignore
+	case req.URL.Path == "/_wasmgo/reload":
+		// live reload websocket
+		s.reloader.ServeHTTP(w, req)
+	case req.URL.Path == "/_wasmgo/console":
+		// console output forwarded by the dev loader
+		s.console.ServeHTTP(w, req)
+	case strings.HasSuffix(req.RequestURI, "/reload.js"):
+		// live reload client
+		w.Header().Set("Content-Type", "application/javascript")
+		if _, err := io.WriteString(w, reloadScript); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
 	case strings.HasSuffix(req.RequestURI, "/binary.wasm"):
-		// binary
-		contents, hash, err := s.dep.Build()
+		// binary - the last good build, unless there hasn't been one yet
+		if !s.cfg.Watch {
+			// without the watcher, every request for the binary rebuilds it
+			if err := s.rebuild(req.Context()); err != nil {
+				s.writeErrors(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		contents, hash, err := s.builder.Binary(req.Context())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
+			s.writeErrors(w, http.StatusInternalServerError, err)
+			return
 		}
 		w.Header().Set("Content-Type", "application/wasm")
+		w.Header().Set("X-Wasmgo-Hash", fmt.Sprintf("%x", hash))
 		if _, err := io.Copy(w, bytes.NewReader(contents)); err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 		}
-		fmt.Fprintf(s.debug, "Compiled WASM binary with hash %x\n", hash)
+	case strings.HasSuffix(req.URL.Path, "/split.wasm"):
+		// secondary module of the last good build - the dev loader adds the hash of the binary it's
+		// running as the query, so it never gets the module of a different build
+		split := s.builder.Split(req.URL.RawQuery)
+		if split == nil {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/wasm")
+		if _, err := io.Copy(w, bytes.NewReader(split)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	case strings.HasSuffix(req.RequestURI, "/errors.json"):
+		// compiler diagnostics for editors - empty if the last build succeeded
+		if !s.cfg.Watch {
+			s.builder.Rebuild()
+		}
+		if err := s.builder.Wait(req.Context()); err != nil {
+			return
+		}
+		s.writeErrors(w, http.StatusOK, s.builder.Err())
+	case strings.HasSuffix(req.RequestURI, "/status.json"):
+		// build status for the indicator shown by the dev loader
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.builder.Status()); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
 	case strings.HasSuffix(req.RequestURI, "/loader.js"):
 		// loader js
-		contents, _, err := s.dep.Loader("/binary.wasm")
+		splitUrl := ""
+		if s.cfg.Split != "" {
+			splitUrl = "/split.wasm"
+		}
+		contents, _, err := s.dep.DevLoader("/binary.wasm", splitUrl)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 		}
@@ -93,13 +256,22 @@ func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	case strings.HasSuffix(req.RequestURI, "/script.js"):
 		// script
+		contents, _, err := s.dep.Script()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
 		w.Header().Set("Content-Type", "application/javascript")
-		if _, err := io.Copy(w, bytes.NewBufferString(WasmExec)); err != nil {
+		if _, err := io.Copy(w, bytes.NewReader(contents)); err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 		}
 	default:
 		// index page
-		contents, _, err := s.dep.Index("/script.js", "/loader.js", "/binary.wasm")
+		devUrl := ""
+		if s.cfg.Watch {
+			// pages are only reloaded when the watcher rebuilds in the background
+			devUrl = "/reload.js"
+		}
+		contents, _, err := s.dep.DevIndex("/script.js", "/loader.js", "/binary.wasm", devUrl)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 		}
@@ -110,4 +282,35 @@ func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-const WasmExec = `(()=>{if("undefined"!=typeof global);else if("undefined"!=typeof window)window.global=window;else{if("undefined"==typeof self)throw new Error("cannot export Go (neither global, window nor self is defined)");self.global=self}const e=global.process&&"node"===global.process.title;if(e){global.require=require,global.fs=require("fs");const e=require("crypto");global.crypto={getRandomValues(t){e.randomFillSync(t)}},global.performance={now(){const[e,t]=process.hrtime();return 1e3*e+t/1e6}};const t=require("util");global.TextEncoder=t.TextEncoder,global.TextDecoder=t.TextDecoder}else{let e="";global.fs={constants:{O_WRONLY:-1,O_RDWR:-1,O_CREAT:-1,O_TRUNC:-1,O_APPEND:-1,O_EXCL:-1},writeSync(t,n){const i=(e+=s.decode(n)).lastIndexOf("\n");return-1!=i&&(console.log(e.substr(0,i)),e=e.substr(i+1)),n.length},write(e,t,s,n,i,r){if(0!==s||n!==t.length||null!==i)throw new Error("not implemented");r(null,this.writeSync(e,t))},open(e,t,s,n){const i=new Error("not implemented");i.code="ENOSYS",n(i)},read(e,t,s,n,i,r){const o=new Error("not implemented");o.code="ENOSYS",r(o)},fsync(e,t){t(null)}}}const t=new TextEncoder("utf-8"),s=new TextDecoder("utf-8");if(global.Go=class{constructor(){this.argv=["js"],this.env={},this.exit=(e=>{0!==e&&console.warn("exit code:",e)}),this._exitPromise=new Promise(e=>{this._resolveExitPromise=e}),this._pendingEvent=null,this._scheduledTimeouts=new Map,this._nextCallbackTimeoutID=1;const e=()=>new DataView(this._inst.exports.mem.buffer),n=(t,s)=>{e().setUint32(t+0,s,!0),e().setUint32(t+4,Math.floor(s/4294967296),!0)},i=t=>{return e().getUint32(t+0,!0)+4294967296*e().getInt32(t+4,!0)},r=t=>{const s=e().getFloat64(t,!0);if(0===s)return;if(!isNaN(s))return s;const n=e().getUint32(t,!0);return this._values[n]},o=(t,s)=>{if("number"==typeof s)return isNaN(s)?(e().setUint32(t+4,2146959360,!0),void e().setUint32(t,0,!0)):0===s?(e().setUint32(t+4,2146959360,!0),void e().setUint32(t,1,!0)):void e().setFloat64(t,s,!0);switch(s){case void 0:return void e().setFloat64(t,0,!0);case null:return e().setUint32(t+4,2146959360,!0),void e().setUint32(t,2,!0);case!0:return e().setUint32(t+4,2146959360,!0),void e().setUint32(t,3,!0);case!1:return e().setUint32(t+4,2146959360,!0),void e().setUint32(t,4,!0)}let n=this._refs.get(s);void 0===n&&(n=this._values.length,this._values.push(s),this._refs.set(s,n));let i=0;switch(typeof s){case"string":i=1;break;case"symbol":i=2;break;case"function":i=3}e().setUint32(t+4,2146959360|i,!0),e().setUint32(t,n,!0)},l=e=>{const t=i(e+0),s=i(e+8);return new Uint8Array(this._inst.exports.mem.buffer,t,s)},a=e=>{const t=i(e+0),s=i(e+8),n=new Array(s);for(let e=0;e<s;e++)n[e]=r(t+8*e);return n},c=e=>{const t=i(e+0),n=i(e+8);return s.decode(new DataView(this._inst.exports.mem.buffer,t,n))},u=Date.now()-performance.now();this.importObject={go:{"runtime.wasmExit":t=>{const s=e().getInt32(t+8,!0);this.exited=!0,delete this._inst,delete this._values,delete this._refs,this.exit(s)},"runtime.wasmWrite":t=>{const s=i(t+8),n=i(t+16),r=e().getInt32(t+24,!0);fs.writeSync(s,new Uint8Array(this._inst.exports.mem.buffer,n,r))},"runtime.nanotime":e=>{n(e+8,1e6*(u+performance.now()))},"runtime.walltime":t=>{const s=(new Date).getTime();n(t+8,s/1e3),e().setInt32(t+16,s%1e3*1e6,!0)},"runtime.scheduleTimeoutEvent":t=>{const s=this._nextCallbackTimeoutID;this._nextCallbackTimeoutID++,this._scheduledTimeouts.set(s,setTimeout(()=>{this._resume()},i(t+8)+1)),e().setInt32(t+16,s,!0)},"runtime.clearTimeoutEvent":t=>{const s=e().getInt32(t+8,!0);clearTimeout(this._scheduledTimeouts.get(s)),this._scheduledTimeouts.delete(s)},"runtime.getRandomData":e=>{crypto.getRandomValues(l(e+8))},"syscall/js.stringVal":e=>{o(e+24,c(e+8))},"syscall/js.valueGet":e=>{const t=Reflect.get(r(e+8),c(e+16));e=this._inst.exports.getsp(),o(e+32,t)},"syscall/js.valueSet":e=>{Reflect.set(r(e+8),c(e+16),r(e+32))},"syscall/js.valueIndex":e=>{o(e+24,Reflect.get(r(e+8),i(e+16)))},"syscall/js.valueSetIndex":e=>{Reflect.set(r(e+8),i(e+16),r(e+24))},"syscall/js.valueCall":t=>{try{const s=r(t+8),n=Reflect.get(s,c(t+16)),i=a(t+32),l=Reflect.apply(n,s,i);t=this._inst.exports.getsp(),o(t+56,l),e().setUint8(t+64,1)}catch(s){o(t+56,s),e().setUint8(t+64,0)}},"syscall/js.valueInvoke":t=>{try{const s=r(t+8),n=a(t+16),i=Reflect.apply(s,void 0,n);t=this._inst.exports.getsp(),o(t+40,i),e().setUint8(t+48,1)}catch(s){o(t+40,s),e().setUint8(t+48,0)}},"syscall/js.valueNew":t=>{try{const s=r(t+8),n=a(t+16),i=Reflect.construct(s,n);t=this._inst.exports.getsp(),o(t+40,i),e().setUint8(t+48,1)}catch(s){o(t+40,s),e().setUint8(t+48,0)}},"syscall/js.valueLength":e=>{n(e+16,parseInt(r(e+8).length))},"syscall/js.valuePrepareString":e=>{const s=t.encode(String(r(e+8)));o(e+16,s),n(e+24,s.length)},"syscall/js.valueLoadString":e=>{const t=r(e+8);l(e+16).set(t)},"syscall/js.valueInstanceOf":t=>{e().setUint8(t+24,r(t+8)instanceof r(t+16))},debug:e=>{console.log(e)}}}}async run(e){this._inst=e,this._values=[NaN,0,null,!0,!1,global,this._inst.exports.mem,this],this._refs=new Map,this.exited=!1;const s=new DataView(this._inst.exports.mem.buffer);let n=4096;const i=e=>{let i=n;return new Uint8Array(s.buffer,n,e.length+1).set(t.encode(e+"\0")),n+=e.length+(8-e.length%8),i},r=this.argv.length,o=[];this.argv.forEach(e=>{o.push(i(e))});const l=Object.keys(this.env).sort();o.push(l.length),l.forEach(e=>{o.push(i(` + "`" + `${e}=${this.env[e]}` + "`" + `))});const a=n;o.forEach(e=>{s.setUint32(n,e,!0),s.setUint32(n+4,0,!0),n+=8}),this._inst.exports.run(r,a),this.exited&&this._resolveExitPromise(),await this._exitPromise}_resume(){if(this.exited)throw new Error("Go program has already exited");this._inst.exports.resume(),this.exited&&this._resolveExitPromise()}_makeFuncWrapper(e){const t=this;return function(){const s={id:e,this:this,args:arguments};return t._pendingEvent=s,t._resume(),s.result}}},e){process.argv.length<3&&(process.stderr.write("usage: go_js_wasm_exec [wasm binary] [arguments]\n"),process.exit(1));const e=new Go;e.argv=process.argv.slice(2),e.env=Object.assign({TMPDIR:require("os").tmpdir()},process.env),e.exit=process.exit,WebAssembly.instantiate(fs.readFileSync(process.argv[2]),e.importObject).then(t=>(process.on("exit",t=>{0!==t||e.exited||(e._pendingEvent={id:0},e._resume())}),e.run(t.instance))).catch(e=>{throw e})}(()=>{if("undefined"!=typeof global);else if("undefined"!=typeof window)window.global=window;else{if("undefined"==typeof self)throw new Error("cannot export Go (neither global, window nor self is defined)");self.global=self}const e=global.process&&"node"===global.process.title;if(e){global.require=require,global.fs=require("fs");const e=require("crypto");global.crypto={getRandomValues(t){e.randomFillSync(t)}},global.performance={now(){const[e,t]=process.hrtime();return 1e3*e+t/1e6}};const t=require("util");global.TextEncoder=t.TextEncoder,global.TextDecoder=t.TextDecoder}else{let e="";global.fs={constants:{O_WRONLY:-1,O_RDWR:-1,O_CREAT:-1,O_TRUNC:-1,O_APPEND:-1,O_EXCL:-1},writeSync(t,n){const i=(e+=s.decode(n)).lastIndexOf("\n");return-1!=i&&(console.log(e.substr(0,i)),e=e.substr(i+1)),n.length},write(e,t,s,n,i,r){if(0!==s||n!==t.length||null!==i)throw new Error("not implemented");r(null,this.writeSync(e,t))},open(e,t,s,n){const i=new Error("not implemented");i.code="ENOSYS",n(i)},read(e,t,s,n,i,r){const o=new Error("not implemented");o.code="ENOSYS",r(o)},fsync(e,t){t(null)}}}const t=new TextEncoder("utf-8"),s=new TextDecoder("utf-8");if(global.Go=class{constructor(){this.argv=["js"],this.env={},this.exit=(e=>{0!==e&&console.warn("exit code:",e)}),this._exitPromise=new Promise(e=>{this._resolveExitPromise=e}),this._pendingEvent=null,this._scheduledTimeouts=new Map,this._nextCallbackTimeoutID=1;const e=()=>new DataView(this._inst.exports.mem.buffer),n=(t,s)=>{e().setUint32(t+0,s,!0),e().setUint32(t+4,Math.floor(s/4294967296),!0)},i=t=>{return e().getUint32(t+0,!0)+4294967296*e().getInt32(t+4,!0)},r=t=>{const s=e().getFloat64(t,!0);if(0===s)return;if(!isNaN(s))return s;const n=e().getUint32(t,!0);return this._values[n]},o=(t,s)=>{if("number"==typeof s)return isNaN(s)?(e().setUint32(t+4,2146959360,!0),void e().setUint32(t,0,!0)):0===s?(e().setUint32(t+4,2146959360,!0),void e().setUint32(t,1,!0)):void e().setFloat64(t,s,!0);switch(s){case void 0:return void e().setFloat64(t,0,!0);case null:return e().setUint32(t+4,2146959360,!0),void e().setUint32(t,2,!0);case!0:return e().setUint32(t+4,2146959360,!0),void e().setUint32(t,3,!0);case!1:return e().setUint32(t+4,2146959360,!0),void e().setUint32(t,4,!0)}let n=this._refs.get(s);void 0===n&&(n=this._values.length,this._values.push(s),this._refs.set(s,n));let i=0;switch(typeof s){case"string":i=1;break;case"symbol":i=2;break;case"function":i=3}e().setUint32(t+4,2146959360|i,!0),e().setUint32(t,n,!0)},l=e=>{const t=i(e+0),s=i(e+8);return new Uint8Array(this._inst.exports.mem.buffer,t,s)},a=e=>{const t=i(e+0),s=i(e+8),n=new Array(s);for(let e=0;e<s;e++)n[e]=r(t+8*e);return n},c=e=>{const t=i(e+0),n=i(e+8);return s.decode(new DataView(this._inst.exports.mem.buffer,t,n))},u=Date.now()-performance.now();this.importObject={go:{"runtime.wasmExit":t=>{const s=e().getInt32(t+8,!0);this.exited=!0,delete this._inst,delete this._values,delete this._refs,this.exit(s)},"runtime.wasmWrite":t=>{const s=i(t+8),n=i(t+16),r=e().getInt32(t+24,!0);fs.writeSync(s,new Uint8Array(this._inst.exports.mem.buffer,n,r))},"runtime.nanotime":e=>{n(e+8,1e6*(u+performance.now()))},"runtime.walltime":t=>{const s=(new Date).getTime();n(t+8,s/1e3),e().setInt32(t+16,s%1e3*1e6,!0)},"runtime.scheduleTimeoutEvent":t=>{const s=this._nextCallbackTimeoutID;this._nextCallbackTimeoutID++,this._scheduledTimeouts.set(s,setTimeout(()=>{this._resume()},i(t+8)+1)),e().setInt32(t+16,s,!0)},"runtime.clearTimeoutEvent":t=>{const s=e().getInt32(t+8,!0);clearTimeout(this._scheduledTimeouts.get(s)),this._scheduledTimeouts.delete(s)},"runtime.getRandomData":e=>{crypto.getRandomValues(l(e+8))},"syscall/js.stringVal":e=>{o(e+24,c(e+8))},"syscall/js.valueGet":e=>{const t=Reflect.get(r(e+8),c(e+16));e=this._inst.exports.getsp(),o(e+32,t)},"syscall/js.valueSet":e=>{Reflect.set(r(e+8),c(e+16),r(e+32))},"syscall/js.valueIndex":e=>{o(e+24,Reflect.get(r(e+8),i(e+16)))},"syscall/js.valueSetIndex":e=>{Reflect.set(r(e+8),i(e+16),r(e+24))},"syscall/js.valueCall":t=>{try{const s=r(t+8),n=Reflect.get(s,c(t+16)),i=a(t+32),l=Reflect.apply(n,s,i);t=this._inst.exports.getsp(),o(t+56,l),e().setUint8(t+64,1)}catch(s){o(t+56,s),e().setUint8(t+64,0)}},"syscall/js.valueInvoke":t=>{try{const s=r(t+8),n=a(t+16),i=Reflect.apply(s,void 0,n);t=this._inst.exports.getsp(),o(t+40,i),e().setUint8(t+48,1)}catch(s){o(t+40,s),e().setUint8(t+48,0)}},"syscall/js.valueNew":t=>{try{const s=r(t+8),n=a(t+16),i=Reflect.construct(s,n);t=this._inst.exports.getsp(),o(t+40,i),e().setUint8(t+48,1)}catch(s){o(t+40,s),e().setUint8(t+48,0)}},"syscall/js.valueLength":e=>{n(e+16,parseInt(r(e+8).length))},"syscall/js.valuePrepareString":e=>{const s=t.encode(String(r(e+8)));o(e+16,s),n(e+24,s.length)},"syscall/js.valueLoadString":e=>{const t=r(e+8);l(e+16).set(t)},"syscall/js.valueInstanceOf":t=>{e().setUint8(t+24,r(t+8)instanceof r(t+16))},debug:e=>{console.log(e)}}}}async run(e){this._inst=e,this._values=[NaN,0,null,!0,!1,global,this._inst.exports.mem,this],this._refs=new Map,this.exited=!1;const s=new DataView(this._inst.exports.mem.buffer);let n=4096;const i=e=>{let i=n;return new Uint8Array(s.buffer,n,e.length+1).set(t.encode(e+"\0")),n+=e.length+(8-e.length%8),i},r=this.argv.length,o=[];this.argv.forEach(e=>{o.push(i(e))});const l=Object.keys(this.env).sort();o.push(l.length),l.forEach(e=>{o.push(i(` + "`" + `${e}=${this.env[e]}` + "`" + `))});const a=n;o.forEach(e=>{s.setUint32(n,e,!0),s.setUint32(n+4,0,!0),n+=8}),this._inst.exports.run(r,a),this.exited&&this._resolveExitPromise(),await this._exitPromise}_resume(){if(this.exited)throw new Error("Go program has already exited");this._inst.exports.resume(),this.exited&&this._resolveExitPromise()}_makeFuncWrapper(e){const t=this;return function(){const s={id:e,this:this,args:arguments};return t._pendingEvent=s,t._resume(),s.result}}},e){process.argv.length<3&&(process.stderr.write("usage: go_js_wasm_exec [wasm binary] [arguments]\n"),process.exit(1));const e=new Go;e.argv=process.argv.slice(2),e.env=Object.assign({TMPDIR:require("os").tmpdir()},process.env),e.exit=process.exit,WebAssembly.instantiate(fs.readFileSync(process.argv[2]),e.importObject).then(t=>(process.on("exit",t=>{0!==t||e.exited||(e._pendingEvent={id:0},e._resume())}),e.run(t.instance))).catch(e=>{throw e})}})()})();`
+// rebuild builds the binary and waits for the result.
+func (s *server) rebuild(ctx context.Context) error {
+	s.builder.Rebuild()
+	if err := s.builder.Wait(ctx); err != nil {
+		return err
+	}
+	return s.builder.Err()
+}
+
+// writeErrors writes the diagnostics from a failed build as json. If err is nil, the list of
+// diagnostics is empty.
+func (s *server) writeErrors(w http.ResponseWriter, status int, err error) {
+	response := struct {
+		Error       string                `json:"error,omitempty"`
+		Diagnostics []deployer.Diagnostic `json:"diagnostics"`
+	}{
+		Diagnostics: []deployer.Diagnostic{},
+	}
+	if err != nil {
+		response.Error = err.Error()
+		if be, ok := err.(*deployer.BuildError); ok {
+			response.Diagnostics = be.Diagnostics
+		} else {
+			response.Diagnostics = []deployer.Diagnostic{{Message: err.Error()}}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dave/wasmgo/cmd/deployer"
+)
+
+// pollInterval is how often the watched directories are scanned for changes.
+const pollInterval = 500 * time.Millisecond
+
+// watcher polls the directories of the package and its non-standard-library dependencies, and
+// calls changed with the names of any files that are added, removed or modified. Polling is used
+// so no platform specific file notification API is needed.
+type watcher struct {
+	dep     *deployer.State
+	debug   io.Writer
+	changed func(names []string)
+
+	dirs  []string
+	files map[string]fileState
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func newWatcher(dep *deployer.State, debug io.Writer, changed func(names []string)) *watcher {
+	return &watcher{dep: dep, debug: debug, changed: changed}
+}
+
+// Run watches for changes until ctx is cancelled.
+func (w *watcher) Run(ctx context.Context) {
+	w.refresh(ctx)
+	w.files = w.scan()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		files := w.scan()
+		if names := diff(w.files, files); len(names) > 0 {
+			for _, name := range names {
+				fmt.Fprintf(w.debug, "Detected change in %s\n", name)
+			}
+			w.files = files
+			// imports may have changed, so the dependency directories are listed again
+			if w.refresh(ctx) {
+				w.files = w.scan()
+			}
+			w.changed(names)
+		}
+	}
+}
+
+// refresh updates the list of watched directories, and reports whether it changed. If the package
+// can't be listed (e.g. because of a syntax error in an import), the previous list is kept.
+func (w *watcher) refresh(ctx context.Context) bool {
+	dirs, err := w.dep.WatchDirs(ctx)
+	if err != nil {
+		fmt.Fprintf(w.debug, "Listing dependencies: %v\n", err)
+		return false
+	}
+	if index := w.dep.IndexFile(); index != "" {
+		if abs, err := filepath.Abs(filepath.Dir(index)); err == nil && !contains(dirs, abs) {
+			dirs = append(dirs, abs)
+		}
+	}
+	if strings.Join(dirs, "\n") == strings.Join(w.dirs, "\n") {
+		return false
+	}
+	w.dirs = dirs
+	fmt.Fprintf(w.debug, "Watching %d directories\n", len(dirs))
+	return true
+}
+
+func (w *watcher) scan() map[string]fileState {
+	files := map[string]fileState{}
+	for _, dir := range w.dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if info.IsDir() || ignored(info.Name()) {
+				continue
+			}
+			files[filepath.Join(dir, info.Name())] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return files
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored reports whether the file is an editor backup or temporary file.
+func ignored(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".swp")
+}
+
+// diff returns the names of the files that differ between before and after.
+func diff(before, after map[string]fileState) []string {
+	var names []string
+	for name, a := range after {
+		if b, ok := before[name]; !ok || !a.modTime.Equal(b.modTime) || a.size != b.size {
+			names = append(names, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/dave/wasmgo/cmd/size"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	sizeCmd.PersistentFlags().IntVarP(&global.Top, "top", "n", 20, "Number of packages and functions to show, or 0 for all.")
+	sizeCmd.PersistentFlags().BoolVarP(&global.Json, "json", "j", false, "Print the report as json.")
+	rootCmd.AddCommand(sizeCmd)
+}
+
+var sizeCmd = &cobra.Command{
+	Use:   "size [package|binary.wasm]",
+	Short: "Show what takes up space in the binary",
+	Long:  "Compiles the package to WASM (or takes an existing binary) and attributes the code section to functions and Go packages, using the function names in the binary. The section sizes and the gzip and brotli compressed sizes are also shown.",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := printSize(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func printSize(args []string) error {
+	if global.Top < 0 {
+		return errors.New("top must not be negative")
+	}
+	binary, err := loadBinary(args)
+	if err != nil {
+		return err
+	}
+	report, err := size.Analyze(binary)
+	if err != nil {
+		return err
+	}
+	if global.Top > 0 {
+		report = report.Top(global.Top)
+	}
+	if global.Json {
+		b, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	return report.Write(os.Stdout)
+}
+
+// loadBinary reads the binary if the argument is a .wasm file, and otherwise builds the package.
+// Progress messages go to stderr, so the output of the command can be piped.
+func loadBinary(args []string) ([]byte, error) {
+	if len(args) > 0 && strings.HasSuffix(args[0], ".wasm") {
+		return ioutil.ReadFile(args[0])
+	}
+	if len(args) > 0 {
+		global.Path = args[0]
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	d, err := deployer.New(ctx, global)
+	if err != nil {
+		return nil, err
+	}
+	if global.Verbose {
+		d.SetDebug(os.Stderr)
+	}
+	binary, _, err := d.Build(ctx)
+	return binary, err
+}
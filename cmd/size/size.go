@@ -0,0 +1,249 @@
+// Package size attributes the bytes of a wasm binary to functions and Go packages.
+package size
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dave/wasmgo/cmd/wasmbin"
+	"github.com/dustin/go-humanize"
+)
+
+// BrotliCommand is the name of the command used to estimate the brotli compressed size.
+const BrotliCommand = "brotli"
+
+// Report describes where the bytes of a binary go. Functions and packages are sorted by size, the
+// biggest first.
+type Report struct {
+	Total     int        `json:"total"`
+	Gzip      int        `json:"gzip"`
+	Brotli    int        `json:"brotli,omitempty"` // zero if the brotli command isn't available
+	Code      int        `json:"code"`             // size of the code section
+	Data      int        `json:"data"`             // size of the data section
+	Sections  []Section  `json:"sections"`
+	Packages  []Package  `json:"packages"`
+	Functions []Function `json:"functions"`
+}
+
+// Section is a section of the binary, including its header.
+type Section struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// Package is the code of the functions of a Go package.
+type Package struct {
+	Name      string `json:"name"`
+	Size      int    `json:"size"`
+	Functions int    `json:"functions"`
+}
+
+// Function is the body of a function in the code section. Index is in the function index space,
+// which starts with the imported functions.
+type Function struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Package string `json:"package"`
+	Size    int    `json:"size"`
+}
+
+// Analyze decodes the binary and attributes the code section to functions. The Go names of the
+// functions are read from the pclntab, so they're grouped by their import paths. Functions that
+// aren't in the pclntab (or binaries without one, e.g. built by TinyGo) use the names in the name
+// section.
+func Analyze(binary []byte) (*Report, error) {
+	m, err := wasmbin.Decode(binary)
+	if err != nil {
+		return nil, err
+	}
+	goNames := m.GoNames()
+	if len(m.Names) == 0 && len(goNames) == 0 {
+		return nil, fmt.Errorf("binary has no function names")
+	}
+	r := &Report{Total: len(binary)}
+	for _, s := range m.Sections {
+		r.Sections = append(r.Sections, Section{Name: s.String(), Size: s.Size})
+		switch s.ID {
+		case wasmbin.SectionCode:
+			r.Code += s.Size
+		case wasmbin.SectionData:
+			r.Data += s.Size
+		}
+	}
+
+	packages := map[string]*Package{}
+	for i, body := range m.Bodies {
+		index := m.Imported + i
+		size := body.Size
+		name, ok := goNames[index]
+		if !ok {
+			name, ok = m.Names[index]
+		}
+		if !ok {
+			name = fmt.Sprintf("function[%d]", index)
+		}
+		f := Function{Index: index, Name: name, Package: PackageOf(name), Size: size}
+		r.Functions = append(r.Functions, f)
+		p := packages[f.Package]
+		if p == nil {
+			p = &Package{Name: f.Package}
+			packages[f.Package] = p
+		}
+		p.Size += size
+		p.Functions++
+	}
+	for _, p := range packages {
+		r.Packages = append(r.Packages, *p)
+	}
+	sort.Slice(r.Functions, func(i, j int) bool {
+		if r.Functions[i].Size != r.Functions[j].Size {
+			return r.Functions[i].Size > r.Functions[j].Size
+		}
+		return r.Functions[i].Index < r.Functions[j].Index
+	})
+	sort.Slice(r.Packages, func(i, j int) bool {
+		if r.Packages[i].Size != r.Packages[j].Size {
+			return r.Packages[i].Size > r.Packages[j].Size
+		}
+		return r.Packages[i].Name < r.Packages[j].Name
+	})
+
+	if r.Gzip, err = gzipSize(binary); err != nil {
+		return nil, err
+	}
+	r.Brotli = brotliSize(binary)
+	return r, nil
+}
+
+// PackageOf returns the Go package of a function name, e.g. github.com/a/b for
+// github.com/a/b.(*T).M. Type parameters are ignored. Compiler generated functions (e.g. type:.eq.T)
+// are grouped by their prefix, and functions without a package, like the assembly helpers of the
+// runtime, are grouped as <asm>.
+//
+// Recent versions of Go replace the characters other than letters, digits, _ and . in the name
+// section, so github.com/a/b.F is written github.com_a_b.F. Analyze uses the names from the
+// pclntab where it can, but the package of names from the name section is kept in that form, and
+// the first element of the path is recognised by its top level domain.
+func PackageOf(name string) string {
+	if i := strings.Index(name, "["); i != -1 {
+		name = name[:i]
+	}
+	for _, prefix := range []string{"type:", "type..", "type_", "go:", "go."} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimRight(prefix, ".:_")
+		}
+	}
+	start := strings.LastIndex(name, "/") + 1
+	if start == 0 {
+		start = len(domainRegexp.FindString(name))
+	}
+	dot := strings.Index(name[start:], ".")
+	if dot == -1 {
+		return "<asm>"
+	}
+	return name[:start+dot]
+}
+
+var domainRegexp = regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)*\.(com|org|net|io|in|dev|co|me|app|xyz)_`)
+
+// Top returns a copy of the report with only the n biggest packages and functions.
+func (r *Report) Top(n int) *Report {
+	top := *r
+	if n < len(top.Packages) {
+		top.Packages = top.Packages[:n]
+	}
+	if n < len(top.Functions) {
+		top.Functions = top.Functions[:n]
+	}
+	return &top
+}
+
+// Write writes the report as text tables.
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Total:\t%s\n", bytesize(r.Total))
+	fmt.Fprintf(tw, "Code:\t%s\t%s\n", bytesize(r.Code), percent(r.Code, r.Total))
+	fmt.Fprintf(tw, "Data:\t%s\t%s\n", bytesize(r.Data), percent(r.Data, r.Total))
+	fmt.Fprintf(tw, "Gzip:\t%s\n", bytesize(r.Gzip))
+	if r.Brotli > 0 {
+		fmt.Fprintf(tw, "Brotli:\t%s\n", bytesize(r.Brotli))
+	} else {
+		fmt.Fprintf(tw, "Brotli:\t- (%s command not found)\n", BrotliCommand)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Sections:")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, s := range r.Sections {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", bytesize(s.Size), percent(s.Size, r.Total), s.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Packages (% of code):")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, p := range r.Packages {
+		fmt.Fprintf(tw, "  %s\t%s\t%d funcs\t%s\n", bytesize(p.Size), percent(p.Size, r.Code), p.Functions, p.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Functions (% of code):")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, f := range r.Functions {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", bytesize(f.Size), percent(f.Size, r.Code), f.Name)
+	}
+	return tw.Flush()
+}
+
+func bytesize(n int) string {
+	return humanize.Bytes(uint64(n))
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+func gzipSize(b []byte) (int, error) {
+	buf := &bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return buf.Len(), nil
+}
+
+// brotliSize returns the size of the binary compressed with the brotli command at the highest
+// quality, or zero if the command isn't available.
+func brotliSize(b []byte) int {
+	cmd := exec.Command(BrotliCommand, "-c", "-q", "11")
+	cmd.Stdin = bytes.NewReader(b)
+	out, err := cmd.Output()
+	if err != nil {
+		return 0
+	}
+	return len(out)
+}
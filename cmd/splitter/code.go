@@ -0,0 +1,166 @@
+package splitter
+
+import (
+	"fmt"
+
+	"github.com/dave/wasmgo/cmd/wasmbin"
+	"github.com/go-interpreter/wagon/wasm/leb128"
+	"github.com/go-interpreter/wagon/wasm/operators"
+)
+
+// walkCode reads the instructions of a function body and returns a copy where the target of each
+// call is replaced by the result of the call function. The rest of the body is copied unchanged.
+//
+// It's used instead of disasm, which doesn't know the sign extension, saturating truncation and bulk
+// memory instructions that recent versions of Go use.
+func walkCode(code []byte, call func(callee uint32) uint32) ([]byte, error) {
+	out := make([]byte, 0, len(code))
+	r := wasmbin.NewReader(code)
+	for r.Err() == nil && r.Len() > 0 {
+		start := r.Pos()
+		op := r.Byte()
+		if op == operators.Call {
+			callee := uint32(r.Uint())
+			if r.Err() != nil {
+				break
+			}
+			out = append(out, op)
+			out = leb128.AppendUleb128(out, uint64(call(callee)))
+			continue
+		}
+		immediates(r, op)
+		out = append(out, code[start:r.Pos()]...)
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	return out, nil
+}
+
+// callees returns the targets of the direct calls in a function body.
+func callees(code []byte) ([]int, error) {
+	sites, err := callSites(code)
+	if err != nil {
+		return nil, err
+	}
+	var calls []int
+	for _, site := range sites {
+		if !site.indirect {
+			calls = append(calls, site.callee)
+		}
+	}
+	return calls, nil
+}
+
+// callSite is a call in a function body. The callee of a direct call is a function index, and the
+// callee of an indirect call is a table slot, or -1 if the slot isn't known.
+type callSite struct {
+	callee   int
+	indirect bool
+}
+
+// callSites returns the calls in a function body. The slot of an indirect call is known in simple
+// cases, where it's computed from constants by the operations that Go uses to convert a PC to a
+// slot (see eval).
+func callSites(code []byte) ([]callSite, error) {
+	var sites []callSite
+	var consts []uint64 // the values on top of the stack, if they're constants
+	r := wasmbin.NewReader(code)
+	for r.Err() == nil && r.Len() > 0 {
+		switch op := r.Byte(); op {
+		case operators.Call:
+			sites = append(sites, callSite{callee: int(r.Uint())})
+			consts = nil
+		case operators.CallIndirect:
+			r.Uint() // type
+			r.Uint() // table
+			slot := -1
+			if n := len(consts); n > 0 {
+				slot = int(uint32(consts[n-1]))
+			}
+			sites = append(sites, callSite{callee: slot, indirect: true})
+			consts = nil
+		case operators.I32Const:
+			consts = append(consts, uint64(uint32(r.Int())))
+		case operators.I64Const:
+			consts = append(consts, uint64(r.Int()))
+		case operators.I32WrapI64:
+			if n := len(consts); n > 0 {
+				consts[n-1] = uint64(uint32(consts[n-1]))
+			}
+		case operators.I32ShrU:
+			n := len(consts)
+			if n < 2 {
+				consts = nil
+				break
+			}
+			consts = append(consts[:n-2], uint64(uint32(consts[n-2])>>(uint32(consts[n-1])&31)))
+		default:
+			immediates(r, op)
+			consts = nil
+		}
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	return sites, nil
+}
+
+// immediates skips the immediates of an instruction.
+func immediates(r *wasmbin.Reader, op byte) {
+	switch {
+	case op == operators.Block || op == operators.Loop || op == operators.If:
+		// the block type is the empty type or a value type, which are negative, or a type index
+		r.Int()
+	case op == operators.Br || op == operators.BrIf:
+		r.Uint()
+	case op == operators.BrTable:
+		n := r.Uint()
+		for i := uint64(0); i <= n && r.Err() == nil; i++ {
+			r.Uint()
+		}
+	case op == operators.CallIndirect:
+		r.Uint() // type
+		r.Uint() // table
+	case op == 0x1c: // select with types
+		r.Bytes(int(r.Uint()))
+	case op >= operators.GetLocal && op <= operators.SetGlobal:
+		r.Uint()
+	case op == 0x25 || op == 0x26: // table.get, table.set
+		r.Uint()
+	case op >= operators.I32Load && op <= operators.I64Store32:
+		r.Uint() // alignment
+		r.Uint() // offset
+	case op == operators.CurrentMemory || op == operators.GrowMemory:
+		r.Bytes(1)
+	case op == operators.I32Const || op == operators.I64Const:
+		r.Uint()
+	case op == operators.F32Const:
+		r.Bytes(4)
+	case op == operators.F64Const:
+		r.Bytes(8)
+	case op <= operators.Return, op == operators.Drop, op == operators.Select:
+		// no immediates
+	case op >= operators.I32Eqz && op <= 0xc4: // numeric, including sign extension
+	case op == 0xfc:
+		switch sub := r.Uint(); {
+		case sub <= 7: // saturating truncation
+		case sub == 8: // memory.init
+			r.Uint()
+			r.Bytes(1)
+		case sub == 9, sub == 13, sub >= 15 && sub <= 17: // data.drop, elem.drop, table.grow, table.size, table.fill
+			r.Uint()
+		case sub == 10: // memory.copy
+			r.Bytes(2)
+		case sub == 11: // memory.fill
+			r.Bytes(1)
+		case sub == 12, sub == 14: // table.init, table.copy
+			r.Uint()
+			r.Uint()
+		default:
+			r.Fail(fmt.Sprintf("unsupported instruction 0xfc %d", sub))
+		}
+	default:
+		r.Fail(fmt.Sprintf("unsupported instruction 0x%02x", op))
+	}
+}
@@ -0,0 +1,231 @@
+package splitter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dave/wasmgo/cmd/size"
+)
+
+// Graph is the call graph of a module. Funcs is indexed by the function index space, and each edge
+// is the calls from one function to another.
+type Graph struct {
+	Funcs []Node `json:"funcs"`
+	Edges []Edge `json:"edges"`
+}
+
+// Node is a function in the call graph.
+type Node struct {
+	Func
+	Package    string `json:"package"`
+	Size       int    `json:"size"`                 // size of the body, or zero for imported functions
+	Table      bool   `json:"table,omitempty"`      // the function is in the table, so it can be called indirectly
+	Unresolved int    `json:"unresolved,omitempty"` // indirect calls with a slot that isn't known
+}
+
+// Edge is the calls from one function to another. Indirect calls go through the table, with a
+// slot that's known.
+type Edge struct {
+	Caller   int  `json:"caller"`
+	Callee   int  `json:"callee"`
+	Indirect bool `json:"indirect,omitempty"`
+	Calls    int  `json:"calls"` // number of call sites
+}
+
+// CallGraph builds the call graph from the calls in every function body. Indirect calls are
+// resolved through the table when the slot is known, and counted as unresolved otherwise. Packages
+// are found with size.PackageOf.
+func (sp *Splitter) CallGraph() (*Graph, error) {
+	g := &Graph{}
+	for _, f := range sp.Funcs(nil) {
+		g.Funcs = append(g.Funcs, Node{Func: f, Package: size.PackageOf(f.Name)})
+	}
+	for _, fnc := range sp.funcTable {
+		if fnc >= 0 && fnc < len(g.Funcs) {
+			g.Funcs[fnc].Table = true
+		}
+	}
+	if sp.mod.Code == nil {
+		return g, nil
+	}
+	type key struct {
+		callee   int
+		indirect bool
+	}
+	for i, body := range sp.mod.Code.Bodies {
+		caller := sp.toFuncSpace(i)
+		g.Funcs[caller].Size = len(body.Code)
+		sites, err := callSites(body.Code)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read '%v': %v", sp.funcName(caller), err)
+		}
+		calls := map[key]int{}
+		for _, site := range sites {
+			callee := site.callee
+			if site.indirect {
+				if callee < 0 || callee >= len(sp.funcTable) || sp.funcTable[callee] < 0 {
+					g.Funcs[caller].Unresolved++
+					continue
+				}
+				callee = sp.funcTable[callee]
+			}
+			if callee >= len(g.Funcs) {
+				return nil, fmt.Errorf("'%v' calls an unknown function", sp.funcName(caller))
+			}
+			calls[key{callee, site.indirect}]++
+		}
+		for k, n := range calls {
+			g.Edges = append(g.Edges, Edge{Caller: caller, Callee: k.callee, Indirect: k.indirect, Calls: n})
+		}
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		if a.Callee != b.Callee {
+			return a.Callee < b.Callee
+		}
+		return !a.Indirect && b.Indirect
+	})
+	return g, nil
+}
+
+// PackageGraph is a call graph with the functions grouped by Go package. Calls within a package
+// aren't included.
+type PackageGraph struct {
+	Packages []PackageNode `json:"packages"`
+	Edges    []PackageEdge `json:"edges"`
+}
+
+// PackageNode is a package in the call graph.
+type PackageNode struct {
+	Name       string `json:"name"`
+	Functions  int    `json:"functions"`
+	Size       int    `json:"size"`
+	Unresolved int    `json:"unresolved,omitempty"` // indirect calls with a slot that isn't known
+}
+
+// PackageEdge is the calls from the functions of one package to the functions of another.
+type PackageEdge struct {
+	Caller   string `json:"caller"`
+	Callee   string `json:"callee"`
+	Calls    int    `json:"calls"`              // number of direct call sites
+	Indirect int    `json:"indirect,omitempty"` // number of indirect call sites
+}
+
+// Packages groups the graph by package. Packages and edges are sorted by name.
+func (g *Graph) Packages() *PackageGraph {
+	nodes := map[string]*PackageNode{}
+	for _, f := range g.Funcs {
+		n := nodes[f.Package]
+		if n == nil {
+			n = &PackageNode{Name: f.Package}
+			nodes[f.Package] = n
+		}
+		n.Functions++
+		n.Size += f.Size
+		n.Unresolved += f.Unresolved
+	}
+	type key struct{ caller, callee string }
+	edges := map[key]*PackageEdge{}
+	for _, e := range g.Edges {
+		k := key{g.Funcs[e.Caller].Package, g.Funcs[e.Callee].Package}
+		if k.caller == k.callee {
+			continue
+		}
+		pe := edges[k]
+		if pe == nil {
+			pe = &PackageEdge{Caller: k.caller, Callee: k.callee}
+			edges[k] = pe
+		}
+		if e.Indirect {
+			pe.Indirect += e.Calls
+		} else {
+			pe.Calls += e.Calls
+		}
+	}
+	pg := &PackageGraph{}
+	for _, n := range nodes {
+		pg.Packages = append(pg.Packages, *n)
+	}
+	for _, e := range edges {
+		pg.Edges = append(pg.Edges, *e)
+	}
+	sort.Slice(pg.Packages, func(i, j int) bool { return pg.Packages[i].Name < pg.Packages[j].Name })
+	sort.Slice(pg.Edges, func(i, j int) bool {
+		a, b := pg.Edges[i], pg.Edges[j]
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		return a.Callee < b.Callee
+	})
+	return pg
+}
+
+// WriteDOT writes the graph in the DOT language, with a cluster for each package. Indirect calls
+// are dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	byPackage := map[string][]Node{}
+	var packages []string
+	for _, f := range g.Funcs {
+		if _, ok := byPackage[f.Package]; !ok {
+			packages = append(packages, f.Package)
+		}
+		byPackage[f.Package] = append(byPackage[f.Package], f)
+	}
+	sort.Strings(packages)
+	dw := &dotWriter{w: w}
+	dw.printf("digraph calls {\n")
+	dw.printf("\tnode [shape=box];\n")
+	for i, p := range packages {
+		dw.printf("\tsubgraph cluster_%d {\n", i)
+		dw.printf("\t\tlabel=%q;\n", p)
+		for _, f := range byPackage[p] {
+			dw.printf("\t\tf%d [label=%q];\n", f.Index, f.Name)
+		}
+		dw.printf("\t}\n")
+	}
+	for _, e := range g.Edges {
+		if e.Indirect {
+			dw.printf("\tf%d -> f%d [style=dashed];\n", e.Caller, e.Callee)
+		} else {
+			dw.printf("\tf%d -> f%d;\n", e.Caller, e.Callee)
+		}
+	}
+	dw.printf("}\n")
+	return dw.err
+}
+
+// WriteDOT writes the graph in the DOT language. Edges are labelled with the number of call sites,
+// and edges with only indirect calls are dashed.
+func (g *PackageGraph) WriteDOT(w io.Writer) error {
+	dw := &dotWriter{w: w}
+	dw.printf("digraph packages {\n")
+	dw.printf("\tnode [shape=box];\n")
+	for _, p := range g.Packages {
+		dw.printf("\t%q [label=%q];\n", p.Name, fmt.Sprintf("%s\n%d funcs, %d bytes", p.Name, p.Functions, p.Size))
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.Calls == 0 {
+			style = ", style=dashed"
+		}
+		dw.printf("\t%q -> %q [label=\"%d\"%s];\n", e.Caller, e.Callee, e.Calls+e.Indirect, style)
+	}
+	dw.printf("}\n")
+	return dw.err
+}
+
+// dotWriter keeps the first error, so a graph can be written without checking every write.
+type dotWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (dw *dotWriter) printf(format string, args ...interface{}) {
+	if dw.err == nil {
+		_, dw.err = fmt.Fprintf(dw.w, format, args...)
+	}
+}
@@ -0,0 +1,157 @@
+package splitter
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// callsSource is a program with known calls: main calls middle, which calls leaf, and even and odd
+// call each other, but are only called from main through a function value.
+const callsSource = `package main
+
+//go:noinline
+func leaf(n int) int {
+	return n * 3
+}
+
+//go:noinline
+func middle(n int) int {
+	return leaf(n) + 1
+}
+
+//go:noinline
+func even(n int) bool {
+	if n == 0 {
+		return true
+	}
+	return odd(n - 1)
+}
+
+//go:noinline
+func odd(n int) bool {
+	if n == 0 {
+		return false
+	}
+	return even(n - 1)
+}
+
+var check = even
+
+func main() {
+	println(middle(2), check(10))
+}
+`
+
+// decodeCalls builds callsSource and returns a splitter for it.
+func decodeCalls(t *testing.T) *Splitter {
+	t.Helper()
+	sp, err := Decode(build(t, callsSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp
+}
+
+// TestCallGraph checks the calls between the functions of the main package.
+func TestCallGraph(t *testing.T) {
+	g, err := decodeCalls(t).CallGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := map[string]int{}
+	for _, n := range g.Funcs {
+		index[n.Name] = n.Index
+	}
+	funcs := []string{"main.main", "main.middle", "main.leaf", "main.even", "main.odd"}
+	for _, name := range funcs {
+		i, ok := index[name]
+		if !ok {
+			t.Fatalf("%s isn't in the graph", name)
+		}
+		// Go puts every function in the table
+		if n := g.Funcs[i]; !n.Table || n.Package != "main" || n.Size == 0 {
+			t.Fatalf("unexpected node %+v", n)
+		}
+	}
+
+	var calls []string
+	for _, e := range g.Edges {
+		caller, callee := g.Funcs[e.Caller].Name, g.Funcs[e.Callee].Name
+		if strings.HasPrefix(caller, "main.") && strings.HasPrefix(callee, "main.") {
+			calls = append(calls, fmt.Sprintf("%s -> %s %d %t", caller, callee, e.Calls, e.Indirect))
+		}
+	}
+	expected := []string{
+		"main.middle -> main.leaf 1 false",
+		"main.even -> main.odd 1 false",
+		"main.odd -> main.even 1 false",
+		"main.main -> main.middle 1 false",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("got calls %q, expected %q", calls, expected)
+	}
+	// check is called through a slot loaded from memory
+	if n := g.Funcs[index["main.main"]]; n.Unresolved == 0 {
+		t.Fatal("expected an unresolved indirect call in main.main")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := g.WriteDOT(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		fmt.Sprintf("\t\tf%d [label=\"main.leaf\"];\n", index["main.leaf"]),
+		fmt.Sprintf("\tf%d -> f%d;\n", index["main.middle"], index["main.leaf"]),
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("graph doesn't contain %q", line)
+		}
+	}
+
+	pg := g.Packages()
+	for _, p := range pg.Packages {
+		if p.Name == "main" && p.Functions != len(funcs) {
+			t.Fatalf("got %d functions in main, expected %d", p.Functions, len(funcs))
+		}
+	}
+	for _, e := range pg.Edges {
+		if e.Caller == e.Callee {
+			t.Fatalf("package graph has calls within %s", e.Caller)
+		}
+	}
+	buf.Reset()
+	if err := pg.WriteDOT(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\t\"main\" [label=\"main\\n5 funcs, ") {
+		t.Fatalf("package graph doesn't contain main:\n%s", buf)
+	}
+}
+
+// TestCallSites checks the indirect calls with slots computed from constants, like the ones Go
+// uses to convert a PC to a slot, and with slots that aren't known.
+func TestCallSites(t *testing.T) {
+	code := []byte{
+		0x41, 0x05, // i32.const 5
+		0x11, 0x00, 0x00, // call_indirect
+		0x10, 0x03, // call 3
+		0x42, 0x80, 0x80, 0x1c, // i64.const 7<<16
+		0xa7,       // i32.wrap_i64
+		0x41, 0x10, // i32.const 16
+		0x76,             // i32.shr_u
+		0x11, 0x00, 0x00, // call_indirect
+		0x20, 0x00, // local.get 0
+		0x11, 0x00, 0x00, // call_indirect
+	}
+	sites, err := callSites(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []callSite{{5, true}, {3, false}, {7, true}, {-1, true}}
+	if !reflect.DeepEqual(sites, expected) {
+		t.Fatalf("got %v, expected %v", sites, expected)
+	}
+}
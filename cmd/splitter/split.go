@@ -0,0 +1,363 @@
+package splitter
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/go-interpreter/wagon/wasm/leb128"
+	"github.com/go-interpreter/wagon/wasm/operators"
+)
+
+// The primary module imports LoadField from LoadModule, which must load the secondary module
+// synchronously. The secondary module imports the exports of the primary module as PrimaryModule,
+// and the same functions as the primary module from the runtime script.
+const (
+	LoadModule    = "wasmgo"
+	LoadField     = "load"
+	PrimaryModule = "wasmgo.primary"
+)
+
+// The exports added to the primary module for the secondary module. Globals and functions are
+// followed by their index. Function indexes are from the binary before it was split.
+const (
+	exportMemory = "wasmgo.memory"
+	exportTable  = "wasmgo.table"
+	exportGlobal = "wasmgo.global."
+	exportFunc   = "wasmgo.func."
+)
+
+// RuntimePrefixes selects the runtime, and the functions from other packages that it calls
+// directly.
+var RuntimePrefixes = []string{
+	"runtime.",
+	"runtime_",
+	"callRet",
+	"memeqbody", "cmpbody", "memcmp", "memchr",
+	"time.now",
+	"sync.event",
+	"internal_bytealg",
+	"internal_cpu",
+}
+
+// PackagePrefixes returns the prefixes that select the functions of the Go packages, in both
+// forms (see Prefixes).
+func PackagePrefixes(packages []string) []string {
+	var prefixes []string
+	for _, path := range packages {
+		prefixes = append(prefixes, path+".")
+	}
+	return Prefixes(prefixes)
+}
+
+// Prefixes returns the prefixes, followed by the form of any that contain characters other than
+// letters, digits, _ and ., which recent versions of Go replace in the function names.
+func Prefixes(prefixes []string) []string {
+	out := append([]string{}, prefixes...)
+	for _, prefix := range prefixes {
+		if mangled := nameRegexp.ReplaceAllString(prefix, "_"); mangled != prefix {
+			out = append(out, mangled)
+		}
+	}
+	return out
+}
+
+var nameRegexp = regexp.MustCompile(`[^\w.]`)
+
+// Split decodes the binary and moves the functions with one of the prefixes to a secondary
+// module. If no functions match, the binary is returned unchanged and secondary is nil.
+func Split(binary []byte, prefixes []string) (primary, secondary []byte, err error) {
+	sp, err := Decode(binary)
+	if err != nil {
+		return nil, nil, err
+	}
+	sec, err := sp.SplitByPrefix(prefixes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sec == nil {
+		return binary, nil, nil
+	}
+	if primary, err = encode(sp.mod); err != nil {
+		return nil, nil, err
+	}
+	if secondary, err = encode(sec); err != nil {
+		return nil, nil, err
+	}
+	return primary, secondary, nil
+}
+
+func encode(m *wasm.Module) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := wasm.EncodeModule(buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Split moves the functions to the secondary module, and replaces them in the primary module with
+// stubs. The functions keep their slots in the table, which point to the stubs, and the secondary
+// module adds the functions to new slots at the end of the table. A stub calls the load function
+// the first time it's run, and then calls its function through the table:
+//
+//	global.get $loaded
+//	i32.eqz
+//	if
+//	  call $load
+//	  i32.const 1
+//	  global.set $loaded
+//	end
+//	local.get 0 ... local.get n
+//	i32.const $slot
+//	call_indirect $type
+//
+// The load function is imported by the primary module, so the indexes of the other functions go up
+// by one. The secondary module imports the same functions, followed by the functions of the primary
+// module that it calls, so its imported functions keep their indexes.
+func (s *splitJob) Split() (*wasm.Module, error) {
+	m, sp := s.sp.mod, s.sp
+	for _, e := range m.Import.Entries {
+		if _, ok := e.Type.(wasm.FuncImport); !ok {
+			return nil, fmt.Errorf("cannot split: only function imports are supported")
+		}
+	}
+	if m.Table == nil || len(m.Table.Entries) != 1 || m.Memory == nil || len(m.Memory.Entries) != 1 {
+		return nil, fmt.Errorf("cannot split: the module should have one table and one memory")
+	}
+	if m.Global == nil || m.Export == nil || m.Elements == nil {
+		return nil, fmt.Errorf("cannot split: the module has no globals, exports or table elements")
+	}
+
+	pos := make(map[int]int, len(s.funcs))
+	for i, fnc := range s.funcs {
+		pos[fnc] = i
+	}
+	external := make(map[int]int, len(s.external))
+	for i, fnc := range s.external {
+		external[fnc] = i
+	}
+	// primaryIndex is the index of a function in the primary module, after the load function is
+	// imported
+	primaryIndex := func(fnc uint32) uint32 {
+		if int(fnc) < sp.funcsImp {
+			return fnc
+		}
+		return fnc + 1
+	}
+	secondaryIndex := func(fnc uint32) uint32 {
+		if int(fnc) < sp.funcsImp {
+			return fnc
+		}
+		if i, ok := external[int(fnc)]; ok {
+			return uint32(sp.funcsImp + i)
+		}
+		return uint32(sp.funcsImp + len(s.external) + pos[int(fnc)])
+	}
+
+	table := &m.Table.Entries[0]
+	slot := table.Limits.Initial
+	table.Limits.Initial += uint32(len(s.funcs))
+	if table.Limits.Flags&1 != 0 && table.Limits.Maximum < table.Limits.Initial {
+		table.Limits.Maximum = table.Limits.Initial
+	}
+
+	sec := &wasm.Module{
+		Types:    &wasm.SectionTypes{Entries: m.Types.Entries},
+		Import:   &wasm.SectionImports{Entries: append([]wasm.ImportEntry(nil), m.Import.Entries...)},
+		Function: &wasm.SectionFunctions{},
+		Elements: &wasm.SectionElements{},
+		Code:     &wasm.SectionCode{},
+	}
+	for _, fnc := range s.external {
+		sec.Import.Entries = append(sec.Import.Entries, wasm.ImportEntry{
+			ModuleName: PrimaryModule,
+			FieldName:  exportFunc + strconv.Itoa(fnc),
+			Type:       wasm.FuncImport{Type: m.Function.Types[sp.toFuncTable(fnc)]},
+		})
+	}
+	sec.Import.Entries = append(sec.Import.Entries,
+		wasm.ImportEntry{
+			ModuleName: PrimaryModule,
+			FieldName:  exportTable,
+			Type:       wasm.TableImport{Type: wasm.Table{ElementType: wasm.ElemTypeAnyFunc, Limits: wasm.ResizableLimits{Initial: table.Limits.Initial}}},
+		},
+		wasm.ImportEntry{
+			ModuleName: PrimaryModule,
+			FieldName:  exportMemory,
+			Type:       wasm.MemoryImport{Type: wasm.Memory{Limits: wasm.ResizableLimits{Initial: m.Memory.Entries[0].Limits.Initial}}},
+		},
+	)
+	for i, g := range m.Global.Globals {
+		sec.Import.Entries = append(sec.Import.Entries, wasm.ImportEntry{
+			ModuleName: PrimaryModule,
+			FieldName:  exportGlobal + strconv.Itoa(i),
+			Type:       wasm.GlobalVarImport{Type: g.Type},
+		})
+	}
+	elements := wasm.ElementSegment{Offset: constExpr(int64(slot))}
+	for i, fnc := range s.funcs {
+		body := m.Code.Bodies[sp.toFuncTable(fnc)]
+		code, err := walkCode(body.Code, secondaryIndex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read '%v': %v", sp.funcName(fnc), err)
+		}
+		sec.Function.Types = append(sec.Function.Types, m.Function.Types[sp.toFuncTable(fnc)])
+		sec.Code.Bodies = append(sec.Code.Bodies, wasm.FunctionBody{Module: sec, Locals: body.Locals, Code: code})
+		elements.Elems = append(elements.Elems, uint32(sp.funcsImp+len(s.external)+i))
+	}
+	sec.Elements.Entries = []wasm.ElementSegment{elements}
+	secNames := make(wasm.NameMap)
+	for fnc, name := range sp.funcs {
+		_, split := pos[int(fnc)]
+		_, ext := external[int(fnc)]
+		if split || ext || sp.isImported(int(fnc)) {
+			secNames[secondaryIndex(fnc)] = name
+		}
+	}
+	names, err := encodeNames(secNames)
+	if err != nil {
+		return nil, err
+	}
+	nameSection := &wasm.SectionCustom{Name: wasm.CustomSectionName, Data: names}
+	sec.Customs = []*wasm.SectionCustom{nameSection}
+	sec.Sections = []wasm.Section{sec.Types, sec.Import, sec.Function, sec.Elements, sec.Code, nameSection}
+
+	// the primary module
+	load := uint32(sp.funcsImp)
+	m.Import.Entries = append(m.Import.Entries, wasm.ImportEntry{
+		ModuleName: LoadModule,
+		FieldName:  LoadField,
+		Type:       wasm.FuncImport{Type: sp.typeIndex(wasm.FunctionSig{Form: 0x60})},
+	})
+	loaded := uint32(len(m.Global.Globals))
+	for i := range m.Global.Globals {
+		s.export(exportGlobal+strconv.Itoa(i), wasm.ExternalGlobal, uint32(i))
+	}
+	m.Global.Globals = append(m.Global.Globals, wasm.GlobalEntry{
+		Type: wasm.GlobalVar{Type: wasm.ValueTypeI32, Mutable: true},
+		Init: constExpr(0),
+	})
+	for name, e := range m.Export.Entries {
+		if e.Kind == wasm.ExternalFunction {
+			e.Index = primaryIndex(e.Index)
+			m.Export.Entries[name] = e
+		}
+	}
+	s.export(exportTable, wasm.ExternalTable, 0)
+	s.export(exportMemory, wasm.ExternalMemory, 0)
+	for _, fnc := range s.external {
+		s.export(exportFunc+strconv.Itoa(fnc), wasm.ExternalFunction, primaryIndex(uint32(fnc)))
+	}
+	if m.Start != nil {
+		m.Start.Index = primaryIndex(m.Start.Index)
+	}
+	for i := range m.Elements.Entries {
+		for j, fnc := range m.Elements.Entries[i].Elems {
+			m.Elements.Entries[i].Elems[j] = primaryIndex(fnc)
+		}
+	}
+	for i := range m.Code.Bodies {
+		fnc := sp.toFuncSpace(i)
+		body := &m.Code.Bodies[i]
+		if p, ok := pos[fnc]; ok {
+			body.Locals = nil
+			body.Code = s.stub(m.Function.Types[i], load, loaded, slot+uint32(p))
+			continue
+		}
+		code, err := walkCode(body.Code, primaryIndex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read '%v': %v", sp.funcName(fnc), err)
+		}
+		body.Code = code
+	}
+	primaryNames := make(wasm.NameMap, len(sp.funcs)+1)
+	for fnc, name := range sp.funcs {
+		primaryNames[primaryIndex(fnc)] = name
+	}
+	primaryNames[load] = LoadModule + "." + LoadField
+	if names, err = encodeNames(primaryNames); err != nil {
+		return nil, err
+	}
+	m.Custom(wasm.CustomSectionName).Data = names
+
+	return sec, nil
+}
+
+// stub returns the code of the stub that replaces a function in the primary module.
+func (s *splitJob) stub(typ, load, loaded, slot uint32) []byte {
+	var code []byte
+	code = append(code, operators.GetGlobal)
+	code = leb128.AppendUleb128(code, uint64(loaded))
+	code = append(code, operators.I32Eqz, operators.If, 0x40, operators.Call)
+	code = leb128.AppendUleb128(code, uint64(load))
+	code = append(code, operators.I32Const, 1, operators.SetGlobal)
+	code = leb128.AppendUleb128(code, uint64(loaded))
+	code = append(code, operators.End)
+	for i := range s.sp.mod.Types.Entries[typ].ParamTypes {
+		code = append(code, operators.GetLocal)
+		code = leb128.AppendUleb128(code, uint64(i))
+	}
+	code = append(code, operators.I32Const)
+	code = leb128.AppendSleb128(code, int64(slot))
+	code = append(code, operators.CallIndirect)
+	code = leb128.AppendUleb128(code, uint64(typ))
+	return append(code, 0) // table
+}
+
+// export adds an export to the primary module.
+func (s *splitJob) export(name string, kind wasm.External, index uint32) {
+	exports := s.sp.mod.Export
+	if _, ok := exports.Entries[name]; !ok {
+		exports.Names = append(exports.Names, name)
+	}
+	exports.Entries[name] = wasm.ExportEntry{FieldStr: name, Kind: kind, Index: index}
+}
+
+// typeIndex returns the index of a function type, adding it to the module if needed.
+func (sp *Splitter) typeIndex(sig wasm.FunctionSig) uint32 {
+	for i, t := range sp.mod.Types.Entries {
+		if t.Form == sig.Form && sameTypes(t.ParamTypes, sig.ParamTypes) && sameTypes(t.ReturnTypes, sig.ReturnTypes) {
+			return uint32(i)
+		}
+	}
+	sp.mod.Types.Entries = append(sp.mod.Types.Entries, sig)
+	return uint32(len(sp.mod.Types.Entries) - 1)
+}
+
+func sameTypes(a, b []wasm.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// constExpr returns an initializer expression for an i32 constant.
+func constExpr(v int64) []byte {
+	expr := leb128.AppendSleb128([]byte{operators.I32Const}, v)
+	return append(expr, operators.End)
+}
+
+// encodeNames returns the contents of a name section with the function names.
+func encodeNames(funcs wasm.NameMap) ([]byte, error) {
+	// NameMap.MarshalWASM doesn't write the number of names, which UnmarshalWASM reads
+	sub := &bytes.Buffer{}
+	if _, err := leb128.WriteVarUint32(sub, uint32(len(funcs))); err != nil {
+		return nil, err
+	}
+	if err := funcs.MarshalWASM(sub); err != nil {
+		return nil, err
+	}
+	section := wasm.NameSection{Types: map[wasm.NameType][]byte{wasm.NameFunction: sub.Bytes()}}
+	buf := &bytes.Buffer{}
+	if err := section.MarshalWASM(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,162 @@
+package splitter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dave/wasmgo/cmd/wasmbin"
+)
+
+// build compiles a program with GOOS=js and returns the binary.
+func build(t *testing.T, source string) []byte {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module hello\n\ngo 1.21\n",
+		"main.go": source,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("go", "build", "-o", "main.wasm", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// harness runs a split program with Node.js. The secondary module is compiled up front, so it
+// fails if it isn't valid, and instantiated by the load function like the loader does.
+const harness = `
+globalThis.require = require;
+globalThis.fs = require("fs");
+globalThis.path = require("path");
+require(process.argv[2]);
+const [primary, secondary] = process.argv.slice(3).map(f => new WebAssembly.Module(fs.readFileSync(f)));
+const go = new Go();
+let instance = null;
+let loaded = false;
+go.importObject.wasmgo = {
+	load: () => {
+		if (!loaded) {
+			new WebAssembly.Instance(secondary, Object.assign({}, go.importObject, {"wasmgo.primary": instance.exports}));
+			loaded = true;
+		}
+	},
+};
+instance = new WebAssembly.Instance(primary, go.importObject);
+go.run(instance).then(() => {
+	console.error(loaded ? "loaded" : "not loaded");
+	process.exit(go.exitCode);
+});
+`
+
+// wasmExec returns the path of wasm_exec.js in GOROOT.
+func wasmExec(t *testing.T) string {
+	t.Helper()
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goroot := strings.TrimSpace(string(out))
+	for _, dir := range []string{"lib", "misc"} {
+		fpath := filepath.Join(goroot, dir, "wasm", "wasm_exec.js")
+		if _, err := os.Stat(fpath); err == nil {
+			return fpath
+		}
+	}
+	t.Skip("wasm_exec.js not found in GOROOT")
+	return ""
+}
+
+// TestSplit splits a program by package, and runs the split program with Node.js, which checks
+// that both modules are valid.
+func TestSplit(t *testing.T) {
+	binary := build(t, `package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//go:noinline
+func double(s string) string {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic(err)
+	}
+	return strconv.Itoa(2 * n)
+}
+
+func main() {
+	fmt.Println(double("21"), strconv.Quote("split"))
+}
+`)
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node command not found")
+	}
+	script := wasmExec(t)
+
+	primary, secondary, err := Split(binary, PackagePrefixes([]string{"main", "strconv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondary == nil {
+		t.Fatal("no functions were split")
+	}
+	if len(primary) >= len(binary) {
+		t.Fatalf("primary module is %d bytes, binary is %d", len(primary), len(binary))
+	}
+	m, err := wasmbin.Decode(secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := map[string]bool{}
+	for index, name := range m.Names {
+		if index >= m.Imported {
+			moved[name] = true
+		}
+	}
+	for _, name := range []string{"main.main", "main.double", "strconv.Atoi"} {
+		if !moved[name] {
+			t.Fatalf("%s isn't in the secondary module", name)
+		}
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{"harness.js": []byte(harness), "primary.wasm": primary, "secondary.wasm": secondary}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.Command("node", "harness.js", script, "./primary.wasm", "./secondary.wasm")
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	if got, expected := stdout.String(), "42 \"split\"\n"; got != expected {
+		t.Fatalf("got %q, expected %q", got, expected)
+	}
+	if got := strings.TrimSpace(stderr.String()); got != "loaded" {
+		t.Fatalf("secondary module wasn't loaded: %s", got)
+	}
+}
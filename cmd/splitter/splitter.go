@@ -1,105 +1,32 @@
-package main
+// Package splitter analyses and splits WASM binaries produced by the Go compiler. The selected
+// functions are moved to a secondary module, which shares the table, memory and globals of the
+// primary module, and is loaded the first time one of them is called.
+package splitter
 
 import (
 	"bytes"
-	"flag"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
-	"github.com/dustin/go-humanize"
+	"github.com/dave/wasmgo/cmd/wasmbin"
 	"github.com/go-interpreter/wagon/disasm"
 	"github.com/go-interpreter/wagon/wasm"
 	"github.com/go-interpreter/wagon/wasm/operators"
 )
 
-func main() {
-	flag.Parse()
-	//if err := split(flag.Arg(0)); err != nil {
-	if err := split("./splitter/foo.wasm"); err != nil {
-		log.Fatal(err)
-	}
-}
-
-func split(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	m, err := wasm.DecodeModule(f)
-	f.Close()
-	if err != nil {
-		return fmt.Errorf("cannot decode module: %v", err)
-	}
-
-	if err := splitPackages(m, filepath.Dir(path), []string{
-		"runtime.",
-		"runtime_",
-		"callRet",
-		"memeqbody", "cmpbody", "memcmp", "memchr",
-		"time.now",
-		"sync.event",
-		"internal_bytealg",
-		"internal_cpu",
-	}); err != nil {
-		return err
-	}
-
-	ext := filepath.Ext(path)
-	f, err = os.Create(strings.TrimSuffix(path, ext) + "_out" + ext)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	return wasm.EncodeModule(f, m)
-}
-
-func splitPackages(bin *wasm.Module, dir string, prefixes []string) error {
-	fmt.Println("section sizes:")
-	for _, s := range bin.Sections {
-		raw := s.GetRawSection()
-		size := len(raw.Bytes)
-		fmt.Printf("%T %10v:  %8v\n", s, raw.ID, humanize.Bytes(uint64(size)))
-		switch s := s.(type) {
-		case *wasm.SectionFunctions:
-			fmt.Println(len(s.Types))
-		case *wasm.SectionCode:
-			fmt.Println(len(s.Bodies))
-			for _, v := range s.Bodies {
-				fmt.Println(len(v.Locals))
-			}
-		case *wasm.SectionElements:
-			//for _, v := range s.Entries {
-			//	fmt.Println(v.)
-			//}
-		case *wasm.SectionData:
-			for _, v := range s.Entries {
-				fmt.Println(v.Index, len(v.Data))
-			}
-		case *wasm.SectionCustom:
-
-		}
-	}
-	for k, v := range bin.Customs {
-		fmt.Printf("%d: %#v\n", k, v.Name)
-	}
-
-	sp, err := NewSplitter(bin)
+// Decode decodes a binary and returns a splitter for it.
+func Decode(binary []byte) (*Splitter, error) {
+	mod, err := wasm.DecodeModule(bytes.NewReader(binary))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("cannot decode module: %v", err)
 	}
-	m, err := sp.SplitByPrefix(prefixes)
-	if err != nil {
-		return err
-	}
-	_ = m
-
-	return nil
+	return NewSplitter(mod)
 }
 
+// NewSplitter returns a splitter for a module. The module must have a name section with the
+// function names.
 func NewSplitter(mod *wasm.Module) (*Splitter, error) {
 	sp := &Splitter{mod: mod}
 	if err := sp.decodeNames(); err != nil {
@@ -109,15 +36,15 @@ func NewSplitter(mod *wasm.Module) (*Splitter, error) {
 	if err := sp.buildFuncTable(); err != nil {
 		return nil, err
 	}
-	sp.statsCallIndirect()
 	return sp, nil
 }
 
+// Splitter analyses a module, and splits it with SplitFunctions or SplitByPrefix.
 type Splitter struct {
 	mod       *wasm.Module
 	funcs     wasm.NameMap // function names; indexes are in a function index space (with funcsImp offset)
 	funcsImp  int          // number of imported functions
-	funcTable []int        // global table with function indexes
+	funcTable []int        // global table with function indexes, or -1 for empty slots
 
 	bodies map[int][]disasm.Instr
 }
@@ -242,18 +169,23 @@ loop:
 	}
 }
 
-func (sp *Splitter) statsCallIndirect() {
-	save := 0
-	for ind, name := range sp.funcs {
+// StatsCallIndirect returns the number of bytes that would be saved by moving the stack pointer
+// updates around calls and returns to functions. Functions that can't be disassembled, e.g.
+// because they use instructions that disasm doesn't know, are skipped and counted.
+func (sp *Splitter) StatsCallIndirect() (save, skipped int) {
+	for ind := range sp.funcs {
+		if sp.isImported(int(ind)) {
+			continue
+		}
 		instr, err := sp.disassemble(int(ind))
 		if err != nil {
-			log.Println(name, err)
+			skipped++
 			continue // we only gathering stats here
 		}
 		save += sumCallStubs(instr)
 		save += sumReturnStubs(instr)
 	}
-	log.Println("wrapping to a function will save:", save, humanize.Bytes(uint64(save)))
+	return save, skipped
 }
 
 func (sp *Splitter) decodeNames() error {
@@ -261,17 +193,16 @@ func (sp *Splitter) decodeNames() error {
 	if sec == nil {
 		return fmt.Errorf("cannot find names section")
 	}
-	var names wasm.NameSection
-	if err := names.UnmarshalWASM(bytes.NewReader(sec.Data)); err != nil {
-		return fmt.Errorf("cannot decode names section: %v", err)
-	}
-	sub, err := names.Decode(wasm.NameFunction)
+	names, err := wasmbin.DecodeNames(sec.Data)
 	if err != nil {
-		return err
-	} else if sub == nil {
+		return fmt.Errorf("cannot decode names section: %v", err)
+	} else if len(names) == 0 {
 		return fmt.Errorf("no function names")
 	}
-	sp.funcs = sub.(*wasm.FunctionNames).Names
+	sp.funcs = make(wasm.NameMap, len(names))
+	for i, name := range names {
+		sp.funcs[uint32(i)] = name
+	}
 	return nil
 }
 
@@ -303,6 +234,9 @@ func (sp *Splitter) buildFuncTable() error {
 		return nil
 	}
 	table := make([]int, tbl.Limits.Initial)
+	for i := range table {
+		table[i] = -1
+	}
 	for _, e := range sp.mod.Elements.Entries {
 		if int(e.Index) != ind {
 			continue
@@ -352,17 +286,28 @@ func (sp *Splitter) lookupFuncTable(i int) int {
 	return sp.funcTable[i]
 }
 
+// SplitByPrefix splits the functions with names that start with one of the prefixes, like
+// SplitFunctions. Imported functions are skipped, and so are package initializers, which always
+// run when the program starts. If no functions match, the module isn't changed and the secondary
+// module is nil.
 func (sp *Splitter) SplitByPrefix(prefixes []string) (*wasm.Module, error) {
 	// indexes are in a function index space
 	var funcs []int
 	for ind, name := range sp.funcs {
-		if hasAnyPrefix(name, prefixes) {
+		if !sp.isImported(int(ind)) && hasAnyPrefix(name, prefixes) && !initRegexp.MatchString(name) {
 			funcs = append(funcs, int(ind))
 		}
 	}
+	if len(funcs) == 0 {
+		return nil, nil
+	}
 	return sp.SplitFunctions(funcs)
 }
 
+// initRegexp matches package initializers, e.g. fmt.init, and the functions that initialize
+// package variables, e.g. fmt.init.0 and fmt.map.init.0.
+var initRegexp = regexp.MustCompile(`\.init(\.\d+)*$`)
+
 func (sp *Splitter) isImported(fnc int) bool {
 	return fnc < sp.funcsImp
 }
@@ -391,7 +336,7 @@ func (sp *Splitter) disassemble(fnc int) ([]disasm.Instr, error) {
 	if err != nil {
 		return nil, err
 	}
-	d, err := disasm.DisassembleRaw(code)
+	d, err := disasm.Disassemble(code)
 	if err != nil {
 		return nil, err
 	}
@@ -402,70 +347,74 @@ func (sp *Splitter) disassemble(fnc int) ([]disasm.Instr, error) {
 	return d, nil
 }
 
+// SplitFunctions moves the functions (in the function index space) to a new secondary module,
+// which is returned. In the module of the splitter, which becomes the primary module, they're
+// replaced by stubs that load the secondary module the first time one of them is called. The
+// splitter can't be used once the module is split.
 func (sp *Splitter) SplitFunctions(funcs []int) (*wasm.Module, error) {
 	job := sp.newSplitJob(funcs)
 	if err := job.ValidateFuncs(); err != nil {
 		return nil, err
 	}
-	return nil, fmt.Errorf("TODO: split")
+	return job.Split()
 }
 
 func (sp *Splitter) newSplitJob(funcs []int) *splitJob {
 	splitFunc := make(map[int]struct{}, len(funcs))
+	var sorted []int
 	for _, ind := range funcs {
+		if _, ok := splitFunc[ind]; !ok {
+			sorted = append(sorted, ind)
+		}
 		splitFunc[ind] = struct{}{}
 	}
-	return &splitJob{sp: sp, split: splitFunc, funcs: funcs}
+	// the order of the functions in the secondary module follows the binary
+	sort.Ints(sorted)
+	return &splitJob{sp: sp, split: splitFunc, funcs: sorted}
 }
 
 type splitJob struct {
-	sp    *Splitter
-	split map[int]struct{}
-	funcs []int
+	sp       *Splitter
+	split    map[int]struct{}
+	funcs    []int
+	external []int // functions of the primary module called directly by split functions
 }
 
+// ValidateFuncs checks that the functions can be moved, and finds the functions of the primary
+// module that they call directly, which the secondary module imports. Indirect calls go through
+// the shared table, so they can call functions in either module.
 func (s *splitJob) ValidateFuncs() error {
+	external := make(map[int]struct{})
+	s.external = nil
 	for _, fnc := range s.funcs {
 		if s.sp.isImported(fnc) {
 			return fmt.Errorf("attempting to split imported function")
 		}
-		d, err := s.sp.disassemble(fnc)
+		code, err := s.sp.codeOf(fnc)
 		if err != nil {
 			return err
 		}
-		for oi, op := range d {
-			var callee int
-			switch op.Op.Code {
-			case operators.Call:
-				callee = int(op.Immediates[0].(uint32))
-			case operators.CallIndirect:
-				n, err := backEvalN(d[:oi], 1)
-				if err != nil {
-					return fmt.Errorf("cannot eval an indirrect call target from '%v': %v", s.sp.funcName(fnc), err)
-				} else if n < 0 {
-					return fmt.Errorf("cannot eval an indirrect call target from '%v'", s.sp.funcName(fnc))
-				}
-				expr := d[n:oi]
-				log.Println("indirect call:", s.sp.funcName(fnc), expr)
-				stack, err := eval(expr)
-				if err != nil {
-					return fmt.Errorf("cannot eval an indirrect call target from '%v': %v", s.sp.funcName(fnc), err)
-				}
-				ind := int(stack[0])
-				callee = s.sp.lookupFuncTable(ind)
-				log.Printf("indirect call: '%v' -> '%v' (%d = %d)",
-					s.sp.funcName(fnc), s.sp.funcName(callee), ind, callee)
-			default:
-				continue
-			}
+		calls, err := callees(code)
+		if err != nil {
+			return fmt.Errorf("cannot read '%v': %v", s.sp.funcName(fnc), err)
+		}
+		for _, callee := range calls {
 			if s.sp.isImported(callee) {
 				continue // call of imported function
 			}
-			if _, ok := s.split[callee]; !ok {
-				return fmt.Errorf("cannot split: external call to '%v'", s.sp.funcName(callee))
+			if s.sp.toFuncTable(callee) >= len(s.sp.mod.Code.Bodies) {
+				return fmt.Errorf("cannot split: '%v' calls an unknown function", s.sp.funcName(fnc))
+			}
+			if _, ok := s.split[callee]; ok {
+				continue
+			}
+			if _, ok := external[callee]; !ok {
+				external[callee] = struct{}{}
+				s.external = append(s.external, callee)
 			}
 		}
 	}
+	sort.Ints(s.external)
 	return nil
 }
 
@@ -483,7 +432,6 @@ func backEvalN(instr []disasm.Instr, req int) (int, error) {
 	i := len(instr) - 1
 	for ; i >= 0; i-- {
 		op := instr[i]
-		log.Println(req, op.Immediates, op.Op.Name, op.Op.Args, op.Op.Returns)
 		st, ok := stackVars[op.Op.Name]
 		if !ok {
 			return 0, fmt.Errorf("unsupported op: %v", op.Op.Name)
@@ -536,7 +484,7 @@ func eval(instr []disasm.Instr) ([]uint64, error) {
 }
 
 func evalCode(code []byte) ([]uint64, error) {
-	instr, err := disasm.DisassembleRaw(code)
+	instr, err := disasm.Disassemble(code)
 	if err != nil {
 		return nil, err
 	}
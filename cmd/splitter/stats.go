@@ -0,0 +1,74 @@
+package splitter
+
+import (
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// Stats describes the functions of a module, and how much could be saved by moving the stack
+// pointer updates around calls and returns to functions.
+type Stats struct {
+	Sections  []Section `json:"sections"`
+	Functions int       `json:"functions"` // functions defined by the module
+	Imported  int       `json:"imported"`  // imported functions
+	Table     int       `json:"table"`     // slots in the function table
+	Stubs     int       `json:"stubs"`     // bytes that would be saved by moving the call and return stubs
+	Skipped   int       `json:"skipped"`   // functions that couldn't be disassembled, which aren't in Stubs
+}
+
+// Section is a section of the module. Size includes the id and size of the section, like in the
+// size report.
+type Section struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// Stats returns the stats of the module.
+func (sp *Splitter) Stats() Stats {
+	st := Stats{
+		Imported: sp.funcsImp,
+		Table:    len(sp.funcTable),
+	}
+	if sp.mod.Code != nil {
+		st.Functions = len(sp.mod.Code.Bodies)
+	}
+	// the sections follow each other, so each one starts where the previous one ends, after the
+	// 8 byte header of the module. The Go linker pads the sizes, so they can't be recomputed.
+	end := int64(8)
+	for _, s := range sp.mod.Sections {
+		raw := s.GetRawSection()
+		name := raw.ID.String()
+		if c, ok := s.(*wasm.SectionCustom); ok {
+			name += " " + c.Name
+		}
+		st.Sections = append(st.Sections, Section{Name: name, Size: int(raw.End - end)})
+		end = raw.End
+	}
+	st.Stubs, st.Skipped = sp.StatsCallIndirect()
+	return st
+}
+
+// Func is a function in the function index space, which starts with the imported functions.
+type Func struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Imported bool   `json:"imported,omitempty"`
+}
+
+// Funcs returns the functions with names that start with one of the prefixes, or all functions if
+// there are no prefixes, in index order. Imported functions without a name are named by their
+// module and field.
+func (sp *Splitter) Funcs(prefixes []string) []Func {
+	n := sp.funcsImp
+	if sp.mod.Code != nil {
+		n += len(sp.mod.Code.Bodies)
+	}
+	var funcs []Func
+	for i := 0; i < n; i++ {
+		name := sp.funcName(i)
+		if len(prefixes) > 0 && !hasAnyPrefix(name, prefixes) {
+			continue
+		}
+		funcs = append(funcs, Func{Index: i, Name: name, Imported: sp.isImported(i)})
+	}
+	return funcs
+}
@@ -0,0 +1,180 @@
+package splitter
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dave/wasmgo/cmd/size"
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// Reasons explains why the functions of a target are linked.
+type Reasons struct {
+	Chains      []Chain `json:"chains"`                // shortest chains first
+	Roots       []Func  `json:"roots,omitempty"`       // functions of the target that are roots
+	Unreachable int     `json:"unreachable,omitempty"` // functions of the target that aren't reachable from a root
+}
+
+// Chain is a shortest call chain from a root to a function of the target. Funcs starts with the
+// root and ends with the target function, which is the only one of the target in the chain.
+type Chain struct {
+	Root  string `json:"root"` // "export" or "table"
+	Funcs []Func `json:"funcs"`
+}
+
+// Why finds why the functions of the target are linked: target is the name of a function, or a Go
+// package. For each function outside the target that calls into it, the shortest call chain from a
+// root is returned.
+//
+// The roots are the exported functions, like run and resume, and the functions in the table that
+// nothing calls directly or through a known slot. The Go compiler puts every function in the
+// table and calls closures, methods of interfaces and function values through a slot loaded from
+// memory, so those functions are roots, e.g. the methods of a type that is converted to an
+// interface. They can't be traced further with the call graph.
+//
+// Functions of the target that are only called by functions that aren't reachable from a root,
+// e.g. by functions that call each other through unknown slots, are counted as unreachable.
+func (sp *Splitter) Why(target string) (*Reasons, error) {
+	g, err := sp.CallGraph()
+	if err != nil {
+		return nil, err
+	}
+	isTarget := sp.matchTarget(g, target)
+	if len(isTarget) == 0 {
+		return nil, fmt.Errorf("no functions match %q", target)
+	}
+
+	called := make([]bool, len(g.Funcs))
+	next := make([][]int, len(g.Funcs))
+	for _, e := range g.Edges {
+		if e.Caller != e.Callee {
+			called[e.Callee] = true
+		}
+		next[e.Caller] = append(next[e.Caller], e.Callee)
+	}
+
+	// breadth first search from the roots, which doesn't go through the target, so the chains
+	// only include the function of the target that they end with. Exports are queued first, so
+	// they're preferred to table roots at the same distance.
+	parent := make([]int, len(g.Funcs))
+	root := make([]string, len(g.Funcs))
+	for i := range parent {
+		parent[i] = -2 // not reached
+	}
+	var queue []int
+	reach := func(fnc, from int, kind string) {
+		if parent[fnc] == -2 {
+			parent[fnc] = from
+			root[fnc] = kind
+			queue = append(queue, fnc)
+		}
+	}
+	for _, fnc := range sp.exportedFuncs() {
+		reach(fnc, -1, "export")
+	}
+	for _, n := range g.Funcs {
+		if n.Table && !called[n.Index] {
+			reach(n.Index, -1, "table")
+		}
+	}
+	for len(queue) > 0 {
+		fnc := queue[0]
+		queue = queue[1:]
+		if isTarget[fnc] {
+			continue
+		}
+		for _, callee := range next[fnc] {
+			reach(callee, fnc, root[fnc])
+		}
+	}
+
+	path := func(fnc int) []Func {
+		var funcs []Func
+		for ; fnc >= 0; fnc = parent[fnc] {
+			funcs = append([]Func{g.Funcs[fnc].Func}, funcs...)
+		}
+		return funcs
+	}
+	r := &Reasons{}
+	reached := map[int]bool{}
+	callers := map[int]bool{}
+	for _, n := range g.Funcs {
+		if isTarget[n.Index] && parent[n.Index] == -1 {
+			r.Roots = append(r.Roots, n.Func)
+			reached[n.Index] = true
+		}
+	}
+	for _, e := range g.Edges {
+		if !isTarget[e.Callee] || isTarget[e.Caller] || parent[e.Caller] == -2 {
+			continue
+		}
+		reached[e.Callee] = true
+		if callers[e.Caller] {
+			continue // the chain ends with the first function of the target that it calls
+		}
+		callers[e.Caller] = true
+		r.Chains = append(r.Chains, Chain{Root: root[e.Caller], Funcs: append(path(e.Caller), g.Funcs[e.Callee].Func)})
+	}
+	for fnc := range isTarget {
+		if !reached[fnc] && parent[fnc] == -2 {
+			r.Unreachable++
+		}
+	}
+	sort.SliceStable(r.Chains, func(i, j int) bool {
+		a, b := r.Chains[i].Funcs, r.Chains[j].Funcs
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		for k := range a {
+			if a[k].Index != b[k].Index {
+				return a[k].Index < b[k].Index
+			}
+		}
+		return false
+	})
+	return r, nil
+}
+
+// matchTarget returns the defined functions named target, or if there are none, the defined
+// functions of the package target.
+func (sp *Splitter) matchTarget(g *Graph, target string) map[int]bool {
+	match := map[int]bool{}
+	names := map[string]bool{}
+	for _, name := range Prefixes([]string{target}) {
+		names[name] = true
+	}
+	for _, n := range g.Funcs {
+		if !n.Imported && names[n.Name] {
+			match[n.Index] = true
+		}
+	}
+	if len(match) > 0 {
+		return match
+	}
+	for _, n := range g.Funcs {
+		if !n.Imported && names[size.PackageOf(n.Name)] {
+			match[n.Index] = true
+		}
+	}
+	return match
+}
+
+// exportedFuncs returns the exported functions in the function index space, sorted by the name of
+// the export.
+func (sp *Splitter) exportedFuncs() []int {
+	if sp.mod.Export == nil {
+		return nil
+	}
+	var names []string
+	for name, e := range sp.mod.Export.Entries {
+		if e.Kind == wasm.ExternalFunction {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var funcs []int
+	for _, name := range names {
+		funcs = append(funcs, int(sp.mod.Export.Entries[name].Index))
+	}
+	return funcs
+}
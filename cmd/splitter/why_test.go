@@ -0,0 +1,41 @@
+package splitter
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestWhy checks the chain to a function that main calls, and a function that's only called by a
+// function that isn't reachable from a root, on the program in callsSource.
+func TestWhy(t *testing.T) {
+	sp := decodeCalls(t)
+
+	r, err := sp.Why("main.leaf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Chains) != 1 || len(r.Roots) != 0 || r.Unreachable != 0 {
+		t.Fatalf("unexpected reasons %+v", r)
+	}
+	// runtime.main calls main.main through a function value, so it's a table root
+	var names []string
+	for _, f := range r.Chains[0].Funcs {
+		names = append(names, f.Name)
+	}
+	if expected := []string{"main.main", "main.middle", "main.leaf"}; r.Chains[0].Root != "table" || !reflect.DeepEqual(names, expected) {
+		t.Fatalf("got chain %q from %s root, expected %q from table root", names, r.Chains[0].Root, expected)
+	}
+
+	// even and odd call each other, and even is only called through a function value
+	r, err = sp.Why("main.odd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Chains) != 0 || len(r.Roots) != 0 || r.Unreachable != 1 {
+		t.Fatalf("expected main.odd to be unreachable, got %+v", r)
+	}
+
+	if _, err := sp.Why("main.missing"); err == nil {
+		t.Fatal("expected an error for a function that isn't linked")
+	}
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/dave/wasmgo/cmd/symbolicate"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(symbolicateCmd)
+}
+
+var symbolicateCmd = &cobra.Command{
+	Use:   "symbolicate <binary>",
+	Short: "Symbolicate a stack trace",
+	Long:  "Reads a browser stack trace from stdin and adds the Go function and source location to each wasm frame, using the function names and pclntab in the binary.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		binary, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		s, err := symbolicate.New(binary)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if err := s.Copy(os.Stdout, os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,226 @@
+package symbolicate
+
+import (
+	"fmt"
+
+	"github.com/dave/wasmgo/cmd/wasmbin"
+)
+
+// Go wasm PCs are made of two parts: PC_F, which is funcValueOffset plus the index of the function
+// (not including the imports), and PC_B, which identifies a block within the function.
+//
+// Before each call, the Go wasm backend stores the return address on the Go stack:
+//
+//	global.get SP
+//	i64.const PC_F<<16 | PC_B   (the PC after the call)
+//	i64.store
+//	...
+//	call
+//
+// so the PC of a frame that's stopped at a call can be read from the code. Other frames are
+// mapped to the start of their block using the dispatch at the start of the function:
+//
+//	block                      (only if the function can unwind)
+//	  loop
+//	    block ... block        (one more than the number of resume points)
+//	      global.get PC_B
+//	      br_table ...
+//	    end                    (block 0 starts here)
+//	    ...
+//	    end                    (block 1 starts here, after the first resumable call)
+//
+// The br_table maps each PC_B value to a block, so the first PC_B value mapped to a block is the
+// PC the block starts at.
+
+const funcValueOffset = wasmbin.FuncValueOffset
+
+// maxCallSetup is the most instructions between storing the return address and the call.
+const maxCallSetup = 8
+
+const (
+	opBlock        = 0x02
+	opLoop         = 0x03
+	opIf           = 0x04
+	opEnd          = 0x0b
+	opBrTable      = 0x0e
+	opCall         = 0x10
+	opCallIndirect = 0x11
+	opGlobalGet    = 0x23
+	opI64Store     = 0x37
+	opI64Const     = 0x42
+)
+
+type instr struct {
+	op      byte
+	pos     int      // offset in the body
+	value   int64    // i64.const value
+	targets []uint64 // br_table labels, including the default
+}
+
+// framePC returns the Go PC of a frame at offset in the body of the defined function with the
+// given index. Like the Go runtime, the PC before the return address is used for frames that are
+// stopped at a call, so the call itself is found in the line table, unless the return address is
+// the entry of the function.
+func framePC(code []byte, index, offset int) (uint64, error) {
+	if offset < 0 || offset >= len(code) {
+		return 0, fmt.Errorf("offset %d is outside the function", offset)
+	}
+	instrs, err := decodeInstrs(code)
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for i, in := range instrs {
+		if in.pos > offset {
+			break
+		}
+		current = i
+	}
+
+	if op := instrs[current].op; op == opCall || op == opCallIndirect {
+		// the return address is stored a few instructions before the call
+		for i := current - 1; i > 0 && i >= current-maxCallSetup; i-- {
+			if instrs[i].op == opI64Store && instrs[i-1].op == opI64Const {
+				if pc := uint64(instrs[i-1].value); pc>>16 == uint64(funcValueOffset+index) {
+					if pc&0xffff != 0 {
+						pc--
+					}
+					return pc, nil
+				}
+				break
+			}
+		}
+	}
+
+	return uint64(funcValueOffset+index)<<16 | blockPC(instrs, current), nil
+}
+
+// blockPC returns the PC_B value at the start of the block containing instrs[current].
+func blockPC(instrs []instr, current int) uint64 {
+	i := 0
+	if i < len(instrs) && instrs[i].op == opBlock {
+		i++
+	}
+	if i >= len(instrs) || instrs[i].op != opLoop {
+		return 0
+	}
+	loop := i
+	i++
+	for i < len(instrs) && instrs[i].op == opBlock {
+		i++
+	}
+	if i+1 >= len(instrs) || instrs[i].op != opGlobalGet || instrs[i+1].op != opBrTable {
+		return 0
+	}
+	blocks := i - loop - 1
+	table := instrs[i+1].targets
+
+	// count the ends of dispatch blocks before the instruction
+	depth := blocks
+	block := -1
+	for _, in := range instrs[i+2 : current+1] {
+		switch in.op {
+		case opBlock, opLoop, opIf:
+			depth++
+		case opEnd:
+			if depth == blocks-block-1 && block < blocks-1 {
+				block++
+			}
+			depth--
+		}
+	}
+	if block < 0 {
+		return 0
+	}
+
+	for pc, target := range table[:len(table)-1] {
+		if int(target) >= block {
+			return uint64(pc)
+		}
+	}
+	return uint64(len(table) - 1)
+}
+
+// decodeInstrs decodes the locals and instructions of a function body, keeping the immediates
+// that framePC needs.
+func decodeInstrs(code []byte) ([]instr, error) {
+	r := wasmbin.NewReader(code)
+	for n := r.Uint(); n > 0 && r.Err() == nil; n-- {
+		r.Uint()
+		r.Byte()
+	}
+	var instrs []instr
+	for r.Pos() < len(code) && r.Err() == nil {
+		in := instr{pos: r.Pos(), op: r.Byte()}
+		switch op := in.op; {
+		case op == opBlock || op == opLoop || op == opIf:
+			r.Int() // block type
+		case op == opBrTable:
+			n := r.Uint()
+			for i := uint64(0); i <= n && r.Err() == nil; i++ {
+				in.targets = append(in.targets, r.Uint())
+			}
+		case op == 0x0c || op == 0x0d || op == opCall: // br, br_if, call
+			r.Uint()
+		case op == opCallIndirect:
+			r.Uint()
+			r.Uint()
+		case op == 0x1c: // select with types
+			for n := r.Uint(); n > 0 && r.Err() == nil; n-- {
+				r.Byte()
+			}
+		case op >= 0x20 && op <= 0x26: // locals, globals and tables
+			r.Uint()
+		case op >= 0x28 && op <= 0x3e: // loads and stores
+			r.Uint()
+			r.Uint()
+		case op == 0x3f || op == 0x40: // memory.size, memory.grow
+			r.Byte()
+		case op == 0x41: // i32.const
+			r.Int()
+		case op == opI64Const:
+			in.value = r.Int()
+		case op == 0x43: // f32.const
+			r.Bytes(4)
+		case op == 0x44: // f64.const
+			r.Bytes(8)
+		case op == 0xd0: // ref.null
+			r.Byte()
+		case op == 0xd2: // ref.func
+			r.Uint()
+		case op == 0xfc:
+			decodeMisc(r)
+		case op <= 0x1b || (op >= 0x45 && op <= 0xc4) || op == 0xd1:
+			// no immediates
+		default:
+			return nil, fmt.Errorf("unsupported opcode 0x%02x at offset %d", op, in.pos)
+		}
+		instrs = append(instrs, in)
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	return instrs, nil
+}
+
+// decodeMisc skips the immediates of the 0xfc prefixed instructions.
+func decodeMisc(r *wasmbin.Reader) {
+	switch r.Uint() {
+	case 0, 1, 2, 3, 4, 5, 6, 7: // saturating truncation
+	case 8: // memory.init
+		r.Uint()
+		r.Byte()
+	case 9, 13, 15, 16, 17: // data.drop, elem.drop, table.grow, table.size, table.fill
+		r.Uint()
+	case 10: // memory.copy
+		r.Byte()
+		r.Byte()
+	case 11: // memory.fill
+		r.Byte()
+	case 12, 14: // table.init, table.copy
+		r.Uint()
+		r.Uint()
+	default:
+		r.Fail("unsupported 0xfc instruction")
+	}
+}
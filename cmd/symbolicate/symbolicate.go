@@ -0,0 +1,125 @@
+package symbolicate
+
+import (
+	"bufio"
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dave/wasmgo/cmd/wasmbin"
+)
+
+// Symbolicator maps the wasm frames in browser stack traces to Go functions and source
+// locations, using the function names and the Go pclntab embedded in the binary.
+type Symbolicator struct {
+	mod   *wasmbin.Module
+	table *gosym.Table
+}
+
+// Frame is the Go location of a wasm frame.
+type Frame struct {
+	Func string
+	File string
+	Line int
+}
+
+func (f Frame) String() string {
+	if f.File == "" {
+		return f.Func
+	}
+	return fmt.Sprintf("%s %s:%d", f.Func, f.File, f.Line)
+}
+
+// New decodes a Go wasm binary. Binaries without a pclntab (e.g. not built by Go) can still be
+// symbolicated using the function names only.
+func New(binary []byte) (*Symbolicator, error) {
+	mod, err := wasmbin.Decode(binary)
+	if err != nil {
+		return nil, err
+	}
+	s := &Symbolicator{mod: mod, table: mod.Pclntab()}
+	if s.table == nil && len(mod.Names) == 0 {
+		return nil, errors.New("binary has no function names or pclntab")
+	}
+	return s, nil
+}
+
+// Lookup returns the Go location of a frame. The offset is a module offset if isModuleOffset is
+// set, or an offset in the function body otherwise.
+func (s *Symbolicator) Lookup(funcIndex, offset int, isModuleOffset bool) (Frame, error) {
+	name, named := s.mod.Names[funcIndex]
+	index := funcIndex - s.mod.Imported
+	if index < 0 {
+		if named {
+			return Frame{Func: name}, nil
+		}
+		return Frame{}, fmt.Errorf("unknown imported function %d", funcIndex)
+	}
+	if index >= len(s.mod.Bodies) {
+		return Frame{}, fmt.Errorf("unknown function %d", funcIndex)
+	}
+	body := s.mod.Bodies[index]
+	if s.table != nil {
+		if isModuleOffset {
+			offset -= body.Offset
+		}
+		pc, err := framePC(body.Code, index, offset)
+		if err != nil {
+			return Frame{}, err
+		}
+		if file, line, fn := s.table.PCToLine(pc); fn != nil {
+			return Frame{Func: fn.Name, File: file, Line: line}, nil
+		}
+	}
+	if named {
+		return Frame{Func: name}, nil
+	}
+	return Frame{}, fmt.Errorf("unknown function %d", funcIndex)
+}
+
+// frameRegex matches wasm frames in Chrome and Firefox stack traces: the function index followed
+// by a hex module offset (e.g. wasm-function[123]:0x1a2b) or a decimal function offset.
+var frameRegex = regexp.MustCompile(`wasm-function\[(\d+)\]:(0x[0-9a-fA-F]+|\d+)`)
+
+// Line appends the Go location to a line of a stack trace that contains a wasm frame. Other lines
+// are returned unchanged.
+func (s *Symbolicator) Line(line string) string {
+	match := frameRegex.FindStringSubmatch(line)
+	if match == nil {
+		return line
+	}
+	funcIndex, err := strconv.Atoi(match[1])
+	if err != nil {
+		return line
+	}
+	isModuleOffset := strings.HasPrefix(match[2], "0x")
+	base := 10
+	if isModuleOffset {
+		base = 16
+	}
+	offset, err := strconv.ParseInt(strings.TrimPrefix(match[2], "0x"), base, 64)
+	if err != nil {
+		return line
+	}
+	frame, err := s.Lookup(funcIndex, int(offset), isModuleOffset)
+	if err != nil {
+		return line
+	}
+	return fmt.Sprintf("%s [%s]", line, frame)
+}
+
+// Copy symbolicates a stack trace line by line.
+func (s *Symbolicator) Copy(w io.Writer, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if _, err := fmt.Fprintln(w, s.Line(scanner.Text())); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/dave/wasmgo/cmd/server"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	testCmd.PersistentFlags().IntVarP(&global.Port, "port", "p", 8080, "Server port.")
+	testCmd.PersistentFlags().StringVar(&global.Run, "run", "", "Run only the tests and examples matching the regular expression.")
+	testCmd.PersistentFlags().StringVar(&global.Bench, "bench", "", "Run only the benchmarks matching the regular expression.")
+	testCmd.PersistentFlags().IntVar(&global.Count, "count", 0, "Run each test and benchmark this many times.")
+	testCmd.PersistentFlags().StringVar(&global.Cover, "coverprofile", "", "Build the tests with coverage and write the coverage profile to this file.")
+	rootCmd.AddCommand(testCmd)
+}
+
+var testCmd = &cobra.Command{
+	Use:   "test [package] [-- test flags]",
+	Short: "Run tests in the browser",
+	Long:  "Compiles the tests of the package to WASM and serves them locally. The tests run in the page that's opened, and the results are written to the terminal. Flags after -- are passed to the test binary, e.g. -- -short -timeout 30s.",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(packageArgs(cmd, args)) > 1 {
+			return errors.New("accepts at most 1 package")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if pkgs := packageArgs(cmd, args); len(pkgs) > 0 {
+			global.Path = pkgs[0]
+		}
+		global.Test = true
+		// the flags of the serve command share the config, but the test binary is only run once
+		global.Watch = false
+		global.Hot = false
+		extra, err := coverArg(args[len(packageArgs(cmd, args)):])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		global.TestArgs = testArgs(extra)
+		code, err := server.Test(global)
+		if err == deployer.ErrNoTestFiles {
+			path := global.Path
+			if path == "" {
+				path = "."
+			}
+			fmt.Printf("?   \t%s\t[no test files]\n", path)
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(code)
+	},
+}
+
+// packageArgs returns the arguments before --.
+func packageArgs(cmd *cobra.Command, args []string) []string {
+	if dash := cmd.ArgsLenAtDash(); dash != -1 {
+		return args[:dash]
+	}
+	return args
+}
+
+// testFlags are the flags of the test binary that can be given without the test. prefix, like
+// go test.
+var testFlags = map[string]bool{
+	"bench": true, "benchmem": true, "benchtime": true, "count": true, "cpu": true, "failfast": true,
+	"fullpath": true, "list": true, "parallel": true, "run": true, "short": true, "shuffle": true,
+	"skip": true, "timeout": true, "v": true,
+}
+
+// testArgs returns the arguments for the test binary: -test.v, the flags from the command line and
+// the arguments after --.
+func testArgs(extra []string) []string {
+	args := []string{"-test.v"}
+	if global.Run != "" {
+		args = append(args, "-test.run="+global.Run)
+	}
+	if global.Bench != "" {
+		args = append(args, "-test.bench="+global.Bench)
+	}
+	if global.Count > 0 {
+		args = append(args, "-test.count="+strconv.Itoa(global.Count))
+	}
+	if global.Cover != "" {
+		args = append(args, "-test.gocoverdir="+deployer.CoverDir, "-test.coverprofile="+deployer.CoverFile)
+	}
+	for _, arg := range extra {
+		if strings.HasPrefix(arg, "-") {
+			name := strings.TrimLeft(arg, "-")
+			if i := strings.Index(name, "="); i != -1 {
+				name = name[:i]
+			}
+			if testFlags[name] {
+				arg = "-test." + strings.TrimLeft(arg, "-")
+			}
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// coverArg removes -coverprofile from the arguments after --, and uses it to set the coverprofile
+// flag. The test binary can't write the file itself, so the profile is written by the server.
+func coverArg(extra []string) ([]string, error) {
+	var out []string
+	for i := 0; i < len(extra); i++ {
+		name := strings.TrimLeft(extra[i], "-")
+		switch {
+		case !strings.HasPrefix(extra[i], "-"):
+		case name == "coverprofile" || name == "test.coverprofile":
+			if i+1 == len(extra) {
+				return nil, fmt.Errorf("flag needs an argument: %s", extra[i])
+			}
+			global.Cover = extra[i+1]
+			i++
+			continue
+		case strings.HasPrefix(name, "coverprofile=") || strings.HasPrefix(name, "test.coverprofile="):
+			global.Cover = name[strings.Index(name, "=")+1:]
+			continue
+		}
+		out = append(out, extra[i])
+	}
+	return out, nil
+}
@@ -0,0 +1,288 @@
+package toolchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// DefaultCommand is the name of the go command when none is specified.
+const DefaultCommand = "go"
+
+// Minimum is the first Go release that supports GOOS=js GOARCH=wasm.
+var Minimum = Version{Major: 1, Minor: 11}
+
+// Toolchain is a go command that has been checked to support js/wasm.
+type Toolchain struct {
+	Command string            // name or path of the go command
+	Path    string            // full path of the go command
+	Version Version           // parsed version
+	Output  string            // output of `go version`
+	Env     map[string]string // output of `go env -json`
+	Reason  string            // why this toolchain was chosen
+}
+
+func (t *Toolchain) GOROOT() string {
+	return t.Env["GOROOT"]
+}
+
+func (t *Toolchain) String() string {
+	return fmt.Sprintf("%s (%s, GOROOT=%s)", t.Output, t.Path, t.GOROOT())
+}
+
+// Resolve finds the go toolchain to use. If command is the default go command and the go.mod of
+// the current module requires a newer version, installed wrapper binaries (e.g. go1.12.5, installed
+// from golang.org/dl) are searched for a version that satisfies the go directive. A toolchain
+// directive is honoured in the same way if a wrapper binary is installed for it, but it's only a
+// preference, so the go directive is all that must be satisfied. Progress messages are written to
+// debug.
+func Resolve(command string, debug io.Writer) (*Toolchain, error) {
+	if command == "" {
+		command = DefaultCommand
+	}
+	t, err := load(command)
+	if err != nil {
+		return nil, err
+	}
+	t.Reason = "specified with the -c flag"
+	if command == DefaultCommand {
+		t.Reason = "default go command"
+		required, preferred, gomod, err := goDirective(t.Env["GOMOD"])
+		if err != nil {
+			return nil, err
+		}
+		if gomod != "" && t.Version.Less(preferred) {
+			fmt.Fprintf(debug, "%s prefers %s but the default go command is %s, searching for installed versions...\n", gomod, preferred, t.Version)
+			wrapper, err := findWrapper(preferred, debug)
+			if err != nil {
+				return nil, err
+			}
+			if wrapper != nil {
+				t = wrapper
+				t.Reason = fmt.Sprintf("toolchain directive in %s", gomod)
+			}
+		}
+		if gomod != "" && t.Version.Less(required) {
+			fmt.Fprintf(debug, "%s requires %s but the default go command is %s, searching for installed versions...\n", gomod, required, t.Version)
+			wrapper, err := findWrapper(required, debug)
+			if err != nil {
+				return nil, err
+			}
+			if wrapper == nil {
+				return nil, &UnsupportedError{Command: command, Version: t.Version, Required: required, GoMod: gomod}
+			}
+			t = wrapper
+			t.Reason = fmt.Sprintf("go directive in %s", gomod)
+		}
+	}
+	if t.Version.Less(Minimum) {
+		return nil, &UnsupportedError{Command: t.Command, Version: t.Version, Required: Minimum}
+	}
+	fmt.Fprintf(debug, "Using toolchain %s: %s\n", t, t.Reason)
+	return t, nil
+}
+
+// UnsupportedError is returned by Resolve when the go command is too old to compile WASM, or is
+// older than the go directive in go.mod requires and no suitable wrapper binary is installed.
+type UnsupportedError struct {
+	Command  string  // name of the go command
+	Version  Version // version of the go command
+	Required Version // minimum version required
+	GoMod    string  // path of the go.mod file, if the version is required by a go directive
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.GoMod != "" {
+		return fmt.Sprintf("%s requires %s but the default go command is %s. Install it with `go get golang.org/dl/%s && %s download`, or use the -c flag to specify a custom command name", e.GoMod, e.Required, e.Version, e.Required, e.Required)
+	}
+	return fmt.Sprintf("you need %s or later to compile WASM. It looks like `%s` is %s. Perhaps you need the -c flag to specify a custom command name - e.g. `-c=go1.11.13`", e.Required, e.Command, e.Version)
+}
+
+func load(command string) (*Toolchain, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, fmt.Errorf("can't find the go command %q: %v", command, err)
+	}
+	output, err := exec.Command(path, "version").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, string(output))
+	}
+	version, err := ParseVersion(string(output))
+	if err != nil {
+		return nil, err
+	}
+	envOutput, err := exec.Command(path, "env", "-json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("running `%s env -json`: %v", command, err)
+	}
+	env := map[string]string{}
+	if err := json.Unmarshal(envOutput, &env); err != nil {
+		return nil, fmt.Errorf("parsing `%s env -json`: %v", command, err)
+	}
+	return &Toolchain{
+		Command: command,
+		Path:    path,
+		Version: version,
+		Output:  strings.TrimSpace(string(output)),
+		Env:     env,
+	}, nil
+}
+
+// findWrapper searches PATH and GOPATH/bin for goX.Y[.Z] commands. The lowest minor version that
+// satisfies required is chosen, with the highest patch release of that minor version.
+func findWrapper(required Version, debug io.Writer) (*Toolchain, error) {
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		for _, dir := range filepath.SplitList(gopath) {
+			dirs = append(dirs, filepath.Join(dir, "bin"))
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "go", "bin"))
+	}
+	found := map[string]Version{}
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if !wrapperRegex.MatchString(info.Name()) {
+				continue
+			}
+			v, err := ParseVersion(info.Name())
+			if err != nil || v.Less(required) {
+				continue
+			}
+			// earlier directories take precedence, as with PATH
+			if !seen[info.Name()] {
+				seen[info.Name()] = true
+				found[filepath.Join(dir, info.Name())] = v
+			}
+		}
+	}
+	var candidates []string
+	for path := range found {
+		candidates = append(candidates, path)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		vi, vj := found[candidates[i]], found[candidates[j]]
+		if vi.Major != vj.Major || vi.Minor != vj.Minor {
+			return vi.Less(vj)
+		}
+		return vj.Less(vi)
+	})
+	for _, path := range candidates {
+		// wrappers from golang.org/dl fail until the download command has been run
+		t, err := load(path)
+		if err != nil {
+			fmt.Fprintf(debug, "Skipping %s: %v\n", path, err)
+			continue
+		}
+		return t, nil
+	}
+	return nil, nil
+}
+
+var wrapperRegex = regexp.MustCompile(`^go\d+\.\d+(\.\d+)?(\.exe)?$`)
+
+// goDirective returns the versions in the go and toolchain directives of the go.mod file. If
+// there's no go.mod or no go directive, gomod is empty, and if there's no toolchain directive (or
+// it's "default"), toolchain is the zero Version.
+func goDirective(gomod string) (required, toolchain Version, path string, err error) {
+	if gomod == "" || gomod == os.DevNull {
+		return Version{}, Version{}, "", nil
+	}
+	data, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Version{}, Version{}, "", nil
+		}
+		return Version{}, Version{}, "", err
+	}
+	f, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		// directives added after this version of modfile are errors, so fall back to the lax
+		// parser, which skips them along with the toolchain directive
+		lax, laxErr := modfile.ParseLax(gomod, data, nil)
+		if laxErr != nil {
+			return Version{}, Version{}, "", err
+		}
+		f = lax
+	}
+	if f.Go == nil {
+		return Version{}, Version{}, "", nil
+	}
+	required, err = ParseVersion("go" + f.Go.Version)
+	if err != nil {
+		return Version{}, Version{}, "", fmt.Errorf("%s: %v", gomod, err)
+	}
+	if f.Toolchain != nil && f.Toolchain.Name != "default" {
+		toolchain, err = ParseVersion(f.Toolchain.Name)
+		if err != nil {
+			return Version{}, Version{}, "", fmt.Errorf("%s: %v", gomod, err)
+		}
+	}
+	return required, toolchain, gomod, nil
+}
+
+// Version is a Go release version. Devel versions are considered newer than all releases.
+type Version struct {
+	Major, Minor, Patch int
+	Devel               bool
+}
+
+func (v Version) String() string {
+	if v.Devel {
+		return "devel"
+	}
+	if v.Patch > 0 {
+		return fmt.Sprintf("go%d.%d.%d", v.Major, v.Minor, v.Patch)
+	}
+	return fmt.Sprintf("go%d.%d", v.Major, v.Minor)
+}
+
+// Less reports whether v is an earlier release than w.
+func (v Version) Less(w Version) bool {
+	switch {
+	case v.Devel || w.Devel:
+		return !v.Devel && w.Devel
+	case v.Major != w.Major:
+		return v.Major < w.Major
+	case v.Minor != w.Minor:
+		return v.Minor < w.Minor
+	}
+	return v.Patch < w.Patch
+}
+
+var versionRegex = regexp.MustCompile(`\bgo(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion finds the version in s, which may be the output of `go version` or a command name
+// such as go1.11.2.
+func ParseVersion(s string) (Version, error) {
+	if strings.Contains(s, "devel") {
+		return Version{Devel: true}, nil
+	}
+	matches := versionRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return Version{}, fmt.Errorf("can't find go version in %q", strings.TrimSpace(s))
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(matches[1])
+	v.Minor, _ = strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		v.Patch, _ = strconv.Atoi(matches[3])
+	}
+	return v, nil
+}
@@ -0,0 +1,37 @@
+package toolchain
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoDirective(t *testing.T) {
+	tests := map[string]struct {
+		gomod               string
+		required, preferred Version
+	}{
+		"go":           {"module a\n\ngo 1.21\n", Version{Major: 1, Minor: 21}, Version{}},
+		"comment":      {"module a\n\ngo 1.21 // comment\n", Version{Major: 1, Minor: 21}, Version{}},
+		"patch":        {"module a\n\ngo 1.22.3\n", Version{Major: 1, Minor: 22, Patch: 3}, Version{}},
+		"toolchain":    {"module a\n\ngo 1.21\n\ntoolchain go1.22.3\n", Version{Major: 1, Minor: 21}, Version{Major: 1, Minor: 22, Patch: 3}},
+		"default":      {"module a\n\ngo 1.21\n\ntoolchain default\n", Version{Major: 1, Minor: 21}, Version{}},
+		"no directive": {"module a\n", Version{}, Version{}},
+		"unknown":      {"module a\n\ngo 1.24\n\nfuture directive\n", Version{Major: 1, Minor: 24}, Version{}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fpath := filepath.Join(t.TempDir(), "go.mod")
+			if err := ioutil.WriteFile(fpath, []byte(test.gomod), 0666); err != nil {
+				t.Fatal(err)
+			}
+			required, preferred, _, err := goDirective(fpath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if required != test.required || preferred != test.preferred {
+				t.Fatalf("got %v and %v, expected %v and %v", required, preferred, test.required, test.preferred)
+			}
+		})
+	}
+}
@@ -2,12 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 
+	"github.com/dave/wasmgo/cmd/config"
 	"github.com/dave/wasmgo/cmd/deployer"
+	"github.com/dave/wasmgo/cmd/toolchain"
 	"github.com/spf13/cobra"
 )
 
 func init() {
+	addEndpointFlags(versionCmd)
 	rootCmd.AddCommand(versionCmd)
 }
 
@@ -16,5 +21,21 @@ var versionCmd = &cobra.Command{
 	Short: "Show client version number",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println(deployer.CLIENT_VERSION)
+		// the version and endpoints are still useful without a toolchain
+		if tc, err := toolchain.Resolve(global.Command, ioutil.Discard); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: no usable go toolchain: %s\n", err.Error())
+		} else {
+			fmt.Printf("Toolchain: %s\n", tc)
+			fmt.Printf("Reason: %s\n", tc.Reason)
+		}
+		endpoints, err := deployer.LoadEndpoints(global)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Endpoints: %s (%s)\n", endpoints.Set, endpoints.SetSource)
+		for _, host := range []string{config.Wasm, config.Pkg, config.Index} {
+			fmt.Printf("  %-6s %s (%s)\n", host+":", endpoints.Get(host), endpoints.Sources[host])
+		}
 	},
 }
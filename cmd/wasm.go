@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dave/wasmgo/cmd/splitter"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	wasmCmd.PersistentFlags().StringVar(&global.Input, "input", "", "WASM binary to read, or a package to compile, instead of the argument. Omit both to compile the package in the current directory.")
+	wasmSplitCmd.PersistentFlags().StringVar(&global.SplitOut, "output", "", "File to write the primary module to. The secondary module is written next to it, with _split added to the name. Defaults to the input file with _out added to the name.")
+	wasmSplitCmd.PersistentFlags().StringVar(&global.Prefix, "prefix", "", "Comma separated prefixes of the names of the functions to move to the secondary module. Omit to split the runtime.")
+	wasmNamesCmd.PersistentFlags().StringVar(&global.Prefix, "prefix", "", "Comma separated prefixes of the names of the functions to show. Omit to show all functions.")
+	wasmStatsCmd.PersistentFlags().BoolVarP(&global.Json, "json", "j", false, "Print the stats as json.")
+	wasmNamesCmd.PersistentFlags().BoolVarP(&global.Json, "json", "j", false, "Print the functions as json.")
+	wasmGraphCmd.PersistentFlags().BoolVarP(&global.Json, "json", "j", false, "Print the graph as json instead of DOT.")
+	wasmGraphCmd.PersistentFlags().BoolVar(&global.Funcs, "funcs", false, "Show the calls between functions, grouped by package, instead of the calls between packages.")
+	wasmWhyCmd.PersistentFlags().BoolVarP(&global.Json, "json", "j", false, "Print the chains as json.")
+	wasmWhyCmd.PersistentFlags().IntVarP(&global.Top, "top", "n", 20, "Number of chains to show, or 0 for all.")
+	wasmCmd.AddCommand(wasmSplitCmd, wasmStatsCmd, wasmNamesCmd, wasmGraphCmd, wasmWhyCmd)
+	rootCmd.AddCommand(wasmCmd)
+}
+
+var wasmCmd = &cobra.Command{
+	Use:   "wasm",
+	Short: "Analyse and split WASM binaries",
+	Long:  "Tools for WASM binaries produced by the go compiler. Each command reads the binary given by the argument (or the input flag), or compiles it if that's a package.",
+}
+
+var wasmSplitCmd = &cobra.Command{
+	Use:   "split [package|binary.wasm]",
+	Short: "Split the binary into a primary and a secondary module",
+	Long:  "Moves the functions with names that start with one of the prefixes to a secondary module, which shares the table and memory of the primary module. The primary module imports wasmgo.load, which must instantiate the secondary module synchronously, with the exports of the primary module as wasmgo.primary.",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := wasmSplit(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+var wasmStatsCmd = &cobra.Command{
+	Use:   "stats [package|binary.wasm]",
+	Short: "Show the sections and functions of the binary",
+	Long:  "Shows the sections of the binary, the number of functions, and how much would be saved by moving the stack pointer updates around calls and returns to functions.",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := wasmStats(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+var wasmNamesCmd = &cobra.Command{
+	Use:   "names [package|binary.wasm]",
+	Short: "List the functions of the binary",
+	Long:  "Lists the functions of the binary with their indexes, which start with the imported functions. The names are from the name section of the binary.",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := wasmNames(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+var wasmGraphCmd = &cobra.Command{
+	Use:   "graph [package|binary.wasm]",
+	Short: "Export the call graph of the binary",
+	Long:  "Builds the call graph from the calls in every function, and prints it in the DOT language or as json. By default the functions are grouped by Go package, to show how packages depend on each other. Indirect calls are resolved through the table when the slot is a constant, and shown dashed.",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := wasmGraph(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+var wasmWhyCmd = &cobra.Command{
+	Use:   "why [package|binary.wasm] function|package",
+	Short: "Show why a function or package is in the binary",
+	Long:  "Prints the shortest call chains to the function, or to the functions of the package, from the roots of the binary: the exported functions like run and resume, and the functions in the table that are only called indirectly, like methods of interfaces and closures. There's a chain for each function outside the package that calls into it.",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := wasmWhy(args[:len(args)-1], args[len(args)-1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// setInput sets the input from the argument, if there is one. The input flag is an alias for the
+// argument.
+func setInput(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if global.Input != "" && global.Input != args[0] {
+		return errors.New("the input must be given by the argument or the input flag, not both")
+	}
+	global.Input = args[0]
+	return nil
+}
+
+// loadInput reads or compiles the binary given by the argument or the input flag.
+func loadInput() ([]byte, error) {
+	if global.Input == "" {
+		return loadBinary(nil)
+	}
+	return loadBinary([]string{global.Input})
+}
+
+// loadSplitter decodes the binary given by the argument or the input flag.
+func loadSplitter() (*splitter.Splitter, []byte, error) {
+	binary, err := loadInput()
+	if err != nil {
+		return nil, nil, err
+	}
+	sp, err := splitter.Decode(binary)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sp, binary, nil
+}
+
+// prefixes returns the prefixes from the prefix flag, with the form used in the names by recent
+// versions of Go.
+func prefixes() []string {
+	var list []string
+	for _, p := range strings.Split(global.Prefix, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return splitter.Prefixes(list)
+}
+
+func wasmSplit(args []string) error {
+	if err := setInput(args); err != nil {
+		return err
+	}
+	output := global.SplitOut
+	if output == "" {
+		if !strings.HasSuffix(global.Input, ".wasm") {
+			return errors.New("the output flag is needed unless the input is a .wasm file")
+		}
+		output = strings.TrimSuffix(global.Input, ".wasm") + "_out.wasm"
+	}
+	ext := filepath.Ext(output)
+	secondaryOutput := strings.TrimSuffix(output, ext) + "_split" + ext
+
+	binary, err := loadInput()
+	if err != nil {
+		return err
+	}
+	list := prefixes()
+	if len(list) == 0 {
+		list = splitter.RuntimePrefixes
+	}
+	primary, secondary, err := splitter.Split(binary, list)
+	if err != nil {
+		return err
+	}
+	if secondary == nil {
+		return errors.New("no functions match the prefixes")
+	}
+	if err := ioutil.WriteFile(output, primary, 0666); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(secondaryOutput, secondary, 0666); err != nil {
+		return err
+	}
+	fmt.Printf("%s\t%s\n", output, humanize.Bytes(uint64(len(primary))))
+	fmt.Printf("%s\t%s\n", secondaryOutput, humanize.Bytes(uint64(len(secondary))))
+	return nil
+}
+
+func wasmStats(args []string) error {
+	if err := setInput(args); err != nil {
+		return err
+	}
+	sp, binary, err := loadSplitter()
+	if err != nil {
+		return err
+	}
+	stats := sp.Stats()
+	if global.Json {
+		b, err := json.MarshalIndent(stats, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Total:\t%s\n", humanize.Bytes(uint64(len(binary))))
+	fmt.Fprintf(tw, "Functions:\t%d (and %d imported)\n", stats.Functions, stats.Imported)
+	fmt.Fprintf(tw, "Table:\t%d slots\n", stats.Table)
+	fmt.Fprintf(tw, "Stubs:\t%s could be saved by moving the stack pointer updates around calls and returns to functions\n", humanize.Bytes(uint64(stats.Stubs)))
+	if stats.Skipped > 0 {
+		fmt.Fprintf(tw, "Skipped:\t%d functions with unsupported instructions aren't included in the stubs\n", stats.Skipped)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Println()
+	fmt.Println("Sections:")
+	tw = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, s := range stats.Sections {
+		fmt.Fprintf(tw, "  %s\t%s\n", humanize.Bytes(uint64(s.Size)), s.Name)
+	}
+	return tw.Flush()
+}
+
+func wasmNames(args []string) error {
+	if err := setInput(args); err != nil {
+		return err
+	}
+	sp, _, err := loadSplitter()
+	if err != nil {
+		return err
+	}
+	funcs := sp.Funcs(prefixes())
+	if global.Json {
+		b, err := json.MarshalIndent(funcs, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	for _, f := range funcs {
+		if f.Imported {
+			fmt.Printf("%d\t%s (imported)\n", f.Index, f.Name)
+		} else {
+			fmt.Printf("%d\t%s\n", f.Index, f.Name)
+		}
+	}
+	return nil
+}
+
+func wasmGraph(args []string) error {
+	if err := setInput(args); err != nil {
+		return err
+	}
+	sp, _, err := loadSplitter()
+	if err != nil {
+		return err
+	}
+	g, err := sp.CallGraph()
+	if err != nil {
+		return err
+	}
+	var graph interface {
+		WriteDOT(w io.Writer) error
+	} = g.Packages()
+	if global.Funcs {
+		graph = g
+	}
+	if global.Json {
+		b, err := json.MarshalIndent(graph, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	return graph.WriteDOT(os.Stdout)
+}
+
+func wasmWhy(args []string, target string) error {
+	if global.Top < 0 {
+		return errors.New("top must not be negative")
+	}
+	if err := setInput(args); err != nil {
+		return err
+	}
+	sp, _, err := loadSplitter()
+	if err != nil {
+		return err
+	}
+	r, err := sp.Why(target)
+	if err != nil {
+		return err
+	}
+	roots := len(r.Roots)
+	more := 0
+	if global.Top > 0 {
+		if len(r.Chains) > global.Top {
+			more = len(r.Chains) - global.Top
+			r.Chains = r.Chains[:global.Top]
+		}
+		if len(r.Roots) > global.Top {
+			r.Roots = r.Roots[:global.Top]
+		}
+	}
+	if global.Json {
+		b, err := json.MarshalIndent(r, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	for i, c := range r.Chains {
+		if i > 0 {
+			fmt.Println()
+		}
+		for j, f := range c.Funcs {
+			if j == 0 {
+				fmt.Printf("%s (%s root)\n", f.Name, c.Root)
+			} else {
+				fmt.Printf("  -> %s\n", f.Name)
+			}
+		}
+	}
+	if more > 0 {
+		fmt.Printf("\n%d more chains, use --top 0 to show all\n", more)
+	}
+	if roots > 0 {
+		fmt.Printf("\n%d functions are roots, which are only called indirectly or exported:\n", roots)
+		for _, f := range r.Roots {
+			fmt.Printf("  %s\n", f.Name)
+		}
+		if roots > len(r.Roots) {
+			fmt.Printf("  and %d more\n", roots-len(r.Roots))
+		}
+	}
+	if r.Unreachable > 0 {
+		fmt.Printf("\n%d functions are only called by functions that aren't reachable from a root\n", r.Unreachable)
+	}
+	return nil
+}
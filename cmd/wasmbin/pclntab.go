@@ -0,0 +1,95 @@
+package wasmbin
+
+import (
+	"debug/gosym"
+	"encoding/binary"
+)
+
+// FuncValueOffset is added to the index of a defined function to get the PC_F part of its Go PCs.
+const FuncValueOffset = 0x1000
+
+// pclntab magic numbers for Go 1.18 and 1.20+
+var pclntabMagic = []uint32{0xfffffff0, 0xfffffff1}
+
+// Pclntab searches the initial contents of linear memory for the Go pclntab, which the Go linker
+// puts in the data section. It returns nil if there isn't one.
+func (m *Module) Pclntab() *gosym.Table {
+	mem := m.Memory()
+	for i := 0; i+64 <= len(mem); i += 8 {
+		magic := binary.LittleEndian.Uint32(mem[i:])
+		if magic != pclntabMagic[0] && magic != pclntabMagic[1] {
+			continue
+		}
+		// two zero bytes, the pc quantum (1 on wasm) and the pointer size
+		if mem[i+4] != 0 || mem[i+5] != 0 || mem[i+6] != 1 || mem[i+7] != 8 {
+			continue
+		}
+		data := wasmPclntab(mem[i:])
+		if data == nil {
+			continue
+		}
+		text := binary.LittleEndian.Uint64(data[8+2*8:]) << 16
+		table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text))
+		if err != nil || len(table.Funcs) == 0 {
+			continue
+		}
+		return table
+	}
+	return nil
+}
+
+// wasmPclntab returns a copy of the pclntab with the function entries converted to PCs. On wasm
+// the entries (and the start of the text) are PC_F values, but debug/gosym expects the PCs the
+// pc-value tables are relative to, which are PC_F << 16. It returns nil if the table is
+// malformed.
+func wasmPclntab(pclntab []byte) []byte {
+	data := append([]byte(nil), pclntab...)
+	word := func(n int) uint64 {
+		return binary.LittleEndian.Uint64(data[8+n*8:])
+	}
+	nfunc := word(0)
+	funcdata := word(7)
+	if funcdata >= uint64(len(data)) || nfunc > (uint64(len(data))-funcdata)/8 {
+		return nil
+	}
+	functab := data[funcdata:]
+	shift := func(b []byte) bool {
+		if len(b) < 4 {
+			return false
+		}
+		binary.LittleEndian.PutUint32(b, binary.LittleEndian.Uint32(b)<<16)
+		return true
+	}
+	for i := uint64(0); i < nfunc; i++ {
+		// each entry is the entry offset and the offset of the _func, which also starts with the
+		// entry offset
+		shift(functab[i*8:])
+		if off := binary.LittleEndian.Uint32(functab[i*8+4:]); !shift(functab[off:]) {
+			return nil
+		}
+	}
+	// the entry after the last function is the end of the text
+	if !shift(functab[nfunc*8:]) {
+		return nil
+	}
+	return data
+}
+
+// GoNames returns the names of the Go functions from the pclntab, in the function index space
+// including imports, or nil if there's no pclntab. Unlike the names in the name section, which
+// have the characters other than letters, digits, _ and . replaced, they're the names used by the
+// Go toolchain, e.g. internal/strconv.(*decimal).Assign.
+func (m *Module) GoNames() map[int]string {
+	table := m.Pclntab()
+	if table == nil {
+		return nil
+	}
+	names := map[int]string{}
+	for _, fn := range table.Funcs {
+		index := int(fn.Entry>>16) - FuncValueOffset
+		if index >= 0 && index < len(m.Bodies) {
+			names[m.Imported+index] = fn.Name
+		}
+	}
+	return names
+}
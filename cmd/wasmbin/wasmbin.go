@@ -0,0 +1,335 @@
+// Package wasmbin decodes the parts of a WASM binary that the size report, the symbolicator and
+// the splitter need: the sections, the function bodies, the data segments and the function name
+// section. It reads the binary directly rather than with a full wasm library, and keeps the
+// offsets of the bodies in the binary, which the browser uses in stack traces. Reader is also
+// used to decode instructions, and by the runner to decode the rest of the module.
+package wasmbin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Module is a decoded binary.
+type Module struct {
+	Sections []Section
+	Imported int            // number of imported functions
+	Bodies   []Body         // defined functions, in function index order after the imports
+	Segments []Segment      // data segments
+	Names    map[int]string // function names, in the function index space including imports
+}
+
+// Section is a section of the binary.
+type Section struct {
+	ID   byte
+	Name string // name of a custom section
+	Size int    // including the id and size
+}
+
+// Body is the body of a defined function.
+type Body struct {
+	Offset int    // offset in the binary of the first byte of the body, after the size
+	Size   int    // including the size prefix
+	Code   []byte // locals and instructions
+}
+
+// Segment is a data segment.
+type Segment struct {
+	Active bool   // copied to linear memory when the module is instantiated
+	Addr   uint32 // address in linear memory of an active segment
+	Data   []byte
+}
+
+// Section ids.
+const (
+	SectionCustom = 0
+	SectionImport = 2
+	SectionCode   = 10
+	SectionData   = 11
+)
+
+var sectionNames = []string{"custom", "type", "import", "function", "table", "memory", "global", "export", "start", "element", "code", "data", "datacount"}
+
+func (s Section) String() string {
+	if s.ID == SectionCustom {
+		return "custom " + s.Name
+	}
+	if int(s.ID) < len(sectionNames) {
+		return sectionNames[s.ID]
+	}
+	return fmt.Sprintf("section %d", s.ID)
+}
+
+// Decode decodes a binary.
+func Decode(b []byte) (*Module, error) {
+	if len(b) < 8 || !bytes.Equal(b[:4], []byte("\x00asm")) {
+		return nil, errors.New("not a wasm binary")
+	}
+	m := &Module{Names: map[int]string{}}
+	r := &Reader{b: b, pos: 8}
+	for r.pos < len(b) {
+		header := r.pos
+		id := r.Byte()
+		size := int(r.Uint())
+		start := r.pos
+		if r.err != nil || start+size > len(b) {
+			return nil, errors.New("malformed wasm section")
+		}
+		sec := &Reader{b: b[:start+size], pos: start}
+		s := Section{ID: id, Size: start + size - header}
+		switch id {
+		case SectionCustom:
+			s.Name = sec.Name()
+			if s.Name == "name" {
+				decodeNames(sec, m.Names)
+			}
+		case SectionImport:
+			m.decodeImports(sec)
+		case SectionCode:
+			m.decodeCode(sec)
+		case SectionData:
+			m.decodeData(sec)
+		}
+		if sec.err != nil {
+			return nil, fmt.Errorf("malformed wasm section %d: %v", id, sec.err)
+		}
+		m.Sections = append(m.Sections, s)
+		r.pos = start + size
+	}
+	return m, nil
+}
+
+func (m *Module) decodeImports(r *Reader) {
+	for n := r.Uint(); n > 0 && r.err == nil; n-- {
+		r.Name()
+		r.Name()
+		switch r.Byte() {
+		case 0: // func
+			r.Uint()
+			m.Imported++
+		case 1: // table
+			r.Byte()
+			r.Limits()
+		case 2: // memory
+			r.Limits()
+		case 3: // global
+			r.Byte()
+			r.Byte()
+		default:
+			r.Fail("unknown import kind")
+		}
+	}
+}
+
+func (m *Module) decodeCode(r *Reader) {
+	for n := r.Uint(); n > 0 && r.err == nil; n-- {
+		start := r.pos
+		size := int(r.Uint())
+		if r.err != nil || r.pos+size > len(r.b) {
+			r.Fail("function body out of range")
+			return
+		}
+		m.Bodies = append(m.Bodies, Body{Offset: r.pos, Size: r.pos + size - start, Code: r.b[r.pos : r.pos+size]})
+		r.pos += size
+	}
+}
+
+func (m *Module) decodeData(r *Reader) {
+	for n := r.Uint(); n > 0 && r.err == nil; n-- {
+		var s Segment
+		switch r.Uint() {
+		case 0:
+			s.Active = true
+		case 1:
+		case 2:
+			r.Uint()
+			s.Active = true
+		default:
+			r.Fail("unknown data segment kind")
+			return
+		}
+		if s.Active {
+			// Go only emits constant offsets
+			if r.Byte() != 0x41 { // i32.const
+				r.Fail("unsupported data segment offset")
+				return
+			}
+			s.Addr = uint32(r.Int())
+			if r.Byte() != 0x0b {
+				r.Fail("unsupported data segment offset")
+				return
+			}
+		}
+		s.Data = r.Bytes(int(r.Uint()))
+		m.Segments = append(m.Segments, s)
+	}
+}
+
+// DecodeNames decodes the function names subsection of the contents of a name section, which
+// follow the name of the section. The names are in the function index space including imports.
+func DecodeNames(data []byte) (map[int]string, error) {
+	names := map[int]string{}
+	r := NewReader(data)
+	decodeNames(r, names)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return names, nil
+}
+
+func decodeNames(r *Reader, names map[int]string) {
+	for r.pos < len(r.b) && r.err == nil {
+		id := r.Byte()
+		size := int(r.Uint())
+		end := r.pos + size
+		if r.err != nil || end > len(r.b) {
+			r.Fail("name subsection out of range")
+			return
+		}
+		if id == 1 {
+			for n := r.Uint(); n > 0 && r.err == nil; n-- {
+				index := int(r.Uint())
+				names[index] = r.Name()
+			}
+		}
+		r.pos = end
+	}
+}
+
+// Memory returns the initial contents of linear memory.
+func (m *Module) Memory() []byte {
+	var size uint32
+	for _, s := range m.Segments {
+		if end := s.Addr + uint32(len(s.Data)); s.Active && end > size {
+			size = end
+		}
+	}
+	mem := make([]byte, size)
+	for _, s := range m.Segments {
+		if s.Active {
+			copy(mem[s.Addr:], s.Data)
+		}
+	}
+	return mem
+}
+
+// Reader decodes the wasm binary encoding. The first error is kept, and all reads after an error
+// return zero values.
+type Reader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+// NewReader returns a reader for b.
+func NewReader(b []byte) *Reader {
+	return &Reader{b: b}
+}
+
+// Pos returns the offset of the next byte.
+func (r *Reader) Pos() int {
+	return r.pos
+}
+
+// Err returns the first error.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Len returns the number of unread bytes.
+func (r *Reader) Len() int {
+	return len(r.b) - r.pos
+}
+
+// Fail records an error, unless there already is one, and skips the rest of the data.
+func (r *Reader) Fail(message string) {
+	if r.err == nil {
+		r.err = errors.New(message)
+	}
+	r.pos = len(r.b)
+}
+
+// Byte reads a byte.
+func (r *Reader) Byte() byte {
+	if r.pos >= len(r.b) {
+		r.Fail("unexpected end of data")
+		return 0
+	}
+	r.pos++
+	return r.b[r.pos-1]
+}
+
+// Bytes reads n bytes.
+func (r *Reader) Bytes(n int) []byte {
+	if n < 0 || r.pos+n > len(r.b) {
+		r.Fail("unexpected end of data")
+		return nil
+	}
+	r.pos += n
+	return r.b[r.pos-n : r.pos]
+}
+
+// Uint reads an unsigned LEB128 value.
+func (r *Reader) Uint() uint64 {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		c := r.Byte()
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+	r.Fail("LEB128 value too long")
+	return 0
+}
+
+// Int reads a signed LEB128 value.
+func (r *Reader) Int() int64 {
+	var v int64
+	for shift := uint(0); shift < 64; shift += 7 {
+		c := r.Byte()
+		v |= int64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			if shift+7 < 64 && c&0x40 != 0 {
+				v |= -1 << (shift + 7)
+			}
+			return v
+		}
+	}
+	r.Fail("LEB128 value too long")
+	return 0
+}
+
+// Fixed reads a little endian value of n bytes.
+func (r *Reader) Fixed(n int) uint64 {
+	var v uint64
+	for i, c := range r.Bytes(n) {
+		v |= uint64(c) << (8 * uint(i))
+	}
+	return v
+}
+
+// Name reads a length prefixed string.
+func (r *Reader) Name() string {
+	return string(r.Bytes(int(r.Uint())))
+}
+
+// Limits are the limits of a table or memory.
+type Limits struct {
+	Min, Max uint32
+	HasMax   bool
+}
+
+// Limits reads the limits of a table or memory.
+func (r *Reader) Limits() Limits {
+	var l Limits
+	if r.Byte()&1 != 0 {
+		l.Min = uint32(r.Uint())
+		l.Max = uint32(r.Uint())
+		l.HasMax = true
+	} else {
+		l.Min = uint32(r.Uint())
+	}
+	return l
+}
@@ -0,0 +1,111 @@
+package wasmbin
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// build compiles a small program with GOOS=js and returns the binary.
+func build(t *testing.T) []byte {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module hello\n\ngo 1.21\n",
+		"main.go": "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("go", "build", "-o", "main.wasm", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestDecode checks the decoded module against the one decoded by wagon, which the splitter uses.
+func TestDecode(t *testing.T) {
+	b := build(t)
+	m, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod, err := wasm.DecodeModule(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 8
+	for _, s := range m.Sections {
+		total += s.Size
+	}
+	if total != len(b) {
+		t.Fatalf("sections add up to %d bytes, binary is %d", total, len(b))
+	}
+
+	var imported int
+	for _, e := range mod.Import.Entries {
+		if e.Type.Kind() == wasm.ExternalFunction {
+			imported++
+		}
+	}
+	if m.Imported != imported {
+		t.Fatalf("got %d imported functions, expected %d", m.Imported, imported)
+	}
+
+	if len(m.Bodies) != len(mod.Code.Bodies) {
+		t.Fatalf("got %d bodies, expected %d", len(m.Bodies), len(mod.Code.Bodies))
+	}
+	for i, body := range m.Bodies {
+		if !bytes.Equal(b[body.Offset:body.Offset+len(body.Code)], body.Code) {
+			t.Fatalf("body %d isn't at offset %d", i, body.Offset)
+		}
+		// wagon keeps the instructions without the locals and the final end
+		code := body.Code[:len(body.Code)-1]
+		if !bytes.HasSuffix(code, mod.Code.Bodies[i].Code) {
+			t.Fatalf("body %d doesn't match", i)
+		}
+	}
+
+	if len(m.Segments) != len(mod.Data.Entries) {
+		t.Fatalf("got %d data segments, expected %d", len(m.Segments), len(mod.Data.Entries))
+	}
+	mem := m.Memory()
+	for i, s := range m.Segments {
+		if !bytes.Equal(s.Data, mod.Data.Entries[i].Data) {
+			t.Fatalf("data segment %d doesn't match", i)
+		}
+		if s.Active && !bytes.Equal(mem[s.Addr:int(s.Addr)+len(s.Data)], s.Data) {
+			t.Fatalf("data segment %d isn't in memory at %d", i, s.Addr)
+		}
+	}
+
+	if m.Names[imported] == "" {
+		t.Fatalf("first defined function has no name")
+	}
+	names, err := DecodeNames(mod.Custom(wasm.CustomSectionName).Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, m.Names) {
+		t.Fatalf("names decoded from the name section don't match the module")
+	}
+}
@@ -1,10 +1,33 @@
 module github.com/dave/wasmgo
 
+go 1.21
+
 require (
 	github.com/dave/jsgo v0.0.2
 	github.com/dave/services v0.1.0
+	github.com/dustin/go-humanize v1.0.0
+	github.com/go-interpreter/wagon v0.6.0
 	github.com/gorilla/websocket v1.4.0
-	github.com/hajimehoshi/ebiten v1.8.3 // indirect
 	github.com/pkg/browser v0.0.0-20180916011732-0a3d74bf9ce4
 	github.com/spf13/cobra v0.0.3
+	github.com/spf13/pflag v1.0.3
+	golang.org/x/mod v0.17.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	cloud.google.com/go v0.34.0 // indirect
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/googleapis/gax-go v2.0.2+incompatible // indirect
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	go.opencensus.io v0.18.0 // indirect
+	golang.org/x/net v0.0.0-20181220203305-927f97764cc3 // indirect
+	golang.org/x/oauth2 v0.0.0-20181203162652-d668ce993890 // indirect
+	golang.org/x/sys v0.0.0-20190306220234-b354f8bf4d9e // indirect
+	golang.org/x/text v0.3.0 // indirect
+	google.golang.org/api v0.0.0-20181221000618-65a46cafb132 // indirect
+	google.golang.org/appengine v1.4.0 // indirect
+	google.golang.org/genproto v0.0.0-20181221175505-bd9b4fb69e2f // indirect
+	google.golang.org/grpc v1.17.0 // indirect
+	gopkg.in/src-d/go-billy.v4 v4.3.0 // indirect
 )